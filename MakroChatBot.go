@@ -6,13 +6,28 @@ import (
 	"os/signal"
 	"syscall"
 
+	"github.com/generalkenobi/makrochatbot/bot"
 	"github.com/generalkenobi/makrochatbot/initialization"
 	"github.com/generalkenobi/makrochatbot/logger"
 )
 
+// consoleMode is the command line argument which makes the bot run in a console instead of connecting to Discord
+const consoleMode = "console"
+
 func main() {
 
-	session, err := initialization.Run()
+	// Channel that is closed when the bot should finish on its own (e.g. console input was exhausted)
+	var done <-chan struct{}
+
+	var b *bot.Bot
+	var err error
+
+	// Choose the run mode - console if it was requested, Discord otherwise
+	if len(os.Args) > 1 && os.Args[1] == consoleMode {
+		b, done, err = initialization.RunConsole()
+	} else {
+		b, err = initialization.Run()
+	}
 
 	if err != nil {
 		logger.LogError(err)
@@ -20,15 +35,19 @@ func main() {
 	}
 
 	// Update status with a cool message
-	session.UpdateStatus(0, "I Love democracy")
+	b.Transport().UpdateStatus("I Love democracy")
 
-	defer session.Close()
+	defer b.Stop()
 
 	// Wait here for control signal that closes the bot
 	fmt.Println("Running, press CTRL-C to exit.")
 	sc := make(chan os.Signal, 1)
 	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt, os.Kill)
-	<-sc
+
+	select {
+	case <-sc:
+	case <-done:
+	}
 
 	fmt.Printf("Finishing...")
 }
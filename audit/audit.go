@@ -0,0 +1,445 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Names of the files of the log
+const (
+	// logFileName is the name of the file to which entries are appended
+	logFileName = "audit.jsonl"
+
+	// rotatedFilePrefix and rotatedFileSuffix surround the number of a rotated file, e.g. "audit.1.jsonl" is the newest one
+	rotatedFilePrefix = "audit."
+	rotatedFileSuffix = ".jsonl"
+)
+
+// Defaults used when Open gets limits that are not positive
+const (
+	// DefaultMaxFileSize is the size (in bytes) at which the log file is rotated
+	DefaultMaxFileSize = 1024 * 1024
+
+	// DefaultRotatedFiles is the number of rotated files that are kept
+	DefaultRotatedFiles = 5
+)
+
+// maxMemoryEntries is the number of entries kept by a log that is not persisted, the oldest ones are forgotten first
+const maxMemoryEntries = 1000
+
+// maxLineLength is the longest line that can be read from the log files, entries are much shorter
+const maxLineLength = 1024 * 1024
+
+// Outcomes of invocations
+const (
+	// OutcomeSuccess means that the command finished without an error
+	OutcomeSuccess = "success"
+
+	// OutcomeError means that the command returned an error, see Entry.ErrorClass
+	OutcomeError = "error"
+
+	// OutcomePanic means that the command panicked
+	OutcomePanic = "panic"
+)
+
+// Classes of errors returned by commands
+const (
+	// ErrorClassUser is an error caused by the user, e.g. bad arguments or an exceeded rate limit
+	ErrorClassUser = "user"
+
+	// ErrorClassPermission is a denial - the user wasn't allowed to use the command
+	ErrorClassPermission = "permission"
+
+	// ErrorClassSilent is an error the user wasn't told about, e.g. repeated exceeding of a rate limit
+	ErrorClassSilent = "silent"
+
+	// ErrorClassInternal is a failure of the bot
+	ErrorClassInternal = "internal"
+
+	// ErrorClassDisabled is a use of a command that is disabled in the channel, the command wasn't run
+	ErrorClassDisabled = "disabled"
+)
+
+// Entry is one invocation of a command, written to the log as a single JSON line
+type Entry struct {
+
+	// Time at which the command was invoked
+	Time time.Time
+
+	// Guild and channel in which the command was invoked, GuildID is empty in direct messages
+	GuildID   string `json:",omitempty"`
+	ChannelID string
+
+	// User who invoked the command
+	UserID   string
+	Username string `json:",omitempty"`
+
+	// Full name of the command, e.g. "monitor add"
+	Command string
+
+	// Arguments passed by the user
+	Args []string `json:",omitempty"`
+
+	// Outcome of the invocation, one of the Outcome constants
+	Outcome string
+
+	// Latency is the time (in milliseconds) it took to run the command
+	Latency int64
+
+	// ErrorClass is one of the ErrorClass constants if Outcome is OutcomeError, empty otherwise
+	ErrorClass string `json:",omitempty"`
+}
+
+// Query selects entries of the log. Empty fields match all entries.
+type Query struct {
+
+	// GuildID selects the entries of one guild
+	GuildID string
+
+	// UserID selects the entries of one user
+	UserID string
+
+	// Command selects the entries of a command, names of command groups (e.g. "monitor") select all their subcommands too.
+	// Case insensitive.
+	Command string
+
+	// Limit is the maximum number of entries returned, all matching entries are returned if it's not positive
+	Limit int
+}
+
+// matches returns true if the entry is selected by the query
+func (q Query) matches(entry *Entry) bool {
+
+	if q.GuildID != "" && entry.GuildID != q.GuildID {
+		return false
+	}
+
+	if q.UserID != "" && entry.UserID != q.UserID {
+		return false
+	}
+
+	if q.Command != "" {
+		command, wanted := strings.ToLower(entry.Command), strings.ToLower(q.Command)
+		if command != wanted && !strings.HasPrefix(command, wanted+" ") {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Log appends command invocations to a JSON Lines file, one entry per line. When the file grows over its maximum size it's
+// rotated - renamed to audit.1.jsonl, while older rotated files are shifted (audit.1.jsonl to audit.2.jsonl and so on) and the
+// oldest one is removed. It is safe for concurrent use.
+type Log struct {
+
+	// directory in which the files are kept, empty if the log is not persisted
+	directory string
+
+	// maxFileSize is the size (in bytes) at which the file is rotated
+	maxFileSize int64
+
+	// rotatedFiles is the number of rotated files that are kept
+	rotatedFiles int
+
+	// file is the open log file, nil until the first entry is appended (and after Close)
+	file *os.File
+
+	// fileSize is the size of the open file
+	fileSize int64
+
+	// memory holds the entries of a log that is not persisted, the oldest first
+	memory []Entry
+
+	// mutex is used to synchronize access to the files and memory
+	mutex sync.Mutex
+}
+
+// Open creates a log persisted in the given directory. The file is rotated when it reaches maxFileSize bytes and rotatedFiles
+// rotated files are kept (DefaultMaxFileSize and DefaultRotatedFiles are used if they are not positive).
+// If directory is empty then the log is not persisted - the most recent entries are kept in memory only.
+// Returns an error if the directory can't be created.
+func Open(directory string, maxFileSize int64, rotatedFiles int) (*Log, error) {
+
+	if maxFileSize <= 0 {
+		maxFileSize = DefaultMaxFileSize
+	}
+
+	if rotatedFiles <= 0 {
+		rotatedFiles = DefaultRotatedFiles
+	}
+
+	log := &Log{directory: directory, maxFileSize: maxFileSize, rotatedFiles: rotatedFiles}
+
+	if directory == "" {
+		return log, nil
+	}
+
+	// Make sure the directory exists
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return nil, errors.New("Can't create data directory " + directory + ". Details: " + err.Error())
+	}
+
+	return log, nil
+}
+
+// Append writes the entry at the end of the log, rotating the file first if the entry doesn't fit in it
+func (l *Log) Append(entry Entry) error {
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.directory == "" {
+		l.memory = append(l.memory, entry)
+
+		if len(l.memory) > maxMemoryEntries {
+			l.memory = append([]Entry(nil), l.memory[len(l.memory)-maxMemoryEntries:]...)
+		}
+
+		return nil
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return errors.New("Can't encode audit entry. Details: " + err.Error())
+	}
+
+	line = append(line, '\n')
+
+	if err = l.open(); err != nil {
+		return err
+	}
+
+	// Rotate unless the file is empty, an entry larger than the limit still has to be written somewhere
+	if l.fileSize > 0 && l.fileSize+int64(len(line)) > l.maxFileSize {
+		if err = l.rotate(); err != nil {
+			return err
+		}
+	}
+
+	written, err := l.file.Write(line)
+	l.fileSize += int64(written)
+
+	if err != nil {
+		return errors.New("Can't write " + l.file.Name() + ". Details: " + err.Error())
+	}
+
+	return nil
+}
+
+// Find returns the most recent entries selected by the query, the newest first. Lines that can't be decoded (e.g. written
+// partially during a crash) are skipped. The files are read without blocking Append - entries appended meanwhile are not found.
+func (l *Log) Find(query Query) ([]Entry, error) {
+
+	var found []Entry
+
+	// collect adds the matching entries, which are in chronological order, and returns true when the limit is reached
+	collect := func(entries []Entry) bool {
+
+		for i := len(entries) - 1; i >= 0; i-- {
+
+			if !query.matches(&entries[i]) {
+				continue
+			}
+
+			found = append(found, entries[i])
+			if query.Limit > 0 && len(found) == query.Limit {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	l.mutex.Lock()
+
+	// Entries in memory are never modified, trimming replaces the slice
+	if l.directory == "" {
+		memory := l.memory
+		l.mutex.Unlock()
+
+		collect(memory)
+		return found, nil
+	}
+
+	files, err := l.openFiles()
+	l.mutex.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer closeFiles(files)
+
+	// Go from the current file to the oldest rotated one
+	for _, file := range files {
+
+		entries, err := readEntries(file)
+		if err != nil {
+			return nil, err
+		}
+
+		if collect(entries) {
+			break
+		}
+	}
+
+	return found, nil
+}
+
+// Close closes the log file. The log can still be used, the file is opened again when the next entry is appended.
+func (l *Log) Close() error {
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+
+	err := l.file.Close()
+	l.file = nil
+
+	if err != nil {
+		return errors.New("Can't close audit log. Details: " + err.Error())
+	}
+
+	return nil
+}
+
+// open opens the log file for appending, if it's not open yet. Mutex has to be held by the caller.
+func (l *Log) open() error {
+
+	if l.file != nil {
+		return nil
+	}
+
+	path := l.filePath(0)
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.New("Can't open " + path + ". Details: " + err.Error())
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return errors.New("Can't read size of " + path + ". Details: " + err.Error())
+	}
+
+	l.file, l.fileSize = file, info.Size()
+	return nil
+}
+
+// rotate closes the log file, shifts the rotated files and starts a new log file. Mutex has to be held by the caller.
+func (l *Log) rotate() error {
+
+	if err := l.file.Close(); err != nil {
+		return errors.New("Can't close " + l.file.Name() + ". Details: " + err.Error())
+	}
+
+	l.file = nil
+
+	// The oldest file is replaced by the one before it, missing files are skipped
+	for number := l.rotatedFiles - 1; number >= 0; number-- {
+		if err := os.Rename(l.filePath(number), l.filePath(number+1)); err != nil && !os.IsNotExist(err) {
+			return errors.New("Can't rotate " + l.filePath(number) + ". Details: " + err.Error())
+		}
+	}
+
+	return l.open()
+}
+
+// filePath returns the path of the log file (number 0) or of a rotated file (numbers from 1, the newest first)
+func (l *Log) filePath(number int) string {
+
+	if number == 0 {
+		return filepath.Join(l.directory, logFileName)
+	}
+
+	return filepath.Join(l.directory, rotatedFilePrefix+strconv.Itoa(number)+rotatedFileSuffix)
+}
+
+// openedFile is a file of the log opened for reading
+type openedFile struct {
+
+	// file is the open file
+	file *os.File
+
+	// size is the size of the file when it was opened, only that much is read
+	size int64
+}
+
+// openFiles opens the log file and the rotated files for reading, the newest first. Missing files are skipped. Each file is
+// read only up to its current size, so that it can be read while entries are appended - and as open files are not affected by
+// renaming, while the files are rotated. Mutex has to be held by the caller.
+func (l *Log) openFiles() ([]openedFile, error) {
+
+	var files []openedFile
+
+	for number := 0; number <= l.rotatedFiles; number++ {
+
+		path := l.filePath(number)
+
+		file, err := os.Open(path)
+
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		if err != nil {
+			closeFiles(files)
+			return nil, errors.New("Can't open " + path + ". Details: " + err.Error())
+		}
+
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			closeFiles(files)
+			return nil, errors.New("Can't read size of " + path + ". Details: " + err.Error())
+		}
+
+		files = append(files, openedFile{file: file, size: info.Size()})
+	}
+
+	return files, nil
+}
+
+// closeFiles closes the files opened by openFiles
+func closeFiles(files []openedFile) {
+
+	for _, file := range files {
+		file.file.Close()
+	}
+}
+
+// readEntries reads all entries of the file, in order
+func readEntries(file openedFile) ([]Entry, error) {
+
+	var entries []Entry
+
+	scanner := bufio.NewScanner(io.LimitReader(file.file, file.size))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineLength)
+
+	for scanner.Scan() {
+
+		var entry Entry
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil {
+			entries = append(entries, entry)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.New("Can't read " + file.file.Name() + ". Details: " + err.Error())
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,295 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testEntry creates an entry of the command invoked by the user in the guild, number makes the entries distinguishable
+func testEntry(number int, guildID, userID, command string) Entry {
+	return Entry{
+		Time:      time.Date(2024, 5, 1, 12, 0, number, 0, time.UTC),
+		GuildID:   guildID,
+		ChannelID: "channel",
+		UserID:    userID,
+		Command:   command,
+		Args:      []string{strconv.Itoa(number)},
+		Outcome:   OutcomeSuccess,
+	}
+}
+
+// entryNumbers returns the numbers of the entries (see testEntry)
+func entryNumbers(entries []Entry) []string {
+
+	numbers := make([]string, len(entries))
+	for i, entry := range entries {
+		numbers[i] = entry.Args[0]
+	}
+
+	return numbers
+}
+
+func TestFind(t *testing.T) {
+
+	entries := []Entry{
+		testEntry(1, "guild", "user", "roll"),
+		testEntry(2, "guild", "admin", "monitor add"),
+		testEntry(3, "other guild", "user", "roll"),
+		testEntry(4, "guild", "user", "monitor remove"),
+		testEntry(5, "guild", "user", "monitoring"),
+		testEntry(6, "", "user", "roll"),
+	}
+
+	tests := []struct {
+		name    string
+		query   Query
+		numbers []string
+	}{
+		{name: "all", query: Query{}, numbers: []string{"6", "5", "4", "3", "2", "1"}},
+		{name: "limit", query: Query{Limit: 2}, numbers: []string{"6", "5"}},
+		{name: "guild", query: Query{GuildID: "guild"}, numbers: []string{"5", "4", "2", "1"}},
+		{name: "user in guild", query: Query{GuildID: "guild", UserID: "user"}, numbers: []string{"5", "4", "1"}},
+		{name: "command", query: Query{Command: "roll"}, numbers: []string{"6", "3", "1"}},
+		{name: "group includes subcommands", query: Query{Command: "MONITOR"}, numbers: []string{"4", "2"}},
+		{name: "subcommand", query: Query{Command: "monitor add"}, numbers: []string{"2"}},
+		{name: "nothing found", query: Query{UserID: "nobody"}, numbers: []string{}},
+	}
+
+	// Persisted and in-memory logs have to find the same entries
+	logs := []struct {
+		name      string
+		directory string
+	}{
+		{name: "file", directory: t.TempDir()},
+		{name: "memory", directory: ""},
+	}
+
+	for _, log := range logs {
+
+		auditLog, err := Open(log.directory, 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, entry := range entries {
+			if err = auditLog.Append(entry); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for _, test := range tests {
+			t.Run(log.name+"/"+test.name, func(t *testing.T) {
+
+				found, err := auditLog.Find(test.query)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if numbers := entryNumbers(found); !reflect.DeepEqual(numbers, test.numbers) {
+					t.Errorf("Find(%+v) = %v, expected %v", test.query, numbers, test.numbers)
+				}
+			})
+		}
+
+		if err = auditLog.Close(); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestRotate(t *testing.T) {
+
+	tests := []struct {
+		name         string
+		entries      int
+		rotatedFiles int
+		files        []string
+		oldest       string
+	}{
+		{name: "fits in one file", entries: 3, rotatedFiles: 2, files: []string{"audit.jsonl"}, oldest: "1"},
+		{name: "rotated once", entries: 4, rotatedFiles: 2, files: []string{"audit.jsonl", "audit.1.jsonl"}, oldest: "1"},
+		{name: "all rotated files used", entries: 9, rotatedFiles: 2, files: []string{"audit.jsonl", "audit.1.jsonl", "audit.2.jsonl"}, oldest: "1"},
+		{name: "oldest file removed", entries: 10, rotatedFiles: 2, files: []string{"audit.jsonl", "audit.1.jsonl", "audit.2.jsonl"}, oldest: "4"},
+		{name: "many rotations", entries: 20, rotatedFiles: 1, files: []string{"audit.jsonl", "audit.1.jsonl"}, oldest: "16"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			directory := t.TempDir()
+
+			// The files hold three entries each - the size is measured with the longest number used, shorter entries can't make
+			// room for a fourth one
+			entrySize := entryLength(t, testEntry(10, "guild", "user", "roll"))
+
+			auditLog, err := Open(directory, 3*entrySize, test.rotatedFiles)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer auditLog.Close()
+
+			for number := 1; number <= test.entries; number++ {
+				if err = auditLog.Append(testEntry(number, "guild", "user", "roll")); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			names, err := filepath.Glob(filepath.Join(directory, "*"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i := range names {
+				names[i] = filepath.Base(names[i])
+			}
+
+			// Glob returns the names sorted
+			sort.Strings(test.files)
+
+			if !reflect.DeepEqual(names, test.files) {
+				t.Errorf("Files = %v, expected %v", names, test.files)
+			}
+
+			// Entries are found across the files, the newest first, up to the oldest kept one
+			found, err := auditLog.Find(Query{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			numbers := entryNumbers(found)
+
+			if numbers[0] != strconv.Itoa(test.entries) || numbers[len(numbers)-1] != test.oldest {
+				t.Errorf("Found entries %v, expected from %d to %s", numbers, test.entries, test.oldest)
+			}
+		})
+	}
+}
+
+func TestFindSkipsDamagedLines(t *testing.T) {
+
+	directory := t.TempDir()
+
+	auditLog, err := Open(directory, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = auditLog.Append(testEntry(1, "guild", "user", "roll")); err != nil {
+		t.Fatal(err)
+	}
+
+	auditLog.Close()
+
+	// A crash can leave a half-written line behind, the log goes on after it
+	file, err := os.OpenFile(filepath.Join(directory, logFileName), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file.WriteString("{\"Time\":\"2024-05-01T12:00\n")
+	file.Close()
+
+	if err = auditLog.Append(testEntry(2, "guild", "user", "roll")); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := auditLog.Find(Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if numbers := entryNumbers(found); !reflect.DeepEqual(numbers, []string{"2", "1"}) {
+		t.Errorf("Found entries %v, expected [2 1]", numbers)
+	}
+}
+
+// entryLength returns the length of the line the entry takes in the file
+func entryLength(t *testing.T, entry Entry) int64 {
+
+	directory := t.TempDir()
+
+	auditLog, err := Open(directory, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = auditLog.Append(entry); err != nil {
+		t.Fatal(err)
+	}
+
+	auditLog.Close()
+
+	info, err := os.Stat(filepath.Join(directory, logFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return info.Size()
+}
+
+func TestFindWhileAppending(t *testing.T) {
+
+	const entries = 300
+
+	// Files hold a few entries and are rotated often, but none are removed
+	entrySize := entryLength(t, testEntry(100, "guild", "user", "roll"))
+
+	auditLog, err := Open(t.TempDir(), 3*entrySize, entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer auditLog.Close()
+
+	appended := make(chan error, 1)
+	go func() {
+		for number := 1; number <= entries; number++ {
+			if err := auditLog.Append(testEntry(number, "guild", "user", "roll")); err != nil {
+				appended <- err
+				return
+			}
+		}
+
+		appended <- nil
+	}()
+
+	// Whenever the log is searched, it holds all entries appended so far - none are skipped or found twice while files are
+	// written and rotated
+	for done := false; !done; {
+
+		select {
+		case err := <-appended:
+			{
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				done = true
+			}
+		default:
+		}
+
+		found, err := auditLog.Find(Query{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		numbers := entryNumbers(found)
+
+		for i, number := range numbers {
+			if expected := strconv.Itoa(len(numbers) - i); number != expected {
+				t.Fatalf("Found entries %v, expected from %d to 1", numbers, len(numbers))
+			}
+		}
+
+		if done && len(numbers) != entries {
+			t.Errorf("Found %d entries after appending, expected %d", len(numbers), entries)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package bot
+
+import (
+	"errors"
+
+	"github.com/generalkenobi/makrochatbot/audit"
+	"github.com/generalkenobi/makrochatbot/commands/handler"
+	pm "github.com/generalkenobi/makrochatbot/commands/platformmonitor"
+	"github.com/generalkenobi/makrochatbot/commands/usage"
+	"github.com/generalkenobi/makrochatbot/communication"
+	ct "github.com/generalkenobi/makrochatbot/customtypes"
+	"github.com/generalkenobi/makrochatbot/logger"
+	"github.com/generalkenobi/makrochatbot/storage"
+	"sync"
+)
+
+// Bot is a single instance of the chat bot. It owns the transport it communicates through, the command handler with all
+// registered commands and the platform monitor. Bots don't share any state, so multiple bots can run in one process.
+type Bot struct {
+
+	// config is the configuration the bot was created with
+	config ct.Config
+
+	// transport is used for all communication
+	transport communication.Transport
+
+	// communicator is used to send messages through transport
+	communicator *communication.Communicator
+
+	// handler parses incoming messages and runs commands
+	handler *handler.Handler
+
+	// monitor is the platform monitoring service
+	monitor *pm.Monitor
+
+	// auditLog records invocations of commands
+	auditLog *audit.Log
+
+	// usage counts uses of commands for the stats command
+	usage *usage.Stats
+
+	// running is true between successful calls to Start and Stop
+	running bool
+
+	// runningMutex is used to synchronize Start and Stop
+	runningMutex sync.Mutex
+}
+
+// New creates a bot configured with config which will communicate through transport. All commands are registered and the
+// handler is hooked into the transport but the transport is not opened until Start is called.
+// If the bot can't be created (e.g. config is invalid) then the returned bot is nil and error contains information about the error.
+func New(config ct.Config, transport communication.Transport) (*Bot, error) {
+
+	if transport == nil {
+		return nil, errors.New("Can't create bot - transport is nil")
+	}
+
+	communicator := communication.NewCommunicator(transport)
+
+	// Open the storage of guild settings
+	store, err := storage.Open(config.DataDirectory)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Open the audit log of command invocations, kept next to the guild settings
+	auditLog, err := audit.Open(config.DataDirectory, int64(config.AuditLogMaxSize)*1024, config.AuditLogFiles)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Open the usage statistics, also kept in the data directory
+	usageStats, err := usage.Open(config.DataDirectory)
+
+	if err != nil {
+		closeRecords(auditLog, nil)
+		return nil, err
+	}
+
+	// Create the command handler for the configured prefix
+	commandHandler, err := handler.New(config, communicator, store, auditLog)
+
+	if err != nil {
+		closeRecords(auditLog, usageStats)
+		return nil, err
+	}
+
+	bot := &Bot{
+		config:       config,
+		transport:    transport,
+		communicator: communicator,
+		handler:      commandHandler,
+		monitor:      pm.New(communicator, config.Platforms),
+		auditLog:     auditLog,
+		usage:        usageStats,
+	}
+
+	// Apply the middlewares to all commands. Permissions are checked before rate limits, so that denied uses don't count.
+	// Auditing is the outermost, so that denied and limited uses are recorded too, while usage statistics count only the uses
+	// that weren't denied.
+	commandHandler.Use(
+		commandHandler.AuditMiddleware,
+		handler.LoggingMiddleware,
+		handler.TimingMiddleware,
+		commandHandler.PermissionMiddleware,
+		commandHandler.RateLimitMiddleware,
+		usageStats.Middleware,
+	)
+
+	// Call the helper function to register all commands
+	bot.registerCommands()
+
+	// Add handlers for incomming, edited and deleted messages, slash commands and reactions
+	transport.OnMessage(commandHandler.ParseCommand)
+	transport.OnMessageEdit(commandHandler.HandleMessageEdit)
+	transport.OnMessageDelete(commandHandler.HandleMessageDelete)
+	transport.OnInteraction(commandHandler.HandleInteraction)
+	transport.OnReactionAdd(commandHandler.HandleReaction)
+	transport.OnReactionRemove(commandHandler.HandleReactionRemove)
+	logger.Log("Command handler initialized")
+
+	return bot, nil
+}
+
+// Start opens the transport, publishes slash commands and starts the platform monitoring service.
+// Returns an error if the bot is already running or the transport couldn't be opened.
+func (b *Bot) Start() error {
+
+	b.runningMutex.Lock()
+	defer b.runningMutex.Unlock()
+
+	if b.running {
+		return errors.New("Bot is already running")
+	}
+
+	// Open the transport, without it the bot can't run
+	if err := b.transport.Open(); err != nil {
+		return err
+	}
+
+	logger.Log("Core initialization complete")
+
+	// Publish the slash commands. Commands can still be typed if that fails, so the bot keeps running.
+	if err := b.transport.PublishCommands(b.handler.ApplicationCommands()); err != nil {
+		logger.LogError(err)
+	} else {
+		logger.Log("Slash commands published")
+	}
+
+	// Start running commands
+	b.handler.Start()
+	logger.Log("Command workers started")
+
+	// Start platform monitoring service
+	b.monitor.Start(b.config.PlatformMonitoringPeriod)
+	logger.Log("Platform monitoring service started")
+
+	b.running = true
+	return nil
+}
+
+// Stop stops the platform monitoring service and closes the transport. Stopping a bot that isn't running does nothing.
+func (b *Bot) Stop() error {
+
+	b.runningMutex.Lock()
+	defer b.runningMutex.Unlock()
+
+	if !b.running {
+		return nil
+	}
+
+	b.running = false
+	b.monitor.Stop()
+
+	// The handler waits for all running commands, nothing is recorded after it stops
+	b.handler.Stop()
+	closeRecords(b.auditLog, b.usage)
+
+	return b.transport.Close()
+}
+
+// closeRecords closes the audit log and saves the usage statistics that weren't saved yet, errors are only logged.
+// usageStats can be nil if the statistics weren't opened.
+func closeRecords(auditLog *audit.Log, usageStats *usage.Stats) {
+
+	if err := auditLog.Close(); err != nil {
+		logger.LogError(err)
+	}
+
+	if usageStats == nil {
+		return
+	}
+
+	if err := usageStats.Flush(); err != nil {
+		logger.LogError(err)
+	}
+}
+
+// CrashCounts returns the number of panics caught while running each command, for diagnostics
+func (b *Bot) CrashCounts() map[string]int {
+	return b.handler.CrashCounts()
+}
+
+// CommandStats returns metrics of the workers running commands, e.g. queue depth
+func (b *Bot) CommandStats() handler.PoolStats {
+	return b.handler.Stats()
+}
+
+// Transport returns the transport used by the bot
+func (b *Bot) Transport() communication.Transport {
+	return b.transport
+}
@@ -0,0 +1,273 @@
+package bot
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	dg "github.com/bwmarrin/discordgo"
+	"github.com/generalkenobi/makrochatbot/communication"
+	ct "github.com/generalkenobi/makrochatbot/customtypes"
+)
+
+// waitTimeout is the time given to the bot to handle a message, commands are run by workers asynchronously
+const waitTimeout = 2 * time.Second
+
+// startBot creates a bot running on a memory transport, nothing is persisted. The bot is stopped when the test ends.
+func startBot(t *testing.T) *communication.MemoryTransport {
+
+	transport := communication.NewMemoryTransport()
+
+	b, err := New(ct.Config{CommandPrefix: "!"}, transport)
+	if err != nil {
+		t.Fatal("Can't create bot. Details: " + err.Error())
+	}
+
+	if err = b.Start(); err != nil {
+		t.Fatal("Can't start bot. Details: " + err.Error())
+	}
+
+	t.Cleanup(func() { b.Stop() })
+
+	return transport
+}
+
+// waitForSent waits until a message sent through the transport satisfies the condition and returns it. Fails the test if there
+// is no such message in time.
+func waitForSent(t *testing.T, transport *communication.MemoryTransport, description string,
+	condition func(communication.SentMessage) bool) communication.SentMessage {
+
+	t.Helper()
+
+	deadline := time.Now().Add(waitTimeout)
+
+	for time.Now().Before(deadline) {
+
+		for _, sent := range transport.Sent() {
+			if condition(sent) {
+				return sent
+			}
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatal("No message " + description + " was sent")
+	return communication.SentMessage{}
+}
+
+func TestTypedCommandIsEditedAndDeleted(t *testing.T) {
+
+	transport := startBot(t)
+
+	message := &dg.Message{
+		ID:        "message",
+		ChannelID: "channel",
+		GuildID:   "guild",
+		Content:   "!prefix",
+		Author:    &dg.User{ID: "user", Username: "Kowalski"},
+	}
+
+	// Send
+	transport.Receive(message)
+
+	response := waitForSent(t, transport, "with the prefix", func(sent communication.SentMessage) bool {
+		return sent.ChannelID == "channel" && strings.Contains(sent.Message.Content, "The command prefix here is `!`")
+	})
+
+	// Edit - the response is edited to the output of the new command instead of sending another message
+	edited := *message
+	edited.Content = "!help roll"
+	transport.ReceiveEdit(&edited)
+
+	waitForSent(t, transport, "edited to the help of roll", func(sent communication.SentMessage) bool {
+		return sent.MessageID == response.MessageID && sent.Edited && len(sent.Message.Embeds) > 0
+	})
+
+	if count := len(transport.Sent()); count != 1 {
+		t.Error("Expected the response to be edited, but " + strconv.Itoa(count) + " messages were sent")
+	}
+
+	// Delete - the response is deleted with the command
+	transport.ReceiveDelete(&edited)
+
+	waitForSent(t, transport, "deleted", func(sent communication.SentMessage) bool {
+		return sent.MessageID == response.MessageID && sent.Deleted
+	})
+}
+
+func TestSlashCommandResponse(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		data      dg.ApplicationCommandInteractionData
+		content   string
+		embeds    bool
+		ephemeral bool
+	}{
+		{
+			name:    "content",
+			data:    dg.ApplicationCommandInteractionData{Name: "prefix"},
+			content: "The command prefix here is `!`",
+		},
+		{
+			name: "embed",
+			data: dg.ApplicationCommandInteractionData{
+				Name: "help",
+				Options: []*dg.ApplicationCommandInteractionDataOption{
+					{Name: "command", Type: dg.ApplicationCommandOptionString, Value: "roll"},
+				},
+			},
+			embeds: true,
+		},
+		{
+			name: "invalid argument",
+			data: dg.ApplicationCommandInteractionData{
+				Name: "roll",
+				Options: []*dg.ApplicationCommandInteractionDataOption{
+					{Name: "max", Type: dg.ApplicationCommandOptionInteger, Value: float64(0)},
+				},
+			},
+			content:   "Argument `max` must be",
+			ephemeral: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			transport := startBot(t)
+
+			interaction := &dg.Interaction{
+				ID:        "interaction",
+				Type:      dg.InteractionApplicationCommand,
+				ChannelID: "channel",
+				GuildID:   "guild",
+				Member:    &dg.Member{User: &dg.User{ID: "user", Username: "Kowalski"}},
+				Data:      test.data,
+			}
+
+			transport.ReceiveInteraction(interaction)
+
+			// The command is acknowledged first, its output then replaces the acknowledgement or follows it
+			sent := waitForSent(t, transport, "in response to the interaction", func(sent communication.SentMessage) bool {
+				return sent.InteractionID == interaction.ID && !sent.Deferred && !sent.Deleted
+			})
+
+			if !strings.Contains(sent.Message.Content, test.content) {
+				t.Error("Expected response containing " + test.content + ", got " + sent.Message.Content)
+			}
+
+			if test.embeds && len(sent.Message.Embeds) == 0 {
+				t.Error("Expected response with embeds")
+			}
+
+			if ephemeral := sent.Message.Flags&dg.MessageFlagsEphemeral != 0; ephemeral != test.ephemeral {
+				t.Error("Expected ephemeral response to be " + strconv.FormatBool(test.ephemeral))
+			}
+
+			// The response can be fetched with everything that was sent
+			response, err := transport.InteractionResponse(interaction)
+			if err != nil {
+				t.Fatal("Can't get response. Details: " + err.Error())
+			}
+
+			if test.embeds && len(response.Embeds) == 0 {
+				t.Error("Expected fetched response with embeds")
+			}
+		})
+	}
+}
+
+func TestGuildOnlyCommandInDirectMessage(t *testing.T) {
+
+	transport := startBot(t)
+
+	// Typed commands in direct messages have no guild
+	transport.Receive(&dg.Message{
+		ID:        "message",
+		ChannelID: "dm-user",
+		Content:   "!setprefix ?",
+		Author:    &dg.User{ID: "user", Username: "Kowalski"},
+	})
+
+	// Slash commands in direct messages have a user instead of a member
+	transport.ReceiveInteraction(&dg.Interaction{
+		ID:        "interaction",
+		Type:      dg.InteractionApplicationCommand,
+		ChannelID: "dm-user",
+		User:      &dg.User{ID: "user", Username: "Kowalski"},
+		Data: dg.ApplicationCommandInteractionData{
+			Name: "setprefix",
+			Options: []*dg.ApplicationCommandInteractionDataOption{
+				{Name: "prefix", Type: dg.ApplicationCommandOptionString, Value: "?"},
+			},
+		},
+	})
+
+	// The user is told where the command can be used, not that they lack a permission they can't have there
+	for _, invocation := range []string{"typed", "slash"} {
+
+		interaction := invocation == "slash"
+
+		sent := waitForSent(t, transport, "answering the "+invocation+" command", func(sent communication.SentMessage) bool {
+			return (sent.InteractionID != "") == interaction && !sent.Deferred && !sent.Deleted && sent.Message.Content != ""
+		})
+
+		if !strings.Contains(sent.Message.Content, "can only be used on a server") {
+			t.Error("Expected the " + invocation + " command to be refused outside a server, got " + sent.Message.Content)
+		}
+	}
+}
+
+func TestRenamedCommands(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		content string
+		answer  string
+	}{
+		{name: "subscribe", content: "!subscribe", answer: "monitor add"},
+		{name: "unsubscribeall", content: "!unsubscribeall", answer: "You weren't subscribed to anyone"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			transport := startBot(t)
+
+			transport.Receive(&dg.Message{
+				ID:        "message",
+				ChannelID: "channel",
+				GuildID:   "guild",
+				Content:   test.content,
+				Author:    &dg.User{ID: "user", Username: "Kowalski"},
+			})
+
+			// Old names run the moved commands, e.g. the usage of subscribe is the usage of monitor add
+			waitForSent(t, transport, "answering "+test.content, func(sent communication.SentMessage) bool {
+				return strings.Contains(sent.Message.Content, test.answer)
+			})
+
+			// They are not published
+			transport.Receive(&dg.Message{
+				ID:        "help",
+				ChannelID: "channel",
+				GuildID:   "guild",
+				Content:   "!help",
+				Author:    &dg.User{ID: "user", Username: "Kowalski"},
+			})
+
+			help := waitForSent(t, transport, "with help", func(sent communication.SentMessage) bool {
+				return len(sent.Message.Embeds) > 0
+			})
+
+			for _, field := range help.Message.Embeds[0].Fields {
+				if strings.Contains(field.Value, test.name) {
+					t.Error("Expected " + test.name + " to be hidden, help lists it in " + field.Name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package bot
+
+import (
+	"github.com/generalkenobi/makrochatbot/commands/handler"
+	"github.com/generalkenobi/makrochatbot/commands/reactions"
+	"github.com/generalkenobi/makrochatbot/commands/roll"
+	"github.com/generalkenobi/makrochatbot/commands/usage"
+	ct "github.com/generalkenobi/makrochatbot/customtypes"
+	"github.com/generalkenobi/makrochatbot/logger"
+)
+
+// Categories of the commands handled by the bot
+const (
+	funCategory             = "Fun"
+	platformMonitorCategory = "Platform monitor"
+	statisticsCategory      = "Statistics"
+)
+
+// imageReactionRateLimits limits image reactions, which are the most common source of spam (each one uploads an image)
+var imageReactionRateLimits = &ct.CommandRateLimits{
+	PerUser:    ct.RateLimit{Count: 2, Seconds: 60},
+	PerChannel: ct.RateLimit{Count: 4, Seconds: 60},
+}
+
+// renamedCommands maps old names of moved commands to their new names. Old names keep working for one release as hidden aliases,
+// so that users have time to learn the new ones - remove them in the next release.
+var renamedCommands = map[string]string{
+	"subscribe":      "monitor add",
+	"unsubscribeall": "monitor clear",
+}
+
+// registerCommands registers all commands handled by the bot
+func (b *Bot) registerCommands() {
+
+	commands := []ct.Command{
+		{
+			Name:        "roll",
+			Description: "Rolls a random number from 0 to 100 (or to the given maximum)",
+			Arguments:   roll.Arguments,
+			Examples:    []string{"roll", "roll 20"},
+			Category:    funCategory,
+			Handler:     roll.Roll,
+		},
+		{
+			Name:        "group1",
+			Description: "Shows what we think about group 1",
+			Category:    funCategory,
+			RateLimits:  imageReactionRateLimits,
+			Handler:     reactions.ImageReaction,
+		},
+		{
+			Name:        "group2",
+			Description: "Shows what we think about group 2",
+			Category:    funCategory,
+			RateLimits:  imageReactionRateLimits,
+			Handler:     reactions.ImageReaction,
+		},
+		{
+			Name:        "monitor",
+			Description: "Notifies you when names appear on monitored platforms",
+			Category:    platformMonitorCategory,
+			Subcommands: []ct.Command{
+				{
+					Name:              "add",
+					Description:       "Sends you a direct message when the given name appears on the platform",
+					Arguments:         b.monitor.SubscriptionArguments(),
+					Examples:          []string{"monitor add Kowalski rau2", "monitor add \"Jan Kowalski\" rau3"},
+					EphemeralResponse: true,
+					Handler:           b.monitor.CreateMonitorSubscription,
+				},
+				{
+					Name:        "guide",
+					Description: "Asks you for the platform and the name step by step and subscribes you",
+					Interactive: true,
+					Handler:     b.monitor.GuidedSubscription,
+				},
+				{
+					Name:              "remove",
+					Description:       "Removes one of your subscriptions",
+					Arguments:         b.monitor.SubscriptionArguments(),
+					Examples:          []string{"monitor remove Kowalski rau2"},
+					Aliases:           []string{"rm"},
+					EphemeralResponse: true,
+					Handler:           b.monitor.RemoveSubscription,
+				},
+				{
+					Name:              "list",
+					Description:       "Lists your subscriptions",
+					EphemeralResponse: true,
+					Handler:           b.monitor.ListSubscriptions,
+				},
+				{
+					Name:              "clear",
+					Description:       "Removes all your subscriptions",
+					EphemeralResponse: true,
+					Handler:           b.monitor.RemoveAllSubscriptions,
+				},
+				{
+					Name:        "platforms",
+					Description: "Lists the platforms that can be monitored",
+					Handler:     b.monitor.ListPlatforms,
+				},
+			},
+		},
+		{
+			Name:        "stats",
+			Description: "Shows the most used commands, the most active users and the trend of uses",
+			Arguments:   usage.Arguments,
+			Examples:    []string{"stats", "stats 7"},
+			Category:    statisticsCategory,
+			Permissions: handler.AdminPermissionRule,
+			GuildOnly:   true,
+			Handler:     b.usage.ShowStats,
+		},
+	}
+
+	for _, command := range commands {
+		if err := b.handler.RegisterCommand(command); err != nil {
+			logger.LogError(err)
+		}
+	}
+
+	for oldName, name := range renamedCommands {
+		if err := b.handler.RegisterAlias(oldName, name); err != nil {
+			logger.LogError(err)
+		}
+	}
+}
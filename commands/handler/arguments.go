@@ -0,0 +1,259 @@
+package handler
+
+import (
+	"errors"
+	ct "github.com/generalkenobi/makrochatbot/customtypes"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// userMentionRegex matches user mentions (<@id> and <@!id>) and raw user IDs, the ID is the first group
+var userMentionRegex = regexp.MustCompile(`^(?:<@!?(\d+)>|(\d+))$`)
+
+// validateArgumentSpecs makes sure that the argument declarations of a command make sense - only the last arguments may be
+// optional, only the last argument may be variadic, enums have choices and names are unique
+func validateArgumentSpecs(specs []ct.ArgumentSpec) error {
+
+	names := make(map[string]struct{})
+	optionalFound := false
+
+	for i, spec := range specs {
+
+		if spec.Name == "" {
+			return errors.New("argument " + strconv.Itoa(i+1) + " has no name")
+		}
+
+		if _, ok := names[spec.Name]; ok {
+			return errors.New("argument name \"" + spec.Name + "\" is used more than once")
+		}
+		names[spec.Name] = struct{}{}
+
+		if spec.Variadic && i != len(specs)-1 {
+			return errors.New("only the last argument can be variadic, \"" + spec.Name + "\" is not the last one")
+		}
+
+		if optionalFound && !spec.Optional {
+			return errors.New("required argument \"" + spec.Name + "\" can't follow an optional one")
+		}
+		optionalFound = optionalFound || spec.Optional
+
+		if spec.Type == ct.EnumArgument && len(spec.Choices) == 0 {
+			return errors.New("enum argument \"" + spec.Name + "\" has no choices")
+		}
+	}
+
+	return nil
+}
+
+// parseArguments validates the values typed by the user against the argument declarations and converts them to their types.
+// Returns a map of argument name to parsed value (see ct.CommandArgs.ParsedArgs).
+// If the values don't match the declarations an error describing the problem in a user-friendly way is returned.
+func parseArguments(specs []ct.ArgumentSpec, values []string) (map[string]interface{}, error) {
+
+	parsed := make(map[string]interface{})
+
+	for i, spec := range specs {
+
+		// Check if the user provided a value for this argument
+		if i >= len(values) {
+			if spec.Optional {
+				// All remaining arguments are optional as well
+				break
+			}
+
+			return nil, errors.New("Missing argument `" + spec.Name + "`.")
+		}
+
+		// Variadic argument takes all remaining values
+		if spec.Variadic {
+
+			var parsedValues []interface{}
+
+			for _, value := range values[i:] {
+				parsedValue, err := parseArgument(spec, value)
+
+				if err != nil {
+					return nil, err
+				}
+
+				parsedValues = append(parsedValues, parsedValue)
+			}
+
+			parsed[spec.Name] = parsedValues
+			return parsed, nil
+		}
+
+		// Otherwise parse the single value
+		parsedValue, err := parseArgument(spec, values[i])
+
+		if err != nil {
+			return nil, err
+		}
+
+		parsed[spec.Name] = parsedValue
+	}
+
+	// There can't be more values than arguments (variadic arguments returned earlier)
+	if len(values) > len(specs) {
+		return nil, errors.New("Too many arguments, expected at most " + strconv.Itoa(len(specs)) + ".")
+	}
+
+	return parsed, nil
+}
+
+// parseArgument converts a single value to the type of the argument and checks its constraints
+func parseArgument(spec ct.ArgumentSpec, value string) (interface{}, error) {
+
+	switch spec.Type {
+
+	case ct.IntArgument:
+		{
+			number, err := strconv.Atoi(value)
+
+			// Check both the format and the range
+			if err != nil || !inRange(spec, number) {
+				return nil, errors.New("Argument `" + spec.Name + "` must be " + describeArgumentType(spec) + ", got `" + value + "`.")
+			}
+
+			return number, nil
+		}
+
+	case ct.EnumArgument:
+		{
+			// Choices are case insensitive, return the choice as it was declared
+			for _, choice := range spec.Choices {
+				if strings.EqualFold(choice, value) {
+					return choice, nil
+				}
+			}
+
+			return nil, errors.New("Argument `" + spec.Name + "` must be " + describeArgumentType(spec) + ", got `" + value + "`.")
+		}
+
+	case ct.UserArgument:
+		{
+			match := userMentionRegex.FindStringSubmatch(value)
+
+			if match == nil {
+				return nil, errors.New("Argument `" + spec.Name + "` must be " + describeArgumentType(spec) + ", got `" + value + "`.")
+			}
+
+			// ID is in the first group for mentions and in the second one for raw IDs
+			return match[1] + match[2], nil
+		}
+
+	case ct.DurationArgument:
+		{
+			duration, err := time.ParseDuration(value)
+
+			if err != nil || duration <= 0 {
+				return nil, errors.New("Argument `" + spec.Name + "` must be " + describeArgumentType(spec) + ", got `" + value + "`.")
+			}
+
+			return duration, nil
+		}
+
+	default:
+		{
+			return value, nil
+		}
+	}
+}
+
+// inRange returns true if number satisfies the bounds of the int argument
+func inRange(spec ct.ArgumentSpec, number int) bool {
+
+	// Bounds are not checked if neither of them is set
+	if spec.Min == 0 && spec.Max == 0 {
+		return true
+	}
+
+	return number >= spec.Min && (spec.Max == 0 || number <= spec.Max)
+}
+
+// describeArgumentType returns a user-friendly description of values accepted by the argument, e.g. "a whole number from 1 to 10"
+func describeArgumentType(spec ct.ArgumentSpec) string {
+
+	switch spec.Type {
+
+	case ct.IntArgument:
+		{
+			description := "a whole number"
+
+			if spec.Min != 0 || spec.Max != 0 {
+				if spec.Max == 0 {
+					description += " not smaller than " + strconv.Itoa(spec.Min)
+				} else {
+					description += " from " + strconv.Itoa(spec.Min) + " to " + strconv.Itoa(spec.Max)
+				}
+			}
+
+			return description
+		}
+
+	case ct.EnumArgument:
+		{
+			return "one of: " + strings.Join(spec.Choices, ", ")
+		}
+
+	case ct.UserArgument:
+		{
+			return "a user mention"
+		}
+
+	case ct.DurationArgument:
+		{
+			return "a duration such as 90s, 15m or 1h30m"
+		}
+
+	default:
+		{
+			return "text"
+		}
+	}
+}
+
+// generateUsage creates a usage string from argument declarations, e.g. "<name> <platform> [count]".
+// Required arguments are in angle brackets, optional ones in square brackets and variadic ones end with an ellipsis.
+func generateUsage(specs []ct.ArgumentSpec) string {
+
+	parts := make([]string, len(specs))
+
+	for i, spec := range specs {
+
+		part := spec.Name
+		if spec.Variadic {
+			part += "..."
+		}
+
+		if spec.Optional {
+			parts[i] = "[" + part + "]"
+		} else {
+			parts[i] = "<" + part + ">"
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// usage returns the usage string of the command - the declared one or, if it's empty, the one generated from arguments.
+// Groups without a handler can only be used with a subcommand.
+func usage(command *ct.Command) string {
+
+	if command.Usage != "" {
+		return command.Usage
+	}
+
+	if command.Handler == nil && len(command.Subcommands) > 0 {
+		return "<subcommand>"
+	}
+
+	return generateUsage(command.Arguments)
+}
+
+// usageLine returns the full invocation of the command as it should be typed by the user in the guild - prefix, name and usage
+func (h *Handler) usageLine(command *ct.Command, guildID string) string {
+	return strings.TrimSpace(h.prefixFor(guildID) + command.Name + " " + usage(command))
+}
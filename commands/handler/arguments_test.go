@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	ct "github.com/generalkenobi/makrochatbot/customtypes"
+)
+
+func TestParseArguments(t *testing.T) {
+
+	count := ct.ArgumentSpec{Name: "count", Type: ct.IntArgument, Min: 1, Max: 10}
+	platform := ct.ArgumentSpec{Name: "platform", Type: ct.EnumArgument, Choices: []string{"rau2", "rau3"}}
+	user := ct.ArgumentSpec{Name: "user", Type: ct.UserArgument}
+	period := ct.ArgumentSpec{Name: "period", Type: ct.DurationArgument, Optional: true}
+	names := ct.ArgumentSpec{Name: "names", Variadic: true}
+
+	tests := []struct {
+		name   string
+		specs  []ct.ArgumentSpec
+		values []string
+		parsed map[string]interface{}
+		err    string
+	}{
+		{
+			name:   "int in range",
+			specs:  []ct.ArgumentSpec{count},
+			values: []string{"10"},
+			parsed: map[string]interface{}{"count": 10},
+		},
+		{
+			name:   "int out of range",
+			specs:  []ct.ArgumentSpec{count},
+			values: []string{"11"},
+			err:    "Argument `count` must be a whole number from 1 to 10, got `11`.",
+		},
+		{
+			name:   "int not a number",
+			specs:  []ct.ArgumentSpec{count},
+			values: []string{"ten"},
+			err:    "Argument `count` must be a whole number from 1 to 10, got `ten`.",
+		},
+		{
+			name:   "enum case insensitive",
+			specs:  []ct.ArgumentSpec{platform},
+			values: []string{"RAU2"},
+			parsed: map[string]interface{}{"platform": "rau2"},
+		},
+		{
+			name:   "enum unknown choice",
+			specs:  []ct.ArgumentSpec{platform},
+			values: []string{"rau4"},
+			err:    "must be one of: rau2, rau3",
+		},
+		{
+			name:   "user mention",
+			specs:  []ct.ArgumentSpec{user},
+			values: []string{"<@!123>"},
+			parsed: map[string]interface{}{"user": "123"},
+		},
+		{
+			name:   "user raw ID",
+			specs:  []ct.ArgumentSpec{user},
+			values: []string{"123"},
+			parsed: map[string]interface{}{"user": "123"},
+		},
+		{
+			name:   "user not a mention",
+			specs:  []ct.ArgumentSpec{user},
+			values: []string{"@Kowalski"},
+			err:    "must be a user mention",
+		},
+		{
+			name:   "optional given",
+			specs:  []ct.ArgumentSpec{user, period},
+			values: []string{"123", "1h30m"},
+			parsed: map[string]interface{}{"user": "123", "period": 90 * time.Minute},
+		},
+		{
+			name:   "optional missing",
+			specs:  []ct.ArgumentSpec{user, period},
+			values: []string{"123"},
+			parsed: map[string]interface{}{"user": "123"},
+		},
+		{
+			name:   "duration not positive",
+			specs:  []ct.ArgumentSpec{period},
+			values: []string{"-5m"},
+			err:    "must be a duration",
+		},
+		{
+			name:   "required missing",
+			specs:  []ct.ArgumentSpec{user, period},
+			values: nil,
+			err:    "Missing argument `user`.",
+		},
+		{
+			name:   "too many",
+			specs:  []ct.ArgumentSpec{count},
+			values: []string{"1", "2"},
+			err:    "Too many arguments, expected at most 1.",
+		},
+		{
+			name:   "variadic",
+			specs:  []ct.ArgumentSpec{platform, names},
+			values: []string{"rau3", "Jan", "Anna"},
+			parsed: map[string]interface{}{"platform": "rau3", "names": []interface{}{"Jan", "Anna"}},
+		},
+		{
+			name:   "no declarations",
+			specs:  []ct.ArgumentSpec{},
+			values: nil,
+			parsed: map[string]interface{}{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			parsed, err := parseArguments(test.specs, test.values)
+
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("parseArguments(%q) error = %v, expected %q", test.values, err, test.err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("parseArguments(%q) returned error %v", test.values, err)
+			}
+
+			if !reflect.DeepEqual(parsed, test.parsed) {
+				t.Errorf("parseArguments(%q) = %v, expected %v", test.values, parsed, test.parsed)
+			}
+		})
+	}
+}
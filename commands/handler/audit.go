@@ -0,0 +1,245 @@
+package handler
+
+import (
+	"errors"
+	dg "github.com/bwmarrin/discordgo"
+	"github.com/generalkenobi/makrochatbot/audit"
+	ct "github.com/generalkenobi/makrochatbot/customtypes"
+	"github.com/generalkenobi/makrochatbot/logger"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits of the output of the audit commands
+const (
+	// auditQueryLimit is the maximum number of entries listed by the audit commands
+	auditQueryLimit = 50
+
+	// auditPageLength is the maximum number of characters on one page of the listed entries
+	auditPageLength = 1500
+)
+
+// auditTimeFormat is the format of the times of the listed entries, they are shown in UTC
+const auditTimeFormat = "2006-01-02 15:04:05"
+
+// AuditMiddleware records every invocation of the command in the audit log - where and by whom it was invoked, with which
+// arguments, how it ended and how long it took. It should be the outermost middleware, so that invocations denied or limited by
+// other middlewares are recorded too. Panics are recorded and passed on. Invocations rejected before the middlewares are
+// recorded by auditRejection.
+func (h *Handler) AuditMiddleware(command *ct.Command, next ct.CommandHandler) ct.CommandHandler {
+
+	return func(args *ct.CommandArgs) (output *ct.Response, err error) {
+
+		start := time.Now()
+		panicked := true
+
+		// Deferred, so that the invocation is recorded even if the command panics
+		defer func() {
+
+			entry := audit.Entry{
+				Time:      start,
+				GuildID:   args.GuildID,
+				ChannelID: args.ChannelID,
+				UserID:    args.UserID,
+				Username:  args.Username,
+				Command:   command.Name,
+				Args:      args.UserArgs,
+				Outcome:   audit.OutcomeSuccess,
+				Latency:   time.Since(start).Milliseconds(),
+			}
+
+			switch {
+
+			case panicked:
+				{
+					entry.Outcome = audit.OutcomePanic
+				}
+
+			case err != nil:
+				{
+					entry.Outcome, entry.ErrorClass = audit.OutcomeError, errorClass(err)
+				}
+			}
+
+			if auditErr := h.auditLog.Append(entry); auditErr != nil {
+				logger.LogError(auditErr)
+			}
+		}()
+
+		output, err = next(args)
+		panicked = false
+
+		return output, err
+	}
+}
+
+// auditRejection records an invocation of the command that was rejected before it reached the middlewares - e.g. because of
+// wrong arguments or because the command is disabled in the channel. args has to hold at least the place, the user and the
+// arguments of the invocation.
+func (h *Handler) auditRejection(command *ct.Command, args *ct.CommandArgs, errorClass string) {
+
+	entry := audit.Entry{
+		Time:       time.Now(),
+		GuildID:    args.GuildID,
+		ChannelID:  args.ChannelID,
+		UserID:     args.UserID,
+		Username:   args.Username,
+		Command:    command.Name,
+		Args:       args.UserArgs,
+		Outcome:    audit.OutcomeError,
+		ErrorClass: errorClass,
+	}
+
+	if err := h.auditLog.Append(entry); err != nil {
+		logger.LogError(err)
+	}
+}
+
+// errorClass returns the class of the error recorded in the audit log, the classes are the ones distinguished by reportError
+func errorClass(err error) string {
+
+	var userError *ct.UserError
+	var permissionError *ct.PermissionError
+	var silentError *ct.SilentError
+
+	switch {
+
+	case errors.As(err, &silentError):
+		{
+			return audit.ErrorClassSilent
+		}
+
+	case errors.As(err, &userError):
+		{
+			return audit.ErrorClassUser
+		}
+
+	case errors.As(err, &permissionError):
+		{
+			return audit.ErrorClassPermission
+		}
+
+	default:
+		{
+			return audit.ErrorClassInternal
+		}
+	}
+}
+
+// auditCommands returns the built-in commands for querying the audit log. Only entries of the guild in which they are used are
+// listed, so admins of one guild can't see what happens in another.
+func (h *Handler) auditCommands() []ct.Command {
+	return []ct.Command{
+		{
+			Name:        "audit",
+			Description: "Lists recent uses of commands on this server",
+			Category:    AdministrationCategory,
+			GuildOnly:   true,
+			Subcommands: []ct.Command{
+				{
+					Name:              "recent",
+					Description:       "Lists the most recent uses of all commands",
+					Permissions:       AdminPermissionRule,
+					EphemeralResponse: true,
+					Handler:           h.auditRecent,
+				},
+				{
+					Name:        "user",
+					Description: "Lists the most recent uses of commands by a user",
+					Arguments: []ct.ArgumentSpec{
+						{Name: "user", Description: "User whose uses should be listed", Type: ct.UserArgument},
+					},
+					Examples:          []string{"audit user @Kowalski"},
+					Permissions:       AdminPermissionRule,
+					EphemeralResponse: true,
+					Handler:           h.auditUser,
+				},
+				{
+					Name:        "command",
+					Description: "Lists the most recent uses of a command, uses of a group include its subcommands",
+					Arguments: []ct.ArgumentSpec{
+						{Name: "command", Description: "Command to list, with subcommand if needed", Variadic: true},
+					},
+					Examples:          []string{"audit command roll", "audit command monitor add"},
+					Permissions:       AdminPermissionRule,
+					EphemeralResponse: true,
+					Handler:           h.auditCommand,
+				},
+			},
+		},
+	}
+}
+
+// auditRecent is the handler of the audit recent command. It lists the most recent entries of the guild.
+func (h *Handler) auditRecent(args *ct.CommandArgs) (*ct.Response, error) {
+	return h.auditEntries(args, audit.Query{}, "Most recent uses of commands")
+}
+
+// auditUser is the handler of the audit user command. It lists the most recent entries of the user in the guild.
+// User arguments:
+// 1 - user, a mention or an ID
+func (h *Handler) auditUser(args *ct.CommandArgs) (*ct.Response, error) {
+
+	userID := args.String("user")
+	return h.auditEntries(args, audit.Query{UserID: userID}, "Most recent uses of commands by <@"+userID+">")
+}
+
+// auditCommand is the handler of the audit command command. It lists the most recent entries of the command in the guild.
+// User arguments:
+// 1... - name or alias of the command, followed by names of subcommands
+func (h *Handler) auditCommand(args *ct.CommandArgs) (*ct.Response, error) {
+
+	names := args.Strings("command")
+
+	// Aliases are resolved, the log contains main names only
+	command, used, ok := h.findCommand(names)
+	if !ok || used != len(names) {
+		return nil, ct.NewUserError("Unknown command `" + strings.Join(names, " ") + "`.")
+	}
+
+	return h.auditEntries(args, audit.Query{Command: command.Name}, "Most recent uses of `"+h.prefixFor(args.GuildID)+command.Name+"`")
+}
+
+// auditEntries finds the most recent entries of the guild selected by the query and lists them under the title. The list is
+// shown only to the user who asked for it.
+func (h *Handler) auditEntries(args *ct.CommandArgs, query audit.Query, title string) (*ct.Response, error) {
+
+	// The commands are guild-only, entries are always limited to the guild
+	query.GuildID, query.Limit = args.GuildID, auditQueryLimit
+
+	entries, err := h.auditLog.Find(query)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(entries) == 0 {
+		return ct.NewResponse().Ephemeral(&dg.MessageSend{Content: "No uses found."}), nil
+	}
+
+	lines := make([]string, len(entries))
+	for i, entry := range entries {
+		lines[i] = describeAuditEntry(entry)
+	}
+
+	header := title + " (times in UTC, newest first):"
+	return ct.NewResponse().Paginate(ct.EphemeralTarget, ct.ContentPages(header, lines, auditPageLength)), nil
+}
+
+// describeAuditEntry creates a line describing the entry, e.g.
+// "`2024-05-01 18:04:12` <@123> `monitor add Kowalski rau2` in <#456> - error (user), 12 ms"
+func describeAuditEntry(entry audit.Entry) string {
+
+	invocation := strings.Join(append([]string{entry.Command}, entry.Args...), " ")
+
+	// Backticks in arguments would break the formatting
+	invocation = strings.ReplaceAll(invocation, "`", "'")
+
+	outcome := entry.Outcome
+	if entry.ErrorClass != "" {
+		outcome += " (" + entry.ErrorClass + ")"
+	}
+
+	return "`" + entry.Time.UTC().Format(auditTimeFormat) + "` <@" + entry.UserID + "> `" + invocation + "` in <#" + entry.ChannelID +
+		"> - " + outcome + ", " + strconv.FormatInt(entry.Latency, 10) + " ms"
+}
@@ -0,0 +1,271 @@
+package handler
+
+import (
+	dg "github.com/bwmarrin/discordgo"
+	ct "github.com/generalkenobi/makrochatbot/customtypes"
+	"github.com/generalkenobi/makrochatbot/storage"
+	"regexp"
+	"strings"
+)
+
+// Scopes in which commands can be enabled or disabled, besides channel mentions
+const (
+	// serverScope is the whole guild
+	serverScope = "server"
+
+	// hereScope is the channel in which the command was invoked
+	hereScope = "here"
+)
+
+// channelMentionRegex matches channel mentions (<#id>), the ID is the first group
+var channelMentionRegex = regexp.MustCompile(`^<#(\d+)>$`)
+
+// commandListPageLength is the maximum number of characters on one page of the list of commands and their status
+const commandListPageLength = 1500
+
+// alwaysEnabledCommands are the commands that can't be disabled, so that admins can't lock themselves out
+var alwaysEnabledCommands = map[string]struct{}{
+	"enable":  {},
+	"disable": {},
+}
+
+// commandAvailability describes whether a command can be used in a channel
+type commandAvailability struct {
+
+	// enabled is true if the command can be used
+	enabled bool
+
+	// reason explains where the status comes from, e.g. "disabled on this server", empty if nothing was configured
+	reason string
+}
+
+// availabilityCommands returns the built-in commands for enabling, disabling and listing commands
+func (h *Handler) availabilityCommands() []ct.Command {
+
+	// Both enable and disable take the same arguments
+	arguments := []ct.ArgumentSpec{
+		{Name: "where", Description: "`server`, `here` (this channel) or a channel mention"},
+		{Name: "command", Description: "Command to change, with subcommand if needed", Variadic: true},
+	}
+
+	return []ct.Command{
+		{
+			Name:        "commands",
+			Description: "Lists all commands and whether they can be used in this channel",
+			Category:    GeneralCategory,
+			Handler:     h.listCommands,
+		},
+		{
+			Name:        "enable",
+			Description: "Enables a command on this server or in a channel",
+			Arguments:   arguments,
+			Examples:    []string{"enable server group1", "enable here monitor add"},
+			Category:    AdministrationCategory,
+			Permissions: AdminPermissionRule,
+			GuildOnly:   true,
+			Handler:     h.enableCommand,
+		},
+		{
+			Name:        "disable",
+			Description: "Disables a command on this server or in a channel",
+			Arguments:   arguments,
+			Examples:    []string{"disable here group1", "disable server monitor"},
+			Category:    AdministrationCategory,
+			Permissions: AdminPermissionRule,
+			GuildOnly:   true,
+			Handler:     h.disableCommand,
+		},
+	}
+}
+
+// availability returns whether the command can be used in the channel of the guild. Settings of the command take precedence over
+// settings of its group and settings of a channel take precedence over settings of the guild.
+func (h *Handler) availability(command *ct.Command, guildID, channelID string) commandAvailability {
+
+	// Commands can't be disabled in direct messages
+	if guildID == "" {
+		return commandAvailability{enabled: true}
+	}
+
+	settings := h.store.Guild(guildID)
+
+	for _, name := range commandPath(strings.ToLower(command.Name)) {
+
+		if enabled, ok := settings.ChannelCommands[channelID][name]; ok {
+
+			if enabled {
+				return commandAvailability{enabled: true, reason: "enabled in this channel"}
+			}
+
+			return commandAvailability{enabled: false, reason: "disabled in this channel"}
+		}
+
+		for _, disabled := range settings.DisabledCommands {
+			if disabled == name {
+				return commandAvailability{enabled: false, reason: "disabled on this server"}
+			}
+		}
+	}
+
+	return commandAvailability{enabled: true}
+}
+
+// enableCommand is the handler of the enable command.
+// User arguments:
+// 1 - where, "server", "here" or a channel mention
+// 2... - name of the command, followed by names of subcommands
+func (h *Handler) enableCommand(args *ct.CommandArgs) (*ct.Response, error) {
+	return h.setCommandEnabled(args, true)
+}
+
+// disableCommand is the handler of the disable command, it takes the same arguments as enableCommand
+func (h *Handler) disableCommand(args *ct.CommandArgs) (*ct.Response, error) {
+	return h.setCommandEnabled(args, false)
+}
+
+// setCommandEnabled enables or disables the command given in the arguments and saves the change.
+// Changing a command on the server removes its settings in channels, so that it's enabled or disabled everywhere.
+func (h *Handler) setCommandEnabled(args *ct.CommandArgs, enabled bool) (*ct.Response, error) {
+
+	names := args.Strings("command")
+	prefix := h.prefixFor(args.GuildID)
+
+	command, used, ok := h.findCommand(names)
+	if !ok || used != len(names) {
+		return nil, ct.NewUserError("Unknown command `" + strings.Join(names, " ") + "`. Use `" + prefix + "commands` to see all commands.")
+	}
+
+	name := strings.ToLower(command.Name)
+
+	if _, ok := alwaysEnabledCommands[name]; ok {
+		return nil, ct.NewUserError("`" + prefix + command.Name + "` can't be enabled or disabled.")
+	}
+
+	// Find out which channel should be changed, empty for the whole server
+	channelID, place := "", "on this server"
+
+	switch where := args.String("where"); {
+
+	case strings.EqualFold(where, serverScope):
+		{
+		}
+
+	case strings.EqualFold(where, hereScope):
+		{
+			channelID, place = args.ChannelID, "in this channel"
+		}
+
+	case channelMentionRegex.MatchString(where):
+		{
+			channelID, place = channelMentionRegex.FindStringSubmatch(where)[1], "in "+where
+		}
+
+	default:
+		{
+			return nil, ct.NewUserError("Argument `where` must be `" + serverScope + "`, `" + hereScope + "` or a channel mention, got `" +
+				where + "`.")
+		}
+	}
+
+	update := func(settings *storage.GuildSettings) {
+
+		if channelID == "" {
+			setGuildCommandEnabled(settings, name, enabled)
+		} else {
+			setChannelCommandEnabled(settings, channelID, name, enabled)
+		}
+	}
+
+	if err := h.store.UpdateGuild(args.GuildID, update); err != nil {
+		return nil, err
+	}
+
+	state := "disabled"
+	if enabled {
+		state = "enabled"
+	}
+
+	return ct.MessageResponse(&dg.MessageSend{Content: "`" + prefix + command.Name + "` is now " + state + " " + place + "."}), nil
+}
+
+// setGuildCommandEnabled enables or disables the command in the whole guild, removing its settings in channels
+func setGuildCommandEnabled(settings *storage.GuildSettings, name string, enabled bool) {
+
+	disabled := settings.DisabledCommands[:0]
+	for _, disabledName := range settings.DisabledCommands {
+		if disabledName != name {
+			disabled = append(disabled, disabledName)
+		}
+	}
+
+	if !enabled {
+		disabled = append(disabled, name)
+	}
+
+	settings.DisabledCommands = disabled
+
+	for channelID, commands := range settings.ChannelCommands {
+
+		delete(commands, name)
+
+		if len(commands) == 0 {
+			delete(settings.ChannelCommands, channelID)
+		}
+	}
+}
+
+// setChannelCommandEnabled enables or disables the command in the channel, regardless of its settings in the guild
+func setChannelCommandEnabled(settings *storage.GuildSettings, channelID, name string, enabled bool) {
+
+	if settings.ChannelCommands == nil {
+		settings.ChannelCommands = make(map[string]map[string]bool)
+	}
+
+	if settings.ChannelCommands[channelID] == nil {
+		settings.ChannelCommands[channelID] = make(map[string]bool)
+	}
+
+	settings.ChannelCommands[channelID][name] = enabled
+}
+
+// listCommands is the handler of the commands command. It lists all commands, including subcommands, with their status in the
+// channel.
+func (h *Handler) listCommands(args *ct.CommandArgs) (*ct.Response, error) {
+
+	var lines []string
+
+	// Add a line for each command, subcommands follow their groups
+	var addLines func(command *ct.Command)
+	addLines = func(command *ct.Command) {
+
+		availability := h.availability(command, args.GuildID, args.ChannelID)
+
+		line := "`" + h.prefixFor(args.GuildID) + command.Name + "` - "
+		if availability.enabled {
+			line += "enabled"
+		} else {
+			line += "**disabled**"
+		}
+
+		if availability.reason != "" {
+			line += " (" + availability.reason + ")"
+		}
+
+		lines = append(lines, line)
+
+		for i := range command.Subcommands {
+			addLines(&command.Subcommands[i])
+		}
+	}
+
+	for _, command := range h.getCommands() {
+		addLines(command)
+	}
+
+	embed := &dg.MessageEmbed{
+		Title: "Commands in this channel",
+		Color: helpEmbedColor,
+	}
+
+	return ct.NewResponse().Paginate(ct.ChannelTarget, ct.EmbedLinePages(embed, lines, commandListPageLength)), nil
+}
@@ -0,0 +1,225 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+
+	ct "github.com/generalkenobi/makrochatbot/customtypes"
+	"github.com/generalkenobi/makrochatbot/storage"
+)
+
+func TestAvailability(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		settings storage.GuildSettings
+		command  string
+		guildID  string
+		expected commandAvailability
+	}{
+		{
+			name:     "nothing configured",
+			command:  "roll",
+			guildID:  "guild",
+			expected: commandAvailability{enabled: true},
+		},
+		{
+			name:     "disabled on the server",
+			settings: storage.GuildSettings{DisabledCommands: []string{"roll"}},
+			command:  "roll",
+			guildID:  "guild",
+			expected: commandAvailability{enabled: false, reason: "disabled on this server"},
+		},
+		{
+			name:     "name in other case",
+			settings: storage.GuildSettings{DisabledCommands: []string{"roll"}},
+			command:  "Roll",
+			guildID:  "guild",
+			expected: commandAvailability{enabled: false, reason: "disabled on this server"},
+		},
+		{
+			name: "channel enables a command disabled on the server",
+			settings: storage.GuildSettings{
+				DisabledCommands: []string{"roll"},
+				ChannelCommands:  map[string]map[string]bool{"channel": {"roll": true}},
+			},
+			command:  "roll",
+			guildID:  "guild",
+			expected: commandAvailability{enabled: true, reason: "enabled in this channel"},
+		},
+		{
+			name:     "disabled in the channel",
+			settings: storage.GuildSettings{ChannelCommands: map[string]map[string]bool{"channel": {"roll": false}}},
+			command:  "roll",
+			guildID:  "guild",
+			expected: commandAvailability{enabled: false, reason: "disabled in this channel"},
+		},
+		{
+			name: "settings of another channel",
+			settings: storage.GuildSettings{
+				DisabledCommands: []string{"roll"},
+				ChannelCommands:  map[string]map[string]bool{"other channel": {"roll": true}},
+			},
+			command:  "roll",
+			guildID:  "guild",
+			expected: commandAvailability{enabled: false, reason: "disabled on this server"},
+		},
+		{
+			name:     "group disabled on the server",
+			settings: storage.GuildSettings{DisabledCommands: []string{"monitor"}},
+			command:  "monitor add",
+			guildID:  "guild",
+			expected: commandAvailability{enabled: false, reason: "disabled on this server"},
+		},
+		{
+			name: "subcommand enabled in the channel of a disabled group",
+			settings: storage.GuildSettings{
+				DisabledCommands: []string{"monitor"},
+				ChannelCommands:  map[string]map[string]bool{"channel": {"monitor add": true}},
+			},
+			command:  "monitor add",
+			guildID:  "guild",
+			expected: commandAvailability{enabled: true, reason: "enabled in this channel"},
+		},
+		{
+			name: "subcommand disabled on the server of a group enabled in the channel",
+			settings: storage.GuildSettings{
+				DisabledCommands: []string{"monitor add"},
+				ChannelCommands:  map[string]map[string]bool{"channel": {"monitor": true}},
+			},
+			command:  "monitor add",
+			guildID:  "guild",
+			expected: commandAvailability{enabled: false, reason: "disabled on this server"},
+		},
+		{
+			name: "other subcommand of the group",
+			settings: storage.GuildSettings{
+				DisabledCommands: []string{"monitor add"},
+				ChannelCommands:  map[string]map[string]bool{"channel": {"monitor": false}},
+			},
+			command:  "monitor list",
+			guildID:  "guild",
+			expected: commandAvailability{enabled: false, reason: "disabled in this channel"},
+		},
+		{
+			name:     "direct messages",
+			settings: storage.GuildSettings{DisabledCommands: []string{"roll"}},
+			command:  "roll",
+			guildID:  "",
+			expected: commandAvailability{enabled: true},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			store, err := storage.Open("")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Settings are stored for "guild", in direct messages nothing can be disabled
+			settings := test.settings
+			if err = store.UpdateGuild("guild", func(stored *storage.GuildSettings) { *stored = settings }); err != nil {
+				t.Fatal(err)
+			}
+
+			h := &Handler{store: store}
+
+			if availability := h.availability(&ct.Command{Name: test.command}, test.guildID, "channel"); availability != test.expected {
+				t.Errorf("availability(%q) = %+v, expected %+v", test.command, availability, test.expected)
+			}
+		})
+	}
+}
+
+func TestSetCommandEnabled(t *testing.T) {
+
+	// initial returns new settings for every test, the functions modify them in place
+	initial := func() storage.GuildSettings {
+		return storage.GuildSettings{
+			DisabledCommands: []string{"roll", "help"},
+			ChannelCommands: map[string]map[string]bool{
+				"channel 1": {"roll": true, "help": false},
+				"channel 2": {"roll": false},
+			},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		change   func(settings *storage.GuildSettings)
+		expected storage.GuildSettings
+	}{
+		{
+			name:   "enable on the server",
+			change: func(settings *storage.GuildSettings) { setGuildCommandEnabled(settings, "roll", true) },
+			expected: storage.GuildSettings{
+				DisabledCommands: []string{"help"},
+				ChannelCommands:  map[string]map[string]bool{"channel 1": {"help": false}},
+			},
+		},
+		{
+			name:   "disable on the server",
+			change: func(settings *storage.GuildSettings) { setGuildCommandEnabled(settings, "roll", false) },
+			expected: storage.GuildSettings{
+				DisabledCommands: []string{"help", "roll"},
+				ChannelCommands:  map[string]map[string]bool{"channel 1": {"help": false}},
+			},
+		},
+		{
+			name:   "disable another command on the server",
+			change: func(settings *storage.GuildSettings) { setGuildCommandEnabled(settings, "prefix", false) },
+			expected: storage.GuildSettings{
+				DisabledCommands: []string{"roll", "help", "prefix"},
+				ChannelCommands: map[string]map[string]bool{
+					"channel 1": {"roll": true, "help": false},
+					"channel 2": {"roll": false},
+				},
+			},
+		},
+		{
+			name:   "enable in a channel",
+			change: func(settings *storage.GuildSettings) { setChannelCommandEnabled(settings, "channel 2", "help", true) },
+			expected: storage.GuildSettings{
+				DisabledCommands: []string{"roll", "help"},
+				ChannelCommands: map[string]map[string]bool{
+					"channel 1": {"roll": true, "help": false},
+					"channel 2": {"roll": false, "help": true},
+				},
+			},
+		},
+		{
+			name:   "disable in a new channel",
+			change: func(settings *storage.GuildSettings) { setChannelCommandEnabled(settings, "channel 3", "roll", false) },
+			expected: storage.GuildSettings{
+				DisabledCommands: []string{"roll", "help"},
+				ChannelCommands: map[string]map[string]bool{
+					"channel 1": {"roll": true, "help": false},
+					"channel 2": {"roll": false},
+					"channel 3": {"roll": false},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			settings := initial()
+			test.change(&settings)
+
+			if !reflect.DeepEqual(settings, test.expected) {
+				t.Errorf("Settings = %+v, expected %+v", settings, test.expected)
+			}
+		})
+	}
+
+	// Guilds without settings get the maps created
+	var settings storage.GuildSettings
+	setChannelCommandEnabled(&settings, "channel", "roll", false)
+
+	if !reflect.DeepEqual(settings.ChannelCommands, map[string]map[string]bool{"channel": {"roll": false}}) {
+		t.Errorf("Channel settings = %v, expected roll disabled in the channel", settings.ChannelCommands)
+	}
+}
@@ -0,0 +1,286 @@
+package handler
+
+import (
+	"context"
+	dg "github.com/bwmarrin/discordgo"
+	ct "github.com/generalkenobi/makrochatbot/customtypes"
+	"sync"
+	"time"
+)
+
+// maxConversationDuration is the time after which the context of an interactive command expires (see ct.Command.Interactive)
+const maxConversationDuration = 15 * time.Minute
+
+// conversations keeps track of running interactive commands and of the answers they wait for. Answers are matched when messages
+// and reactions arrive, before messages are queued to be run as commands - the worker of the channel may be busy, and the answer
+// must not wait for it. It is safe for concurrent use.
+type conversations struct {
+
+	// running holds the users who have an interactive command running, key is channel ID and user ID separated by a slash
+	running map[string]struct{}
+
+	// messageWaiters are the channels waiting for the next message of a user, key is channel ID and user ID separated by a slash
+	messageWaiters map[string]chan *dg.Message
+
+	// reactionWaiters are the channels waiting for the next reaction of a user, key is message ID and user ID separated by a slash
+	reactionWaiters map[string]chan *dg.MessageReaction
+
+	// mutex is used to synchronize access to all maps
+	mutex sync.Mutex
+}
+
+// newConversations creates an empty registry of conversations
+func newConversations() *conversations {
+	return &conversations{
+		running:         make(map[string]struct{}),
+		messageWaiters:  make(map[string]chan *dg.Message),
+		reactionWaiters: make(map[string]chan *dg.MessageReaction),
+	}
+}
+
+// begin marks the user as having an interactive command running in the channel. Returns false if they already have one.
+func (c *conversations) begin(channelID, userID string) bool {
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	key := channelID + "/" + userID
+	if _, ok := c.running[key]; ok {
+		return false
+	}
+
+	c.running[key] = struct{}{}
+	return true
+}
+
+// end marks the interactive command of the user in the channel as finished
+func (c *conversations) end(channelID, userID string) {
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.running, channelID+"/"+userID)
+}
+
+// deliverMessage passes the message to the conversation waiting for it. Returns false if no conversation waits for it, then
+// the message should be handled as usual.
+func (c *conversations) deliverMessage(message *dg.Message) bool {
+
+	if message == nil || message.Author == nil || message.Author.Bot {
+		return false
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	key := message.ChannelID + "/" + message.Author.ID
+
+	waiter, ok := c.messageWaiters[key]
+	if !ok {
+		return false
+	}
+
+	// Each waiter takes one message, it's buffered so that this never blocks
+	delete(c.messageWaiters, key)
+	waiter <- message
+
+	return true
+}
+
+// deliverReaction passes the reaction to the conversation waiting for it. Returns false if no conversation waits for it.
+func (c *conversations) deliverReaction(reaction *dg.MessageReaction) bool {
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	key := reaction.MessageID + "/" + reaction.UserID
+
+	waiter, ok := c.reactionWaiters[key]
+	if !ok {
+		return false
+	}
+
+	delete(c.reactionWaiters, key)
+	waiter <- reaction
+
+	return true
+}
+
+// awaitMessage registers a waiter for the next message of the user in the channel and returns it, with a function that
+// unregisters the waiter if it's still registered
+func (c *conversations) awaitMessage(channelID, userID string) (chan *dg.Message, func()) {
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	key := channelID + "/" + userID
+	waiter := make(chan *dg.Message, 1)
+
+	c.messageWaiters[key] = waiter
+
+	return waiter, func() {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
+		if c.messageWaiters[key] == waiter {
+			delete(c.messageWaiters, key)
+		}
+	}
+}
+
+// awaitReaction registers a waiter for the next reaction of the user to the message, like awaitMessage
+func (c *conversations) awaitReaction(messageID, userID string) (chan *dg.MessageReaction, func()) {
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	key := messageID + "/" + userID
+	waiter := make(chan *dg.MessageReaction, 1)
+
+	c.reactionWaiters[key] = waiter
+
+	return waiter, func() {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
+		if c.reactionWaiters[key] == waiter {
+			delete(c.reactionWaiters, key)
+		}
+	}
+}
+
+// conversation is the ct.Conversation of one run of an interactive command
+type conversation struct {
+
+	// conversations is the registry in which the answers are awaited
+	conversations *conversations
+
+	// responder delivers the messages of the command
+	responder *responder
+
+	// userID and channelID tell whose answers are awaited and where
+	userID    string
+	channelID string
+
+	// context is the context of the command, waiting stops when it expires
+	context context.Context
+}
+
+// Send delivers the response to its targets
+func (c *conversation) Send(response *ct.Response) {
+	c.responder.deliver(response)
+}
+
+// Prompt sends the message to the channel of the command and returns it
+func (c *conversation) Prompt(message *dg.MessageSend) *dg.Message {
+	return c.responder.prompt(message)
+}
+
+// AwaitMessage waits for the next message of the user in the channel of the command
+func (c *conversation) AwaitMessage(timeout time.Duration) (*dg.Message, error) {
+	return c.awaitMessage(c.channelID, timeout)
+}
+
+// AwaitDirectMessage waits for the next direct message from the user
+func (c *conversation) AwaitDirectMessage(timeout time.Duration) (*dg.Message, error) {
+
+	channelID, err := c.responder.communicator.Transport().UserChannel(c.userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.awaitMessage(channelID, timeout)
+}
+
+// AwaitReaction waits for the next reaction of the user to the message
+func (c *conversation) AwaitReaction(messageID string, timeout time.Duration) (*dg.MessageReaction, error) {
+
+	waiter, cancel := c.conversations.awaitReaction(messageID, c.userID)
+	defer cancel()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+
+	case reaction := <-waiter:
+		{
+			return reaction, nil
+		}
+
+	case <-timer.C:
+	case <-c.context.Done():
+	}
+
+	// Don't lose a reaction delivered just as waiting stopped (see awaitMessage)
+	cancel()
+
+	select {
+
+	case reaction := <-waiter:
+		{
+			return reaction, nil
+		}
+
+	default:
+		{
+			return nil, ct.ErrConversationTimeout
+		}
+	}
+}
+
+// awaitMessage waits for the next message of the user in the channel
+func (c *conversation) awaitMessage(channelID string, timeout time.Duration) (*dg.Message, error) {
+
+	waiter, cancel := c.conversations.awaitMessage(channelID, c.userID)
+	defer cancel()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+
+	case message := <-waiter:
+		{
+			return message, nil
+		}
+
+	case <-timer.C:
+	case <-c.context.Done():
+	}
+
+	// The answer may have been delivered just as waiting stopped. Once the waiter is unregistered nothing more can be delivered
+	// to it, so whatever was delivered is in its buffer - it wasn't handled as a command and must not be lost.
+	cancel()
+
+	select {
+
+	case message := <-waiter:
+		{
+			return message, nil
+		}
+
+	default:
+		{
+			return nil, ct.ErrConversationTimeout
+		}
+	}
+}
+
+// isInteractive returns true if the input (a message without the prefix) invokes an interactive command.
+// Such commands are not run by workers (see ct.Command.Interactive).
+func (h *Handler) isInteractive(input string) bool {
+
+	tokens, err := tokenize(input)
+	if err != nil {
+		return false
+	}
+
+	words := make([]string, len(tokens))
+	for i, token := range tokens {
+		words[i] = token.value
+	}
+
+	command, _, ok := h.findCommand(words)
+	return ok && command.Interactive
+}
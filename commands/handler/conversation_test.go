@@ -0,0 +1,230 @@
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	dg "github.com/bwmarrin/discordgo"
+	ct "github.com/generalkenobi/makrochatbot/customtypes"
+)
+
+// answer creates a message of the user in the channel
+func answer(channelID, userID, content string) *dg.Message {
+	return &dg.Message{ChannelID: channelID, Content: content, Author: &dg.User{ID: userID}}
+}
+
+func TestConversationsBegin(t *testing.T) {
+
+	conversations := newConversations()
+
+	steps := []struct {
+		name      string
+		begin     bool
+		channelID string
+		userID    string
+		started   bool
+	}{
+		{name: "first", begin: true, channelID: "channel", userID: "user", started: true},
+		{name: "second in the channel", begin: true, channelID: "channel", userID: "user", started: false},
+		{name: "another channel", begin: true, channelID: "other channel", userID: "user", started: true},
+		{name: "another user", begin: true, channelID: "channel", userID: "other user", started: true},
+		{name: "end of the first", begin: false, channelID: "channel", userID: "user"},
+		{name: "after the first ended", begin: true, channelID: "channel", userID: "user", started: true},
+	}
+
+	for _, step := range steps {
+
+		if !step.begin {
+			conversations.end(step.channelID, step.userID)
+			continue
+		}
+
+		if started := conversations.begin(step.channelID, step.userID); started != step.started {
+			t.Errorf("begin of %s = %v, expected %v", step.name, started, step.started)
+		}
+	}
+}
+
+func TestConversationsDeliverMessage(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		message   *dg.Message
+		delivered bool
+	}{
+		{name: "answer", message: answer("channel", "user", "yes"), delivered: true},
+		{name: "another channel", message: answer("other channel", "user", "yes"), delivered: false},
+		{name: "another user", message: answer("channel", "other user", "yes"), delivered: false},
+		{name: "bot", message: &dg.Message{ChannelID: "channel", Author: &dg.User{ID: "user", Bot: true}}, delivered: false},
+		{name: "no author", message: &dg.Message{ChannelID: "channel"}, delivered: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			conversations := newConversations()
+			waiter, cancel := conversations.awaitMessage("channel", "user")
+			defer cancel()
+
+			if delivered := conversations.deliverMessage(test.message); delivered != test.delivered {
+				t.Fatalf("deliverMessage = %v, expected %v", delivered, test.delivered)
+			}
+
+			if !test.delivered {
+				return
+			}
+
+			if received := <-waiter; received != test.message {
+				t.Errorf("Waiter received %+v, expected %+v", received, test.message)
+			}
+
+			// Each waiter takes one message, the next one is a command again
+			if conversations.deliverMessage(answer("channel", "user", "again")) {
+				t.Error("Second message was delivered to the same waiter")
+			}
+		})
+	}
+}
+
+func TestConversationsCancel(t *testing.T) {
+
+	conversations := newConversations()
+
+	_, cancel := conversations.awaitMessage("channel", "user")
+	cancel()
+
+	if conversations.deliverMessage(answer("channel", "user", "yes")) {
+		t.Error("Message was delivered to a canceled waiter")
+	}
+
+	// Canceling an old waiter doesn't remove the one that replaced it
+	_, cancelOld := conversations.awaitMessage("channel", "user")
+	waiter, cancelNew := conversations.awaitMessage("channel", "user")
+	defer cancelNew()
+
+	cancelOld()
+
+	if !conversations.deliverMessage(answer("channel", "user", "yes")) {
+		t.Fatal("Message was not delivered to the new waiter")
+	}
+
+	if received := <-waiter; received.Content != "yes" {
+		t.Errorf("New waiter received %q, expected yes", received.Content)
+	}
+
+	// Reactions are awaited the same way, on a message
+	reactionWaiter, cancelReaction := conversations.awaitReaction("message", "user")
+
+	if conversations.deliverReaction(&dg.MessageReaction{MessageID: "other message", UserID: "user"}) {
+		t.Error("Reaction to another message was delivered")
+	}
+
+	if !conversations.deliverReaction(&dg.MessageReaction{MessageID: "message", UserID: "user"}) {
+		t.Fatal("Reaction was not delivered")
+	}
+
+	if received := <-reactionWaiter; received.MessageID != "message" {
+		t.Errorf("Waiter received a reaction to %s, expected message", received.MessageID)
+	}
+
+	cancelReaction()
+
+	if conversations.deliverReaction(&dg.MessageReaction{MessageID: "message", UserID: "user"}) {
+		t.Error("Reaction was delivered to a canceled waiter")
+	}
+}
+
+func TestConversationAwaitMessage(t *testing.T) {
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name    string
+		context context.Context
+		answer  bool
+		err     error
+	}{
+		{name: "answered", context: context.Background(), answer: true, err: nil},
+		{name: "timeout", context: context.Background(), answer: false, err: ct.ErrConversationTimeout},
+		{name: "context canceled", context: canceled, answer: false, err: ct.ErrConversationTimeout},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			conversations := newConversations()
+			conversation := &conversation{conversations: conversations, userID: "user", channelID: "channel", context: test.context}
+
+			// Answer as soon as the conversation waits
+			if test.answer {
+				go func() {
+					for !conversations.deliverMessage(answer("channel", "user", "yes")) {
+						time.Sleep(time.Millisecond)
+					}
+				}()
+			}
+
+			message, err := conversation.AwaitMessage(50 * time.Millisecond)
+
+			if err != test.err {
+				t.Fatalf("AwaitMessage error = %v, expected %v", err, test.err)
+			}
+
+			if test.answer && message.Content != "yes" {
+				t.Errorf("AwaitMessage = %q, expected yes", message.Content)
+			}
+
+			// The waiter is gone once waiting is over
+			if conversations.deliverMessage(answer("channel", "user", "late")) {
+				t.Error("Message after waiting was delivered")
+			}
+		})
+	}
+}
+
+// answeringContext is a canceled context that delivers an answer whenever it's asked whether it's done - the answer arrives
+// exactly when waiting for it stops
+type answeringContext struct {
+	context.Context
+	answer func()
+}
+
+// Done delivers the answer and returns the closed channel of the canceled context
+func (c answeringContext) Done() <-chan struct{} {
+	c.answer()
+	return c.Context.Done()
+}
+
+func TestConversationAwaitKeepsAnswersDeliveredAtTimeout(t *testing.T) {
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	conversations := newConversations()
+
+	// Both the answer and the end of waiting are ready, whichever is noticed first the answer must not be lost
+	for i := 0; i < 100; i++ {
+
+		conversation := &conversation{conversations: conversations, userID: "user", channelID: "channel", context: answeringContext{
+			Context: canceled,
+			answer:  func() { conversations.deliverMessage(answer("channel", "user", "yes")) },
+		}}
+
+		if message, err := conversation.AwaitMessage(time.Minute); err != nil || message.Content != "yes" {
+			t.Fatalf("Attempt %d: AwaitMessage returned %v, %v, expected the delivered message", i, message, err)
+		}
+
+		conversation.context = answeringContext{
+			Context: canceled,
+			answer: func() {
+				conversations.deliverReaction(&dg.MessageReaction{MessageID: "message", UserID: "user", Emoji: dg.Emoji{Name: "👍"}})
+			},
+		}
+
+		if reaction, err := conversation.AwaitReaction("message", time.Minute); err != nil || reaction.Emoji.Name != "👍" {
+			t.Fatalf("Attempt %d: AwaitReaction returned %v, %v, expected the delivered reaction", i, reaction, err)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	dg "github.com/bwmarrin/discordgo"
+	ct "github.com/generalkenobi/makrochatbot/customtypes"
+	"github.com/generalkenobi/makrochatbot/logger"
+)
+
+// correlationIDBytes is the number of random bytes in a correlation ID (it's twice as many hex characters)
+const correlationIDBytes = 4
+
+// reportError lets the user know that the command failed, the message is delivered with responder and is ephemeral where
+// possible.
+// What the user sees depends on the class of the error:
+//   - user errors (ct.UserError) are shown as they are,
+//   - permission errors (ct.PermissionError) are shown as a denial,
+//   - silent errors (ct.SilentError) are not shown at all,
+//   - all other errors are internal - they are logged with a correlation ID and the user gets only the ID, so that the problem
+//     can be found in the log when it's reported.
+func (h *Handler) reportError(guildID, commandName string, err error, responder *responder) {
+
+	var userError *ct.UserError
+	var permissionError *ct.PermissionError
+	var silentError *ct.SilentError
+
+	var content string
+
+	switch {
+
+	case errors.As(err, &silentError):
+		{
+			// Nothing to tell the user
+			return
+		}
+
+	case errors.As(err, &userError):
+		{
+			content = userError.Message
+		}
+
+	case errors.As(err, &permissionError):
+		{
+			content = "You don't have permission to do that."
+			if permissionError.Message != "" {
+				content += " " + permissionError.Message
+			}
+		}
+
+	default:
+		{
+			// Internal error - log it with an ID that is also shown to the user
+			correlationID := newCorrelationID()
+			logger.LogError(errors.New("[" + correlationID + "] Command \"" + commandName + "\" failed: " + err.Error()))
+
+			content = "Something went wrong while running `" + h.prefixFor(guildID) + commandName + "`. " +
+				"If the problem persists, report it and mention error ID `" + correlationID + "`."
+		}
+	}
+
+	responder.reply(&dg.MessageSend{Content: content, Flags: dg.MessageFlagsEphemeral})
+}
+
+// newCorrelationID creates a random identifier used to match an error shown to the user with an entry in the log
+func newCorrelationID() string {
+
+	bytes := make([]byte, correlationIDBytes)
+
+	// Reading random bytes practically never fails, but if it does an ID is still needed
+	if _, err := rand.Read(bytes); err != nil {
+		return "unknown"
+	}
+
+	return hex.EncodeToString(bytes)
+}
@@ -1,134 +1,815 @@
 package handler
 
 import (
+	"context"
 	"errors"
 	dg "github.com/bwmarrin/discordgo"
+	"github.com/generalkenobi/makrochatbot/audit"
 	"github.com/generalkenobi/makrochatbot/communication"
 	ct "github.com/generalkenobi/makrochatbot/customtypes"
 	"github.com/generalkenobi/makrochatbot/logger"
+	"github.com/generalkenobi/makrochatbot/ratelimit"
+	"github.com/generalkenobi/makrochatbot/storage"
 	"strings"
+	"sync"
+	"time"
 )
 
 // IllegalPrefix is the only prefix that cannot be used
 const IllegalPrefix = ""
 
-// registeredCommands contains all registered commands
-var registeredCommands = make(map[string]ct.CommandHandler)
+// Handler parses incoming messages and invokes registered commands.
+// Each handler has its own set of commands and its own prefix, so multiple handlers can work independently in one process.
+type Handler struct {
 
-// commandPrefix is the registered command prefix
-var commandPrefix string
+	// registeredCommands contains all registered commands and their subcommands. Key is the lowercase name or alias of the command,
+	// for subcommands preceded by the full name of the parent (see commandKeys).
+	registeredCommands map[string]*ct.Command
 
-// ParseCommand is a handler for incomming messages, it is hooked into Discord
-func ParseCommand(session *dg.Session, message *dg.MessageCreate) {
+	// middlewares are applied to every command, in order (the first one is the outermost)
+	middlewares []ct.Middleware
 
-	// Run the helper function
-	go parseCommand(message)
+	// orderedCommands contains all registered top level commands in order of registration (each command appears once, regardless
+	// of aliases)
+	orderedCommands []*ct.Command
+
+	// commandsMutex is used to synchronize access to registeredCommands, orderedCommands and middlewares
+	commandsMutex sync.RWMutex
+
+	// defaultPrefix is the command prefix used in guilds that didn't set their own
+	defaultPrefix string
+
+	// store holds settings of guilds, e.g. their prefixes
+	store *storage.Store
+
+	// communicator is used to send command output
+	communicator *communication.Communicator
+
+	// auditLog records invocations of commands, see AuditMiddleware
+	auditLog *audit.Log
+
+	// crashes counts panics caught while running commands, key is the command name
+	crashes map[string]int
+
+	// crashesMutex is used to synchronize access to crashes
+	crashesMutex sync.Mutex
+
+	// pool runs the commands, it's nil when the handler is not started
+	pool *workerPool
+
+	// poolMutex is used to synchronize access to pool
+	poolMutex sync.RWMutex
+
+	// detached counts the jobs run outside the workers (see runOutsidePool), Stop waits for them. Jobs are only started while
+	// poolMutex is held for reading.
+	detached sync.WaitGroup
+
+	// running is the context from which contexts of commands are derived, it's canceled by Stop so that interactive commands stop
+	// waiting for answers
+	running       context.Context
+	cancelRunning context.CancelFunc
+
+	// runningMutex is used to synchronize access to running and cancelRunning
+	runningMutex sync.Mutex
+
+	// workerCount and queueSize configure the pool created by Start
+	workerCount int
+	queueSize   int
+
+	// commandTimeout is the time after which the context of a running command expires
+	commandTimeout time.Duration
+
+	// lastDropNotice holds the time at which users in a channel were last told that their command was dropped, key is channel ID
+	lastDropNotice map[string]time.Time
+
+	// lastDropNoticeMutex is used to synchronize access to lastDropNotice
+	lastDropNoticeMutex sync.Mutex
+
+	// rateLimiter is used by RateLimitMiddleware
+	rateLimiter *rateLimiter
+
+	// suggestionLimiter limits how often commands are suggested in each channel, key is channel ID
+	suggestionLimiter *ratelimit.Limiter
+
+	// permissions are the configured permission rules, used by PermissionMiddleware
+	permissions map[string]map[string]ct.PermissionRule
+
+	// tracker remembers the responses to recent typed commands, so that edited commands can be run again and responses to
+	// deleted commands can be deleted
+	tracker *invocationTracker
+
+	// paginator switches pages of paginated responses
+	paginator *paginator
+
+	// conversations holds the running interactive commands and the answers they wait for
+	conversations *conversations
+}
+
+// dropNoticeInterval is the minimum time between two notices about dropped commands in one channel
+const dropNoticeInterval = 30 * time.Second
+
+// defaultCommandTimeout is the time after which the context of a running command expires, if the config doesn't specify it
+const defaultCommandTimeout = 30 * time.Second
+
+// New creates a handler that sends command output using communicator. Commands are recognized by the prefix set by the guild in
+// store or, if the guild didn't set one, the prefix from config. Invocations are recorded in auditLog by AuditMiddleware.
+// All prefixes are legal except for the IllegalPrefix "" (empty string) - if it's given then an error is returned.
+// Commands are not run until Start is called.
+func New(config ct.Config, communicator *communication.Communicator, store *storage.Store, auditLog *audit.Log) (*Handler, error) {
+
+	// Make sure the prefix is legal
+	if config.CommandPrefix == IllegalPrefix {
+		return nil, errors.New("Handler error: command prefix can't be empty")
+	}
+
+	// Use the default timeout if none was configured
+	commandTimeout := time.Duration(config.CommandTimeout) * time.Second
+	if commandTimeout <= 0 {
+		commandTimeout = defaultCommandTimeout
+	}
+
+	handler := &Handler{
+		registeredCommands: make(map[string]*ct.Command),
+		defaultPrefix:      config.CommandPrefix,
+		store:              store,
+		communicator:       communicator,
+		auditLog:           auditLog,
+		crashes:            make(map[string]int),
+		workerCount:        config.CommandWorkers,
+		queueSize:          config.CommandQueueSize,
+		commandTimeout:     commandTimeout,
+		lastDropNotice:     make(map[string]time.Time),
+		rateLimiter:        newRateLimiter(config.RateLimits),
+		suggestionLimiter:  ratelimit.New(suggestionLimitCount, suggestionLimitPeriod),
+		permissions:        config.Permissions,
+		tracker:            newInvocationTracker(),
+		paginator:          newPaginator(communicator),
+		conversations:      newConversations(),
+	}
+
+	handler.running, handler.cancelRunning = context.WithCancel(context.Background())
+
+	// Register the built-in commands
+	if err := handler.registerBuiltInCommands(); err != nil {
+		return nil, err
+	}
+
+	return handler, nil
+}
+
+// Start starts the workers that run commands. Starting a handler that is already started does nothing.
+func (h *Handler) Start() {
+
+	h.poolMutex.Lock()
+	defer h.poolMutex.Unlock()
+
+	if h.pool != nil {
+		return
+	}
+
+	h.pool = newWorkerPool(h.workerCount, h.queueSize, func(value interface{}) { h.handlePanic(value, "", "", nil) })
+
+	// Commands of the previous run were canceled by Stop
+	h.runningMutex.Lock()
+	defer h.runningMutex.Unlock()
+
+	if h.running.Err() != nil {
+		h.running, h.cancelRunning = context.WithCancel(context.Background())
+	}
+}
+
+// Stop stops the workers after they run all queued commands. Then it cancels the contexts of commands running outside the workers
+// (interactive commands, which may wait for answers for a long time) and waits until they finish. Messages received after Stop
+// are ignored, so nothing is running once it returns. Stopping a handler that is not started does nothing.
+func (h *Handler) Stop() {
+
+	h.poolMutex.Lock()
+	defer h.poolMutex.Unlock()
+
+	if h.pool == nil {
+		return
+	}
+
+	h.pool.stop()
+	h.pool = nil
+
+	h.runningMutex.Lock()
+	h.cancelRunning()
+	h.runningMutex.Unlock()
+
+	h.detached.Wait()
+}
+
+// runningContext returns the context from which contexts of commands are derived
+func (h *Handler) runningContext() context.Context {
+
+	h.runningMutex.Lock()
+	defer h.runningMutex.Unlock()
+
+	return h.running
+}
+
+// Stats returns metrics of the workers running commands. All values are zero if the handler is not started.
+func (h *Handler) Stats() PoolStats {
+
+	h.poolMutex.RLock()
+	defer h.poolMutex.RUnlock()
+
+	if h.pool == nil {
+		return PoolStats{}
+	}
+
+	return h.pool.stats()
+}
+
+// ParseCommand is a handler for incomming messages, it is hooked into the transport (see communication.Transport.OnMessage).
+// Messages that look like commands are queued to be run by workers. Commands from one channel are run in the order they were
+// received. If the queue is full the command is dropped and the users in the channel are told about it.
+// Messages awaited by interactive commands are passed to them instead (see ct.Conversation) and interactive commands are run
+// outside the workers.
+func (h *Handler) ParseCommand(message *dg.Message) {
+
+	h.poolMutex.RLock()
+	defer h.poolMutex.RUnlock()
+
+	// Ignore messages if the handler is not running
+	if h.pool == nil {
+		return
+	}
+
+	// Answers are passed before anything is queued, the command waiting for them may be holding up the worker of the channel
+	if h.conversations.deliverMessage(message) {
+		return
+	}
+
+	// Don't queue messages that are not commands
+	input, ok := h.commandInput(message)
+	if !ok {
+		return
+	}
+
+	// Interactive commands wait for answers, so they can't hold up other commands in the channel
+	if h.isInteractive(input) {
+		h.runOutsidePool(func() { h.parseCommand(message, nil) })
+		return
+	}
+
+	// Queue the helper function, commands from one channel go to the same worker
+	if !h.pool.submit(message.ChannelID, func() { h.parseCommand(message, nil) }) {
+		h.notifyDropped(message.ChannelID, input)
+	}
+}
+
+// HandleMessageEdit is a handler for edited messages, it is hooked into the transport (see communication.Transport.OnMessageEdit).
+// If the message is a recent command whose content changed, the command is run again and its previous responses are edited to
+// show the new output (responses that are no longer produced are deleted). Like new commands, edited ones are run by workers.
+func (h *Handler) HandleMessageEdit(message *dg.Message) {
+
+	// Edits without an author can't be commands, e.g. link previews added to a message
+	if message == nil || message.Author == nil {
+		return
+	}
+
+	h.poolMutex.RLock()
+	defer h.poolMutex.RUnlock()
+
+	// Ignore edits if the handler is not running
+	if h.pool == nil {
+		return
+	}
+
+	// Interactive commands are run outside the workers, like when they are received
+	if input, ok := h.commandInput(message); ok && h.isInteractive(input) {
+		h.runOutsidePool(func() { h.rerunCommand(message) })
+		return
+	}
+
+	// The command is run by the worker of its channel, after the previous run of the command finished
+	if !h.pool.submit(message.ChannelID, func() { h.rerunCommand(message) }) {
+		h.notifyDropped(message.ChannelID, message.Content)
+	}
+}
+
+// HandleMessageDelete is a handler for deleted messages, it is hooked into the transport (see
+// communication.Transport.OnMessageDelete). If the message is a recent command, the responses to it are deleted as well.
+func (h *Handler) HandleMessageDelete(message *dg.Message) {
+
+	if message == nil {
+		return
+	}
+
+	deleteResponses := func() {
+		if responses, ok := h.tracker.forget(message.ChannelID, message.ID); ok {
+			h.deleteMessages(responses)
+		}
+	}
+
+	h.poolMutex.RLock()
+	defer h.poolMutex.RUnlock()
+
+	// Ignore deletions if the handler is not running
+	if h.pool == nil {
+		return
+	}
+
+	// Responses are deleted by the worker of the channel, so that a command that is still queued doesn't respond after its message
+	// was deleted. If the queue is full, it's done in the background as nobody is waiting for it.
+	if !h.pool.submit(message.ChannelID, deleteResponses) {
+		h.runOutsidePool(deleteResponses)
+	}
+}
+
+// HandleReaction is a handler for added reactions, it is hooked into the transport (see communication.Transport.OnReactionAdd).
+// Reactions are answers in conversations (see ct.Conversation) or switch pages of paginated responses (see ct.Response.Paginate),
+// reactions of the bot itself are ignored.
+func (h *Handler) HandleReaction(reaction *dg.MessageReaction) {
+
+	if reaction == nil || reaction.UserID == h.communicator.Transport().BotUserID() {
+		return
+	}
+
+	// Reactions are handled outside the workers, a panic must not take the bot down
+	defer h.recoverDispatcher()
+
+	// Reactions awaited by interactive commands are only passed to them
+	if h.conversations.deliverReaction(reaction) {
+		return
+	}
+
+	h.paginator.handleReaction(reaction)
+}
+
+// HandleReactionRemove is a handler for removed reactions, it is hooked into the transport (see
+// communication.Transport.OnReactionRemove). Removed reactions switch pages of paginated responses in direct messages, where
+// the bot can't remove the reactions of users. They are not answers in conversations.
+func (h *Handler) HandleReactionRemove(reaction *dg.MessageReaction) {
+
+	if reaction == nil || reaction.UserID == h.communicator.Transport().BotUserID() {
+		return
+	}
+
+	// Removals are handled outside the workers, a panic must not take the bot down
+	defer h.recoverDispatcher()
+
+	h.paginator.handleReactionRemove(reaction)
+}
+
+// rerunCommand is a helper function to HandleMessageEdit. It runs the edited command again if its content changed.
+// Messages edited so that they are no longer commands lose their responses.
+func (h *Handler) rerunCommand(message *dg.Message) {
+
+	invocation, ok := h.tracker.get(message.ChannelID, message.ID)
+	if !ok || invocation.content == message.Content {
+		return
+	}
+
+	if _, ok := h.commandInput(message); !ok {
+		if responses, ok := h.tracker.forget(message.ChannelID, message.ID); ok {
+			h.deleteMessages(responses)
+		}
+
+		return
+	}
+
+	h.parseCommand(message, invocation.responses)
+}
+
+// trackResponses deletes the previous responses to the command that were not reused and remembers the current ones, so that they
+// can be edited or deleted together with the message of the command
+func (h *Handler) trackResponses(message *dg.Message, responder *responder) {
+
+	responder.deleteUnused()
+	h.tracker.track(message.ChannelID, message.ID, message.Content, responder.sent)
+}
+
+// deleteMessages deletes the messages sent by the bot in response to a command whose message was deleted. Reactions to that
+// message were deleted with it, they are skipped.
+func (h *Handler) deleteMessages(messages []sentMessage) {
+
+	for _, message := range messages {
+
+		if message.reaction != "" {
+			continue
+		}
+
+		h.paginator.stop(message.messageID)
+		h.communicator.DeleteMessage(message.channelID, message.messageID)
+	}
+}
+
+// notifyDropped tells the users in the channel that their command was dropped because the bot is busy.
+// To avoid making spam worse, the notice is sent at most once per dropNoticeInterval in each channel.
+func (h *Handler) notifyDropped(channelID, input string) {
+
+	h.lastDropNoticeMutex.Lock()
+	if time.Since(h.lastDropNotice[channelID]) < dropNoticeInterval {
+		h.lastDropNoticeMutex.Unlock()
+		return
+	}
+	h.lastDropNotice[channelID] = time.Now()
+	h.lastDropNoticeMutex.Unlock()
+
+	logger.Log("Command queue is full, dropped command in channel " + channelID + ": " + input)
+
+	// Send the notice in the background, the caller can't wait
+	go h.communicator.SendToChannel(channelID, &dg.MessageSend{
+		Content: "I'm too busy right now and had to skip some commands. Please try again in a moment.",
+	})
 }
 
-// RegisterCommand registers command - assigns a specific function to a specific string.
-// When user types that string the assigned function will be executed.
-// DO NOT use any prefixes when registering functions.
+// RegisterCommand registers command - assigns the command's handler to its name and aliases.
+// When user types the name or one of the aliases the assigned function will be executed. Subcommands of the command are
+// registered as well, they are invoked by typing their name after the name of the command (e.g. "monitor add").
+// DO NOT use any prefixes in names and aliases.
 // Command names are case insensitive.
-func RegisterCommand(name string, function ct.CommandHandler) bool {
+// Returns an error if the command (or any subcommand) has no name or handler, or if its name or any of its aliases is already
+// taken - in that case nothing is registered.
+func (h *Handler) RegisterCommand(command ct.Command) error {
+
+	// Validate the command and its subcommands and let them inherit settings of their groups
+	registered, err := prepareCommand(command, nil)
+
+	if err != nil {
+		return errors.New("Can't register command \"" + command.Name + "\" - " + err.Error())
+	}
+
+	// All names under which the command and its subcommands will be registered
+	keys, err := commandKeys(registered, "")
 
-	// Check if there's already a command registered for that name
-	if _, ok := registeredCommands[name]; ok {
-		// If so, return false - it won't be overwritted
-		return false
+	if err != nil {
+		return errors.New("Can't register command \"" + command.Name + "\" - " + err.Error())
 	}
 
-	// If the name was not present, then we can register a function to it
-	registeredCommands[name] = function
-	return true
+	h.commandsMutex.Lock()
+	defer h.commandsMutex.Unlock()
+
+	// Check if there's already a command registered for any of the names
+	for key := range keys {
+		if _, ok := h.registeredCommands[key]; ok {
+			// If so, return an error - it won't be overwritted
+			return errors.New("Can't register command \"" + command.Name + "\" - name \"" + key + "\" is already taken")
+		}
+	}
+
+	// If none of the names was present, then we can register the command
+	for key, keyCommand := range keys {
+		h.registeredCommands[key] = keyCommand
+	}
+
+	h.orderedCommands = append(h.orderedCommands, registered)
+	return nil
 }
 
-// RegisterCommandPrefix registers the given string as recognized command prefix.
-// Prefix can be registered only once. Future calls to this function won't do anything.
-// Returns true if registration was successful, false otherwise.
-// All prefixes are legal except for the IllegalPrefix "" (empty string)
-func RegisterCommandPrefix(prefix string) bool {
+// RegisterAlias registers a hidden name under which the command (or subcommand, e.g. "monitor add") can be typed. Hidden names
+// keep old names of moved commands working - they are not listed in help, not suggested and not published as slash commands.
+// Invocations are handled as invocations of the command itself, with its permissions, limits and name in the logs.
+// Returns an error if there's no such command or if the name is already taken.
+func (h *Handler) RegisterAlias(alias, name string) error {
 
-	// If there already is a prefix defined or the provided prefix is illegal, return false
-	if commandPrefix != "" || prefix == "" {
-		return false
+	h.commandsMutex.Lock()
+	defer h.commandsMutex.Unlock()
+
+	command, ok := h.registeredCommands[strings.ToLower(name)]
+	if !ok {
+		return errors.New("Can't register alias \"" + alias + "\" - there is no command \"" + name + "\"")
 	}
 
-	// Otherwise assign the new value and return success
-	commandPrefix = prefix
-	return true
+	key := strings.ToLower(alias)
+	if strings.Contains(key, " ") || key == "" {
+		return errors.New("Can't register alias \"" + alias + "\" - it has to be a single word")
+	}
+
+	if _, ok = h.registeredCommands[key]; ok {
+		return errors.New("Can't register alias \"" + alias + "\" - name \"" + key + "\" is already taken")
+	}
+
+	h.registeredCommands[key] = command
+	return nil
 }
 
-// isPrefixRegistered returns true if commandPrefix was correctly registered
-func isPrefixRegistered() bool {
-	return commandPrefix != IllegalPrefix
+// UnregisterCommand removes the command registered under the given name or alias, together with all its names and subcommands.
+// Returns an error if there is no such command. Only top level commands can be unregistered.
+func (h *Handler) UnregisterCommand(name string) error {
+
+	h.commandsMutex.Lock()
+	defer h.commandsMutex.Unlock()
+
+	command, ok := h.registeredCommands[strings.ToLower(name)]
+	if !ok || strings.Contains(command.Name, " ") {
+		return errors.New("Can't unregister command \"" + name + "\" - there is no such command")
+	}
+
+	// Keys were validated when the command was registered, so they can't fail now
+	keys, _ := commandKeys(command, "")
+
+	removed := make(map[*ct.Command]bool, len(keys))
+	for _, keyCommand := range keys {
+		removed[keyCommand] = true
+	}
+
+	// All names of the command and its subcommands are removed, including hidden ones (see RegisterAlias)
+	for key, registered := range h.registeredCommands {
+		if removed[registered] {
+			delete(h.registeredCommands, key)
+		}
+	}
+
+	for i, ordered := range h.orderedCommands {
+		if ordered == command {
+			h.orderedCommands = append(h.orderedCommands[:i:i], h.orderedCommands[i+1:]...)
+			break
+		}
+	}
+
+	return nil
 }
 
-// isInitialized returns true if all necessary initialization was performed. If it's not the case returns false and assigns an error (based on first
-// caught unitialized aspect)
-func isInitialized() (bool, error) {
+// Use registers middlewares that will be applied to every command. Middlewares are applied in order of registration - the first
+// registered one is the outermost, i.e. it runs first. Middlewares registered for all commands run before the ones registered
+// for a particular command (ct.Command.Middlewares).
+func (h *Handler) Use(middlewares ...ct.Middleware) {
+
+	h.commandsMutex.Lock()
+	defer h.commandsMutex.Unlock()
 
-	// Check if prefix was initialized
-	if !isPrefixRegistered() {
-		return false, errors.New("Handler error: prefix was not initialized")
+	h.middlewares = append(h.middlewares, middlewares...)
+}
+
+// getCommand returns the command registered for the given name or alias
+func (h *Handler) getCommand(name string) (*ct.Command, bool) {
+
+	h.commandsMutex.RLock()
+	defer h.commandsMutex.RUnlock()
+
+	command, ok := h.registeredCommands[name]
+	return command, ok
+}
+
+// getCommands returns all registered top level commands in order of registration
+func (h *Handler) getCommands() []*ct.Command {
+
+	h.commandsMutex.RLock()
+	defer h.commandsMutex.RUnlock()
+
+	return append([]*ct.Command{}, h.orderedCommands...)
+}
+
+// commandInput checks whether the message may be a command - it has to start with the guild's prefix or a mention of the bot
+// and can't be posted by a bot. If so, returns the content of the message after the prefix (or mention) and true.
+// Otherwise returns false.
+func (h *Handler) commandInput(message *dg.Message) (string, bool) {
+
+	// Don't respond to any bots (including ourselvers) and messages without an author (e.g. system messages)
+	if message == nil || message.Author == nil || message.Author.Bot {
+		return "", false
+	}
+
+	// Check if the message starts with the prefix of the guild (case insensitive)
+	prefix := h.prefixFor(message.GuildID)
+
+	if len(message.Content) >= len(prefix) && strings.EqualFold(message.Content[:len(prefix)], prefix) {
+		// Remove the prefix from the input
+		return message.Content[len(prefix):], true
 	}
 
-	return true, nil
+	// Users who forget the prefix can mention the bot instead
+	return h.mentionInput(message)
+}
+
+// mentionInput checks whether the message starts with a mention of the bot, in either of its forms (<@id> and <@!id>).
+// If so, returns the content of the message after the mention and true. Otherwise returns false.
+func (h *Handler) mentionInput(message *dg.Message) (string, bool) {
+
+	// The ID may not be known yet, e.g. if the transport is still connecting
+	botUserID := h.communicator.Transport().BotUserID()
+	if botUserID == "" {
+		return "", false
+	}
+
+	content := strings.TrimLeft(message.Content, " ")
+
+	for _, mention := range []string{"<@" + botUserID + ">", "<@!" + botUserID + ">"} {
+		if strings.HasPrefix(content, mention) {
+			return content[len(mention):], true
+		}
+	}
+
+	return "", false
+}
+
+// prefixFor returns the command prefix used in the guild - the one set by the guild or the default one
+func (h *Handler) prefixFor(guildID string) string {
+
+	if guildID != "" {
+		if prefix := h.store.Guild(guildID).Prefix; prefix != "" {
+			return prefix
+		}
+	}
+
+	return h.defaultPrefix
 }
 
 // parseCommand is a helper function to ParseCommand. It analyses the message and, if needed, invokes a command.
-func parseCommand(message *dg.MessageCreate) {
-	// Check if we're initialized
-	if ok, err := isInitialized(); !ok {
-		logger.LogError(err)
+// previous are the responses to the message from before it was edited, they are reused by the new run (see responder.send).
+// Panics are recovered, so that a failing command can't take the whole bot down.
+func (h *Handler) parseCommand(message *dg.Message, previous []sentMessage) {
+
+	// Name of the recognized command, used when recovering from a panic
+	var commandName string
+
+	// Make sure that the message can be handled at all
+	if message == nil {
 		return
 	}
 
-	// Don't respond to any bots (including ourselvers)
-	if message.Author.Bot {
+	// Get the part of the message after the prefix - if the message is not a command, return as there is nothing we can do
+	input, ok := h.commandInput(message)
+	if !ok {
 		return
 	}
 
-	// The message content, converted to lower-case
-	input := strings.ToLower(message.Content)
+	responder := h.messageResponder(message, previous)
+
+	// Responses are tracked after the recovery, so that the apology for a crash is tracked as well
+	defer h.trackResponses(message, responder)
+	defer h.recoverCommand(message.GuildID, &commandName, responder)
+
+	// Split the input into tokens, quoted text is kept together
+	tokens, err := tokenize(input)
+
+	// If the input couldn't be split and it looks like one of our commands, let the user know what's wrong
+	if err != nil {
+		if fields := strings.Fields(input); len(fields) > 0 {
+			if command, ok := h.getCommand(strings.ToLower(fields[0])); ok {
+				h.auditRejection(command, &ct.CommandArgs{
+					Username:  message.Author.Username,
+					UserID:    message.Author.ID,
+					GuildID:   message.GuildID,
+					ChannelID: message.ChannelID,
+					UserArgs:  fields[1:],
+				}, audit.ErrorClassUser)
+				h.reportError(message.GuildID, command.Name, ct.NewUserError("Can't read the command: "+err.Error()), responder)
+			}
+		}
 
-	// Check if the input string contains the registered prefix - if not, return as there is nothing we can do
-	if !strings.HasPrefix(input, commandPrefix) {
 		return
 	}
 
-	// Remove the prefix from the input
-	input = input[len(commandPrefix):]
+	// If there were no tokens - return (command was empty)
+	if len(tokens) < 1 {
 
-	// Split the input based on whitespace - each substring now contains only non-whitespace characters
-	slice := strings.Fields(input)
+		// The bot was mentioned without a command - the user probably doesn't know how to use it
+		if _, mentioned := h.mentionInput(message); mentioned {
+			responder.reply(h.mentionHint(message.GuildID))
+		}
 
-	// If the slice resulted in no substrings - return (command was empty)
-	if len(slice) < 1 {
 		return
 	}
 
-	// Try to get a function matching to the first substring (which is the command name, the eventual remaining substrings are parameters)
-	if function, ok := registeredCommands[slice[0]]; ok {
+	words := make([]string, len(tokens))
+	for i, token := range tokens {
+		words[i] = token.value
+	}
+
+	// Try to get a command matching to the first tokens (the command name and names of subcommands, the eventual remaining tokens
+	// are parameters). Command names are case insensitive, arguments keep their case
+	if command, used, ok := h.findCommand(words); ok {
+
+		commandName = command.Name
+
+		// Groups without a handler can't be run, show what they contain instead
+		if command.Handler == nil {
+
+			unknownSubcommand := ""
+			if used < len(words) {
+				unknownSubcommand = words[used]
+			}
+
+			responder.reply(h.groupHelp(command, unknownSubcommand, message.GuildID))
+			return
+		}
+
+		// Collect the values of argument tokens
+		userArgs := append([]string{}, words[used:]...)
+
+		// If the command declares its arguments, validate them before running it
+		var parsedArgs map[string]interface{}
+
+		if command.Arguments != nil {
+			if parsedArgs, err = parseArguments(command.Arguments, userArgs); err != nil {
+				// Arguments are wrong, tell the user what's wrong and how to use the command
+				usageError := ct.NewUserError(err.Error() + "\nUsage: `" + h.usageLine(command, message.GuildID) + "`")
+				h.auditRejection(command, &ct.CommandArgs{
+					Username:  message.Author.Username,
+					UserID:    message.Author.ID,
+					GuildID:   message.GuildID,
+					ChannelID: message.ChannelID,
+					UserArgs:  userArgs,
+				}, audit.ErrorClassUser)
+				h.reportError(message.GuildID, command.Name, usageError, responder)
+				return
+			}
+		}
 
 		// Construct a struct with arguments
 		args := ct.CommandArgs{
-			CommandName: slice[0],
-			Username:    message.Author.Username,
-			UserID:      message.Author.ID,
-			UserArgs:    slice[1:]}
-
-		// Log command execution
-		logger.LogCommand(message.GuildID, message.ChannelID, args)
-
-		// If there were no errors when running the command and it returned a message to send to the channel
-		if output, err := function(&args); err == nil {
-			if output != nil {
-				// Send the produced message to the source channel
-				communication.SendToChannel(message.ChannelID, output)
-			}
-		} else {
-			// Otherwise log the error
-			logger.LogError(err)
+			CommandName:    command.Name,
+			Username:       message.Author.Username,
+			UserID:         message.Author.ID,
+			GuildID:        message.GuildID,
+			ChannelID:      message.ChannelID,
+			MessageID:      message.ID,
+			Attachments:    message.Attachments,
+			MentionedUsers: message.Mentions,
+			MentionedRoles: message.MentionRoles,
+			UserArgs:       userArgs,
+			RawArgs:        strings.TrimSpace(input[tokens[used-1].end:]),
+			ParsedArgs:     parsedArgs,
+			Source:         ct.MessageInvocation}
+
+		// Members are only sent with messages posted in guilds
+		if message.Member != nil {
+			args.MemberRoles = message.Member.Roles
 		}
+
+		h.runCommand(command, &args, responder)
+	} else {
+		// Unknown command, it's probably a typo
+		h.suggestCommand(message, words[0], responder)
+	}
+}
+
+// runCommand runs the command with all its middlewares and delivers its output (or the error) to the user with responder.
+// The context of the command (see ct.CommandArgs.Context) and the conversation of interactive commands are created here, the
+// context is canceled when the command returns.
+// Commands disabled in the channel are not run - typed ones are ignored, so that they don't cause noise where they are unwanted,
+// slash commands are told that the command is disabled. Both are recorded in the audit log, like other rejected invocations.
+// Guild-only commands invoked in direct messages are rejected too (see ct.Command.GuildOnly).
+func (h *Handler) runCommand(command *ct.Command, args *ct.CommandArgs, responder *responder) {
+
+	if availability := h.availability(command, args.GuildID, args.ChannelID); !availability.enabled {
+
+		h.auditRejection(command, args, audit.ErrorClassDisabled)
+
+		if args.Source != ct.SlashCommandInvocation {
+			return
+		}
+
+		responder.reply(&dg.MessageSend{
+			Content: "`/" + strings.ToLower(command.Name) + "` is " + availability.reason + ".",
+			Flags:   dg.MessageFlagsEphemeral,
+		})
+
+		return
+	}
+
+	// Checked before the middlewares, permission rules of such commands would deny everyone in direct messages
+	if command.GuildOnly && args.GuildID == "" {
+		h.auditRejection(command, args, audit.ErrorClassUser)
+		h.reportError(args.GuildID, command.Name, ct.NewUserError("`"+h.prefixFor(args.GuildID)+command.Name+"` can only be used on a server."),
+			responder)
+		return
 	}
+
+	timeout := h.commandTimeout
+
+	// Interactive commands get a conversation, but only one per user in a channel - their answers would get mixed
+	if command.Interactive {
+
+		if !h.conversations.begin(args.ChannelID, args.UserID) {
+			h.auditRejection(command, args, audit.ErrorClassUser)
+			h.reportError(args.GuildID, command.Name, ct.NewUserError("Please finish your conversation with me in this channel first."),
+				responder)
+			return
+		}
+		defer h.conversations.end(args.ChannelID, args.UserID)
+
+		timeout = maxConversationDuration
+	}
+
+	invocationContext, cancel := context.WithTimeout(h.runningContext(), timeout)
+	defer cancel()
+
+	args.Context = invocationContext
+
+	if command.Interactive {
+		args.Conversation = &conversation{
+			conversations: h.conversations,
+			responder:     responder,
+			userID:        args.UserID,
+			channelID:     args.ChannelID,
+			context:       invocationContext,
+		}
+	}
+
+	output, err := h.chain(command)(args)
+
+	// If there were errors, let the user know what went wrong
+	if err != nil {
+		h.reportError(args.GuildID, command.Name, err, responder)
+		return
+	}
+
+	// If there were no errors, deliver the messages of the command to their targets
+	responder.deliver(output)
 }
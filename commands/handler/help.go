@@ -0,0 +1,234 @@
+package handler
+
+import (
+	dg "github.com/bwmarrin/discordgo"
+	ct "github.com/generalkenobi/makrochatbot/customtypes"
+	"strings"
+)
+
+// Categories of built-in commands and commands without a category
+const (
+	// GeneralCategory is the category of built-in commands
+	GeneralCategory = "General"
+
+	// otherCategory is used in help for commands that don't specify their category
+	otherCategory = "Other"
+)
+
+// helpEmbedColor is the color of the embeds created by help
+const helpEmbedColor = 0x3498db
+
+// helpCategoriesPerPage is the number of category fields on one page of the list of commands
+const helpCategoriesPerPage = 4
+
+// registerBuiltInCommands registers commands that are provided by the handler itself
+func (h *Handler) registerBuiltInCommands() error {
+
+	commands := append([]ct.Command{
+		{
+			Name:        "help",
+			Description: "Shows the list of commands or details of one command",
+			Arguments: []ct.ArgumentSpec{
+				{Name: "command", Description: "Command to describe, with subcommand if needed", Optional: true, Variadic: true},
+			},
+			Examples: []string{"help", "help roll", "help monitor add"},
+			Category: GeneralCategory,
+			Handler:  h.help,
+		},
+	}, h.prefixCommands()...)
+
+	commands = append(commands, h.availabilityCommands()...)
+	commands = append(commands, h.suggestionCommands()...)
+	commands = append(commands, h.auditCommands()...)
+
+	for _, command := range commands {
+		if err := h.RegisterCommand(command); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// help is the handler of the help command.
+// User arguments:
+// 1... - optional, name or alias of the command to describe, followed by names of subcommands. If it's not given, all commands
+// are listed.
+func (h *Handler) help(args *ct.CommandArgs) (*ct.Response, error) {
+
+	// Without arguments, list all commands
+	if !args.Has("command") {
+		return ct.NewResponse().Paginate(ct.ChannelTarget, ct.EmbedPages(h.commandListEmbed(args.GuildID), helpCategoriesPerPage)), nil
+	}
+
+	// Otherwise describe the requested command, all names have to match
+	names := args.Strings("command")
+
+	if command, used, ok := h.findCommand(names); ok && used == len(names) {
+		return ct.MessageResponse(&dg.MessageSend{Embeds: []*dg.MessageEmbed{h.commandEmbed(command, args.GuildID)}}), nil
+	}
+
+	// Command wasn't found, let the user know how to get the list of commands
+	message := &dg.MessageSend{
+		Content: "Unknown command `" + strings.Join(names, " ") + "`. Use `" + h.prefixFor(args.GuildID) + "help` to see all commands.",
+	}
+
+	return ct.MessageResponse(message), nil
+}
+
+// mentionHint creates a short hint on how to use the bot, sent when the bot is mentioned without a command
+func (h *Handler) mentionHint(guildID string) *dg.MessageSend {
+
+	prefix := h.prefixFor(guildID)
+
+	return &dg.MessageSend{
+		Content: "Hi! My prefix here is `" + prefix + "`, you can also mention me instead of it. " +
+			"Use `" + prefix + "help` to see all commands.",
+	}
+}
+
+// commandListEmbed creates an embed listing all registered commands grouped by category, using the prefix of the guild.
+// The embed may have too many fields for one message, it's meant to be split into pages (see ct.EmbedPages).
+func (h *Handler) commandListEmbed(guildID string) *dg.MessageEmbed {
+
+	prefix := h.prefixFor(guildID)
+
+	// Lines describing commands in each category and the categories in order of first appearance
+	categoryLines := make(map[string][]string)
+	var categories []string
+
+	for _, command := range h.getCommands() {
+
+		category := command.Category
+		if category == "" {
+			category = otherCategory
+		}
+
+		// Remember the order of categories
+		if _, ok := categoryLines[category]; !ok {
+			categories = append(categories, category)
+		}
+
+		line := "`" + prefix + command.Name + "` - " + command.Description
+
+		// Groups show the names of their subcommands
+		if len(command.Subcommands) > 0 {
+			subcommands := make([]string, len(command.Subcommands))
+			for i := range command.Subcommands {
+				subcommands[i] = localName(&command.Subcommands[i])
+			}
+
+			line += " (" + strings.Join(subcommands, ", ") + ")"
+		}
+
+		categoryLines[category] = append(categoryLines[category], line)
+	}
+
+	embed := &dg.MessageEmbed{
+		Title:       "Commands",
+		Description: "Use `" + prefix + "help <command>` to learn more about a command.",
+		Color:       helpEmbedColor,
+	}
+
+	// Add a field for each category, categories with too many commands continue in more fields
+	for _, category := range categories {
+		for i, value := range ct.SplitLines("", categoryLines[category], ct.MaxEmbedFieldValueLength) {
+
+			name := category
+			if i > 0 {
+				name += " (continued)"
+			}
+
+			embed.Fields = append(embed.Fields, &dg.MessageEmbedField{Name: name, Value: value})
+		}
+	}
+
+	return embed
+}
+
+// commandEmbed creates an embed describing the given command - its usage, examples and aliases, using the prefix of the guild
+func (h *Handler) commandEmbed(command *ct.Command, guildID string) *dg.MessageEmbed {
+
+	prefix := h.prefixFor(guildID)
+
+	embed := &dg.MessageEmbed{
+		Title:       prefix + command.Name,
+		Description: command.Description,
+		Color:       helpEmbedColor,
+	}
+
+	// Usage is always shown, even if the command takes no arguments
+	embed.Fields = append(embed.Fields, &dg.MessageEmbedField{
+		Name:  "Usage",
+		Value: "`" + h.usageLine(command, guildID) + "`",
+	})
+
+	if len(command.Arguments) > 0 {
+
+		// Describe each argument - its name, description and accepted values
+		arguments := make([]string, len(command.Arguments))
+		for i, argument := range command.Arguments {
+
+			arguments[i] = "`" + argument.Name + "`"
+			if argument.Description != "" {
+				arguments[i] += " - " + argument.Description
+			}
+
+			arguments[i] += " (" + describeArgumentType(argument)
+			if argument.Optional {
+				arguments[i] += ", optional"
+			}
+			arguments[i] += ")"
+		}
+
+		embed.Fields = append(embed.Fields, &dg.MessageEmbedField{
+			Name:  "Arguments",
+			Value: strings.Join(arguments, "\n"),
+		})
+	}
+
+	if len(command.Subcommands) > 0 {
+
+		// Describe each subcommand with its usage, details are shown by help of the subcommand
+		subcommands := make([]string, len(command.Subcommands))
+		for i := range command.Subcommands {
+			subcommands[i] = "`" + h.usageLine(&command.Subcommands[i], guildID) + "` - " + command.Subcommands[i].Description
+		}
+
+		embed.Fields = append(embed.Fields, &dg.MessageEmbedField{
+			Name:  "Subcommands",
+			Value: strings.Join(subcommands, "\n") + "\nUse `" + prefix + "help " + command.Name + " <subcommand>` to learn more.",
+		})
+	}
+
+	if len(command.Examples) > 0 {
+
+		// Format each example as code, with prefix
+		examples := make([]string, len(command.Examples))
+		for i, example := range command.Examples {
+			examples[i] = "`" + prefix + example + "`"
+		}
+
+		embed.Fields = append(embed.Fields, &dg.MessageEmbedField{
+			Name:  "Examples",
+			Value: strings.Join(examples, "\n"),
+		})
+	}
+
+	if len(command.Aliases) > 0 {
+		embed.Fields = append(embed.Fields, &dg.MessageEmbedField{
+			Name:  "Aliases",
+			Value: strings.Join(command.Aliases, ", "),
+		})
+	}
+
+	if command.Category != "" {
+		embed.Fields = append(embed.Fields, &dg.MessageEmbedField{
+			Name:   "Category",
+			Value:  command.Category,
+			Inline: true,
+		})
+	}
+
+	return embed
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	ct "github.com/generalkenobi/makrochatbot/customtypes"
+	"github.com/generalkenobi/makrochatbot/logger"
+	"time"
+)
+
+// chain wraps the handler of the command in all middlewares that apply to it - first the ones registered for all commands and
+// then the ones registered for the command. Returns the handler that should be invoked to run the command.
+func (h *Handler) chain(command *ct.Command) ct.CommandHandler {
+
+	h.commandsMutex.RLock()
+	middlewares := append(append([]ct.Middleware{}, h.middlewares...), command.Middlewares...)
+	h.commandsMutex.RUnlock()
+
+	// Wrap from the innermost middleware, so that the first one ends up being the outermost
+	handler := command.Handler
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](command, handler)
+	}
+
+	return handler
+}
+
+// LoggingMiddleware logs every invocation of the command - guild, channel, user and arguments
+func LoggingMiddleware(command *ct.Command, next ct.CommandHandler) ct.CommandHandler {
+
+	return func(args *ct.CommandArgs) (*ct.Response, error) {
+
+		logger.LogCommand(*args)
+		return next(args)
+	}
+}
+
+// TimingMiddleware logs how long it took to run the command
+func TimingMiddleware(command *ct.Command, next ct.CommandHandler) ct.CommandHandler {
+
+	return func(args *ct.CommandArgs) (*ct.Response, error) {
+
+		start := time.Now()
+		output, err := next(args)
+
+		logger.Log("Command \"" + command.Name + "\" took " + time.Since(start).String())
+		return output, err
+	}
+}
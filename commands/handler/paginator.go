@@ -0,0 +1,195 @@
+package handler
+
+import (
+	dg "github.com/bwmarrin/discordgo"
+	"github.com/generalkenobi/makrochatbot/communication"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Emojis of the reactions used to switch pages
+const (
+	// previousPageEmoji shows the previous page
+	previousPageEmoji = "◀" + emojiVariationSelector
+
+	// nextPageEmoji shows the next page
+	nextPageEmoji = "▶" + emojiVariationSelector
+)
+
+// paginationTimeout is the time after which pages of a message can't be switched anymore
+const paginationTimeout = 5 * time.Minute
+
+// emojiVariationSelector asks for the emoji presentation of a character, reactions may come with or without it
+const emojiVariationSelector = "\uFE0F"
+
+// pagination is a message showing one of its pages, which can be switched by the user who invoked the command
+type pagination struct {
+
+	// pages of the message, in order
+	pages []*dg.MessageSend
+
+	// current is the index of the page that is shown
+	current int
+
+	// userID is the ID of the user who can switch pages
+	userID string
+
+	// channelID and messageID identify the message
+	channelID string
+	messageID string
+
+	// inGuild is true if the message was sent to a guild channel, where reactions of users can be removed by the bot
+	inGuild bool
+
+	// interaction is the interaction the message responded to, nil if the message was sent to a channel. Such messages have to be
+	// edited through the interaction.
+	interaction *dg.Interaction
+
+	// timer expires the pagination after paginationTimeout
+	timer *time.Timer
+}
+
+// paginator switches pages of paginated messages when their users react with previousPageEmoji or nextPageEmoji.
+// It is safe for concurrent use.
+type paginator struct {
+
+	// communicator is used to edit the messages and manage their reactions
+	communicator *communication.Communicator
+
+	// paginations are the messages whose pages can be switched, key is the message ID
+	paginations map[string]*pagination
+
+	// mutex is used to synchronize access to paginations and their current pages
+	mutex sync.Mutex
+}
+
+// newPaginator creates a paginator without any messages
+func newPaginator(communicator *communication.Communicator) *paginator {
+	return &paginator{communicator: communicator, paginations: make(map[string]*pagination)}
+}
+
+// start adds the reactions for switching pages to the message of the pagination (which shows its first page) and lets the user
+// switch pages until paginationTimeout passes
+func (p *paginator) start(pagination *pagination) {
+
+	p.mutex.Lock()
+
+	// The message may still show pages of an earlier pagination, e.g. of an edited command
+	if previous, ok := p.paginations[pagination.messageID]; ok {
+		previous.timer.Stop()
+	}
+
+	p.paginations[pagination.messageID] = pagination
+	pagination.timer = time.AfterFunc(paginationTimeout, func() { p.expire(pagination) })
+
+	p.mutex.Unlock()
+
+	p.communicator.AddReaction(pagination.channelID, pagination.messageID, previousPageEmoji)
+	p.communicator.AddReaction(pagination.channelID, pagination.messageID, nextPageEmoji)
+}
+
+// stop stops switching pages of the message, e.g. because it's going to be replaced or deleted. Reactions are left as they are.
+// Returns false if pages of the message couldn't be switched.
+func (p *paginator) stop(messageID string) bool {
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	pagination, ok := p.paginations[messageID]
+	if ok {
+		pagination.timer.Stop()
+		delete(p.paginations, messageID)
+	}
+
+	return ok
+}
+
+// expire stops switching pages of the pagination and removes the reactions of the bot, so that users know they do nothing
+func (p *paginator) expire(pagination *pagination) {
+
+	p.mutex.Lock()
+
+	// The message may have been stopped or taken over by another pagination in the meantime
+	if p.paginations[pagination.messageID] != pagination {
+		p.mutex.Unlock()
+		return
+	}
+
+	delete(p.paginations, pagination.messageID)
+	p.mutex.Unlock()
+
+	p.removeReactions(pagination.channelID, pagination.messageID)
+}
+
+// removeReactions removes the reactions for switching pages added by the bot to the message
+func (p *paginator) removeReactions(channelID, messageID string) {
+
+	botUserID := p.communicator.Transport().BotUserID()
+
+	p.communicator.RemoveReaction(channelID, messageID, previousPageEmoji, botUserID)
+	p.communicator.RemoveReaction(channelID, messageID, nextPageEmoji, botUserID)
+}
+
+// handleReaction switches the page of the message the reaction was added to, if it's a paginated message and the reaction
+// was added by its user. Pages wrap around - the next page after the last one is the first one.
+// The reaction is removed so that the user can use it again, except in direct messages where the bot can't remove it
+// (removing it switches the page too, see handleReactionRemove).
+func (p *paginator) handleReaction(reaction *dg.MessageReaction) {
+	p.switchPage(reaction, false)
+}
+
+// handleReactionRemove switches the page of a paginated message in direct messages when its user removes their reaction, like
+// handleReaction. The bot can't remove reactions there, so the user would have to remove and add it again to switch pages twice
+// - this way each click switches the page. On servers reactions are removed by the bot itself, so removals are ignored.
+func (p *paginator) handleReactionRemove(reaction *dg.MessageReaction) {
+	p.switchPage(reaction, true)
+}
+
+// switchPage switches the page according to the added (or removed) reaction, see handleReaction and handleReactionRemove
+func (p *paginator) switchPage(reaction *dg.MessageReaction, removed bool) {
+
+	emoji := strings.TrimSuffix(reaction.Emoji.Name, emojiVariationSelector)
+
+	step := 0
+	switch emoji {
+
+	case strings.TrimSuffix(previousPageEmoji, emojiVariationSelector):
+		{
+			step = -1
+		}
+
+	case strings.TrimSuffix(nextPageEmoji, emojiVariationSelector):
+		{
+			step = 1
+		}
+
+	default:
+		{
+			return
+		}
+	}
+
+	p.mutex.Lock()
+
+	pagination, ok := p.paginations[reaction.MessageID]
+	if !ok || pagination.userID != reaction.UserID || (removed && pagination.inGuild) {
+		p.mutex.Unlock()
+		return
+	}
+
+	pagination.current = (pagination.current + step + len(pagination.pages)) % len(pagination.pages)
+	page := pagination.pages[pagination.current]
+
+	p.mutex.Unlock()
+
+	if pagination.interaction != nil {
+		p.communicator.EditInteractionMessage(pagination.interaction, pagination.messageID, page)
+	} else {
+		p.communicator.EditMessage(pagination.channelID, pagination.messageID, page)
+	}
+
+	if pagination.inGuild && !removed {
+		p.communicator.RemoveReaction(reaction.ChannelID, reaction.MessageID, reaction.Emoji.APIName(), reaction.UserID)
+	}
+}
@@ -0,0 +1,274 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+
+	dg "github.com/bwmarrin/discordgo"
+	"github.com/generalkenobi/makrochatbot/communication"
+)
+
+// paginationTest is a message with three pages ("1", "2" and "3") whose pages can be switched by "user"
+type paginationTest struct {
+	t          *testing.T
+	transport  *communication.MemoryTransport
+	paginator  *paginator
+	pagination *pagination
+}
+
+// startPaginationTest sends the first page to the channel and starts the pagination. Reactions of users are delivered to the
+// paginator as they come, like in the handler.
+func startPaginationTest(t *testing.T, channelID string, inGuild bool) *paginationTest {
+
+	transport := communication.NewMemoryTransport()
+	if err := transport.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	paginator := newPaginator(communication.NewCommunicator(transport))
+	transport.OnReactionAdd(paginator.handleReaction)
+	transport.OnReactionRemove(paginator.handleReactionRemove)
+
+	pages := []*dg.MessageSend{{Content: "1"}, {Content: "2"}, {Content: "3"}}
+
+	message, err := transport.SendMessage(channelID, pages[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test := &paginationTest{
+		t:          t,
+		transport:  transport,
+		paginator:  paginator,
+		pagination: &pagination{pages: pages, userID: "user", channelID: channelID, messageID: message.ID, inGuild: inGuild},
+	}
+
+	paginator.start(test.pagination)
+
+	return test
+}
+
+// react adds the reaction of the user to the message
+func (test *paginationTest) react(userID, emoji string) {
+	test.transport.ReceiveReaction(&dg.MessageReaction{
+		UserID:    userID,
+		ChannelID: test.pagination.channelID,
+		MessageID: test.pagination.messageID,
+		Emoji:     dg.Emoji{Name: emoji},
+	})
+}
+
+// unreact removes the reaction of the user from the message
+func (test *paginationTest) unreact(userID, emoji string) {
+	test.transport.ReceiveReactionRemove(&dg.MessageReaction{
+		UserID:    userID,
+		ChannelID: test.pagination.channelID,
+		MessageID: test.pagination.messageID,
+		Emoji:     dg.Emoji{Name: emoji},
+	})
+}
+
+// shownPage returns the content of the message
+func (test *paginationTest) shownPage() string {
+
+	for _, sent := range test.transport.Sent() {
+		if sent.MessageID == test.pagination.messageID {
+			return sent.Message.Content
+		}
+	}
+
+	test.t.Fatal("Message " + test.pagination.messageID + " was not sent")
+	return ""
+}
+
+// reactionsOf returns the emojis of the reactions of the user to the message
+func (test *paginationTest) reactionsOf(userID string) []string {
+
+	emojis := []string{}
+	for _, reaction := range test.transport.Reactions() {
+		if reaction.MessageID == test.pagination.messageID && reaction.UserID == userID {
+			emojis = append(emojis, reaction.Emoji)
+		}
+	}
+
+	return emojis
+}
+
+func TestPaginationSwitchesPages(t *testing.T) {
+
+	type reaction struct {
+		userID string
+		emoji  string
+	}
+
+	tests := []struct {
+		name      string
+		reactions []reaction
+		page      string
+	}{
+		{name: "nothing", reactions: nil, page: "1"},
+		{name: "next", reactions: []reaction{{"user", nextPageEmoji}}, page: "2"},
+		{name: "next and previous", reactions: []reaction{{"user", nextPageEmoji}, {"user", previousPageEmoji}}, page: "1"},
+		{name: "previous wraps around to the last", reactions: []reaction{{"user", previousPageEmoji}}, page: "3"},
+		{
+			name:      "next wraps around to the first",
+			reactions: []reaction{{"user", nextPageEmoji}, {"user", nextPageEmoji}, {"user", nextPageEmoji}},
+			page:      "1",
+		},
+		{name: "emoji without the variation selector", reactions: []reaction{{"user", "▶"}}, page: "2"},
+		{name: "other user", reactions: []reaction{{"other user", nextPageEmoji}}, page: "1"},
+		{name: "other emoji", reactions: []reaction{{"user", "👍"}}, page: "1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			message := startPaginationTest(t, "channel", true)
+
+			for _, reaction := range test.reactions {
+				message.react(reaction.userID, reaction.emoji)
+			}
+
+			if page := message.shownPage(); page != test.page {
+				t.Errorf("Shown page %s, expected %s", page, test.page)
+			}
+		})
+	}
+}
+
+func TestPaginationSwitchesPagesOnRemovedReactions(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		inGuild bool
+		pages   []string
+	}{
+		// The bot removes the reaction itself, Discord reports that as a removal by the user
+		{name: "guild", inGuild: true, pages: []string{"2", "2", "3"}},
+		{name: "direct messages", inGuild: false, pages: []string{"2", "3", "1"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			message := startPaginationTest(t, "channel", test.inGuild)
+
+			steps := []func(){
+				func() { message.react("user", nextPageEmoji) },
+				func() { message.unreact("user", nextPageEmoji) },
+				func() { message.react("user", nextPageEmoji) },
+			}
+
+			for i, step := range steps {
+				step()
+
+				if page := message.shownPage(); page != test.pages[i] {
+					t.Errorf("Shown page %s after step %d, expected %s", page, i+1, test.pages[i])
+				}
+			}
+
+			// Removals by other users and of the bot's own reactions don't switch pages
+			message.unreact("other user", nextPageEmoji)
+			message.unreact(communication.MemoryBotUserID, previousPageEmoji)
+
+			if page := message.shownPage(); page != test.pages[len(test.pages)-1] {
+				t.Errorf("Shown page %s after removals by others, expected %s", page, test.pages[len(test.pages)-1])
+			}
+		})
+	}
+}
+
+func TestPaginationRemovesReactions(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		inGuild bool
+		kept    []string
+	}{
+		{name: "guild", inGuild: true, kept: []string{}},
+		{name: "direct messages", inGuild: false, kept: []string{nextPageEmoji}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			message := startPaginationTest(t, "channel", test.inGuild)
+
+			if reactions := message.reactionsOf(communication.MemoryBotUserID); !reflect.DeepEqual(reactions,
+				[]string{previousPageEmoji, nextPageEmoji}) {
+				t.Fatalf("Reactions of the bot = %v, expected both page switches", reactions)
+			}
+
+			// The user's reaction is removed where the bot can do it, so that it can be used again
+			message.react("user", nextPageEmoji)
+
+			if reactions := message.reactionsOf("user"); !reflect.DeepEqual(reactions, test.kept) {
+				t.Errorf("Reactions of the user = %v, expected %v", reactions, test.kept)
+			}
+
+			// Reactions of other users are not touched
+			message.react("other user", nextPageEmoji)
+
+			if reactions := message.reactionsOf("other user"); !reflect.DeepEqual(reactions, []string{nextPageEmoji}) {
+				t.Errorf("Reactions of another user = %v, expected them kept", reactions)
+			}
+		})
+	}
+}
+
+func TestPaginationExpires(t *testing.T) {
+
+	message := startPaginationTest(t, "channel", true)
+
+	message.paginator.expire(message.pagination)
+
+	if reactions := message.reactionsOf(communication.MemoryBotUserID); len(reactions) != 0 {
+		t.Errorf("Reactions of the bot after expiring = %v, expected none", reactions)
+	}
+
+	message.react("user", nextPageEmoji)
+
+	if page := message.shownPage(); page != "1" {
+		t.Errorf("Shown page %s after expiring, expected 1", page)
+	}
+}
+
+func TestPaginationReplaced(t *testing.T) {
+
+	message := startPaginationTest(t, "channel", true)
+
+	// The message shows pages of an edited command now, the timer of the first pagination may still fire
+	replaced := message.pagination
+	message.pagination = &pagination{
+		pages:     []*dg.MessageSend{{Content: "A"}, {Content: "B"}},
+		userID:    "user",
+		channelID: replaced.channelID,
+		messageID: replaced.messageID,
+		inGuild:   true,
+	}
+
+	message.paginator.start(message.pagination)
+	message.paginator.expire(replaced)
+
+	message.react("user", nextPageEmoji)
+
+	if page := message.shownPage(); page != "B" {
+		t.Errorf("Shown page %s, expected B of the new pagination", page)
+	}
+
+	// Stopped paginations don't switch pages and keep their reactions
+	if !message.paginator.stop(message.pagination.messageID) {
+		t.Fatal("Pagination was not running when stopped")
+	}
+
+	message.paginator.expire(message.pagination)
+	message.react("user", nextPageEmoji)
+
+	if page := message.shownPage(); page != "B" {
+		t.Errorf("Shown page %s after stopping, expected B", page)
+	}
+
+	if reactions := message.reactionsOf(communication.MemoryBotUserID); len(reactions) == 0 {
+		t.Error("Reactions of the bot were removed after stopping")
+	}
+}
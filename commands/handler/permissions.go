@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"errors"
+	dg "github.com/bwmarrin/discordgo"
+	ct "github.com/generalkenobi/makrochatbot/customtypes"
+	"strconv"
+	"strings"
+)
+
+// allGuildsKey is the key in ct.Config.Permissions under which rules applying to all guilds are configured
+const allGuildsKey = "*"
+
+// PermissionMiddleware prevents the command from running if the user is not allowed to use it in the guild. Rules are taken from
+// ct.Config.Permissions (for the guild or, if there is none, for all guilds) and, if the config has no rule for the command,
+// from ct.Command.Permissions. Users that are denied get a reply explaining who can use the command.
+func (h *Handler) PermissionMiddleware(command *ct.Command, next ct.CommandHandler) ct.CommandHandler {
+
+	return func(args *ct.CommandArgs) (*ct.Response, error) {
+
+		allowed, err := h.isAllowed(command, args.GuildID, args.ChannelID, args.UserID)
+
+		if err != nil {
+			return nil, errors.New("Can't check permissions. Details: " + err.Error())
+		}
+
+		if !allowed {
+			return nil, ct.NewPermissionError("Using `" + h.prefixFor(args.GuildID) + command.Name + "` requires " +
+				describePermissionRule(h.permissionRule(command, args.GuildID)) + ".")
+		}
+
+		return next(args)
+	}
+}
+
+// isAllowed returns true if the user can use the command in the given guild and channel
+func (h *Handler) isAllowed(command *ct.Command, guildID, channelID, userID string) (bool, error) {
+
+	rule := h.permissionRule(command, guildID)
+
+	// Empty rule allows everyone
+	if rule.IsEmpty() {
+		return true, nil
+	}
+
+	// Check the users first, it doesn't require asking the transport
+	for _, allowedUserID := range rule.Users {
+		if allowedUserID == userID {
+			return true, nil
+		}
+	}
+
+	// Other criteria can only be met in a guild
+	if guildID == "" || (len(rule.Roles) == 0 && !rule.GuildOwner && rule.Permissions == 0) {
+		return false, nil
+	}
+
+	member, err := h.communicator.Transport().Member(guildID, channelID, userID)
+	if err != nil {
+		return false, err
+	}
+
+	if rule.GuildOwner && member.IsGuildOwner {
+		return true, nil
+	}
+
+	if rule.Permissions != 0 && member.Permissions&rule.Permissions == rule.Permissions {
+		return true, nil
+	}
+
+	// Roles can be given as IDs or names
+	for _, role := range member.Roles {
+		for _, allowedRole := range rule.Roles {
+			if allowedRole == role.ID || strings.EqualFold(allowedRole, role.Name) {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// permissionRule returns the rule that applies to the command in the guild - the one configured for the guild, the one configured
+// for all guilds or the one declared by the command, whichever is found first. Rules configured for a group apply to its
+// subcommands (see commandPath). Returns an empty rule if there is none.
+func (h *Handler) permissionRule(command *ct.Command, guildID string) ct.PermissionRule {
+
+	path := commandPath(command.Name)
+
+	for _, name := range path {
+		if rule, ok := h.permissions[guildID][name]; ok && guildID != "" {
+			return rule
+		}
+	}
+
+	for _, name := range path {
+		if rule, ok := h.permissions[allGuildsKey][name]; ok {
+			return rule
+		}
+	}
+
+	if command.Permissions != nil {
+		return *command.Permissions
+	}
+
+	return ct.PermissionRule{}
+}
+
+// describePermissionRule creates a user-friendly description of the rule, e.g. "role Moderators or the Manage Messages permission"
+func describePermissionRule(rule ct.PermissionRule) string {
+
+	var parts []string
+
+	if len(rule.Roles) > 0 {
+		parts = append(parts, "one of the roles: "+strings.Join(rule.Roles, ", "))
+	}
+
+	if rule.GuildOwner {
+		parts = append(parts, "owning the server")
+	}
+
+	if rule.Permissions != 0 {
+		parts = append(parts, "permissions: "+describePermissions(rule.Permissions))
+	}
+
+	if len(rule.Users) > 0 {
+		parts = append(parts, "being on the list of allowed users")
+	}
+
+	return strings.Join(parts, " or ")
+}
+
+// permissionNames contains names of the permissions most commonly used in rules
+var permissionNames = []struct {
+	bit  int64
+	name string
+}{
+	{dg.PermissionAdministrator, "Administrator"},
+	{dg.PermissionManageGuild, "Manage Server"},
+	{dg.PermissionManageChannels, "Manage Channels"},
+	{dg.PermissionManageRoles, "Manage Roles"},
+	{dg.PermissionManageMessages, "Manage Messages"},
+	{dg.PermissionKickMembers, "Kick Members"},
+	{dg.PermissionBanMembers, "Ban Members"},
+}
+
+// describePermissions returns names of the permission bits, bits without a known name are shown as numbers
+func describePermissions(permissions int64) string {
+
+	var names []string
+
+	for _, permission := range permissionNames {
+		if permissions&permission.bit != 0 {
+			names = append(names, permission.name)
+			permissions &^= permission.bit
+		}
+	}
+
+	if permissions != 0 {
+		names = append(names, strconv.FormatInt(permissions, 10))
+	}
+
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,201 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+
+	dg "github.com/bwmarrin/discordgo"
+	"github.com/generalkenobi/makrochatbot/communication"
+	ct "github.com/generalkenobi/makrochatbot/customtypes"
+)
+
+// permissionTestHandler creates a handler with the given configured rules, whose transport knows the members of "guild":
+// - owner owns the guild
+// - moderator has the role Moderators (ID "moderators-id")
+// - manager has the Manage Server and Manage Messages permissions
+// - cleaner has only the Manage Messages permission
+// - user has no roles and no permissions
+func permissionTestHandler(permissions map[string]map[string]ct.PermissionRule) *Handler {
+
+	transport := communication.NewMemoryTransport()
+
+	transport.SetMember("guild", "owner", communication.MemberInfo{IsGuildOwner: true})
+	transport.SetMember("guild", "moderator", communication.MemberInfo{Roles: []*dg.Role{{ID: "moderators-id", Name: "Moderators"}}})
+	transport.SetMember("guild", "manager", communication.MemberInfo{Permissions: dg.PermissionManageGuild | dg.PermissionManageMessages})
+	transport.SetMember("guild", "cleaner", communication.MemberInfo{Permissions: dg.PermissionManageMessages})
+
+	// In direct messages the transport would say the owner owns the "guild" - it must not be asked
+	transport.SetMember("", "owner", communication.MemberInfo{IsGuildOwner: true})
+
+	return &Handler{
+		communicator: communication.NewCommunicator(transport),
+		permissions:  permissions,
+	}
+}
+
+func TestIsAllowed(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		rule    ct.PermissionRule
+		guildID string
+		userID  string
+		allowed bool
+	}{
+		{name: "empty rule in guild", rule: ct.PermissionRule{}, guildID: "guild", userID: "user", allowed: true},
+		{name: "empty rule in direct messages", rule: ct.PermissionRule{}, guildID: "", userID: "user", allowed: true},
+		{name: "listed user", rule: ct.PermissionRule{Users: []string{"user"}}, guildID: "guild", userID: "user", allowed: true},
+		{name: "listed user in direct messages", rule: ct.PermissionRule{Users: []string{"user"}}, guildID: "", userID: "user", allowed: true},
+		{name: "user not listed", rule: ct.PermissionRule{Users: []string{"owner"}}, guildID: "guild", userID: "user", allowed: false},
+		{name: "owner", rule: ct.PermissionRule{GuildOwner: true}, guildID: "guild", userID: "owner", allowed: true},
+		{name: "not the owner", rule: ct.PermissionRule{GuildOwner: true}, guildID: "guild", userID: "manager", allowed: false},
+		{name: "permission", rule: ct.PermissionRule{Permissions: dg.PermissionManageMessages}, guildID: "guild", userID: "cleaner", allowed: true},
+		{
+			name:    "all permissions held",
+			rule:    ct.PermissionRule{Permissions: dg.PermissionManageGuild | dg.PermissionManageMessages},
+			guildID: "guild",
+			userID:  "manager",
+			allowed: true,
+		},
+		{
+			name:    "some permissions missing",
+			rule:    ct.PermissionRule{Permissions: dg.PermissionManageGuild | dg.PermissionManageMessages},
+			guildID: "guild",
+			userID:  "cleaner",
+			allowed: false,
+		},
+		{name: "role ID", rule: ct.PermissionRule{Roles: []string{"moderators-id"}}, guildID: "guild", userID: "moderator", allowed: true},
+		{name: "role name in other case", rule: ct.PermissionRule{Roles: []string{"moderators"}}, guildID: "guild", userID: "moderator", allowed: true},
+		{name: "other role", rule: ct.PermissionRule{Roles: []string{"Admins"}}, guildID: "guild", userID: "moderator", allowed: false},
+		{name: "no role", rule: ct.PermissionRule{Roles: []string{"Moderators"}}, guildID: "guild", userID: "user", allowed: false},
+		{
+			name:    "any criterion is enough",
+			rule:    ct.PermissionRule{Roles: []string{"Moderators"}, GuildOwner: true, Permissions: dg.PermissionManageGuild},
+			guildID: "guild",
+			userID:  "manager",
+			allowed: true,
+		},
+		{
+			name:    "none of the criteria met",
+			rule:    ct.PermissionRule{Users: []string{"owner"}, Roles: []string{"Moderators"}, Permissions: dg.PermissionManageGuild},
+			guildID: "guild",
+			userID:  "cleaner",
+			allowed: false,
+		},
+		{name: "owner in direct messages", rule: ct.PermissionRule{GuildOwner: true}, guildID: "", userID: "owner", allowed: false},
+		{
+			name:    "only listed users in direct messages",
+			rule:    ct.PermissionRule{Users: []string{"manager"}, GuildOwner: true},
+			guildID: "",
+			userID:  "owner",
+			allowed: false,
+		},
+	}
+
+	h := permissionTestHandler(nil)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			rule := test.rule
+			command := &ct.Command{Name: "roll", Permissions: &rule}
+
+			allowed, err := h.isAllowed(command, test.guildID, "channel", test.userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if allowed != test.allowed {
+				t.Errorf("isAllowed(%+v, %q, %q) = %v, expected %v", test.rule, test.guildID, test.userID, allowed, test.allowed)
+			}
+		})
+	}
+}
+
+func TestPermissionRule(t *testing.T) {
+
+	// Rules are told apart by the only user they allow
+	guildRule := ct.PermissionRule{Users: []string{"guild rule"}}
+	allGuildsRule := ct.PermissionRule{Users: []string{"all guilds rule"}}
+	declaredRule := ct.PermissionRule{Users: []string{"declared rule"}}
+
+	h := permissionTestHandler(map[string]map[string]ct.PermissionRule{
+		"guild":      {"roll": guildRule, "help": guildRule},
+		allGuildsKey: {"roll": allGuildsRule},
+		"":           {"roll": guildRule},
+	})
+
+	tests := []struct {
+		name    string
+		command ct.Command
+		guildID string
+		rule    ct.PermissionRule
+	}{
+		{name: "guild config", command: ct.Command{Name: "roll", Permissions: &declaredRule}, guildID: "guild", rule: guildRule},
+		{name: "config of all guilds", command: ct.Command{Name: "roll", Permissions: &declaredRule}, guildID: "other guild", rule: allGuildsRule},
+		{name: "direct messages use config of all guilds", command: ct.Command{Name: "roll"}, guildID: "", rule: allGuildsRule},
+		{name: "declared rule", command: ct.Command{Name: "prefix", Permissions: &declaredRule}, guildID: "guild", rule: declaredRule},
+		{name: "guild config of another command", command: ct.Command{Name: "help"}, guildID: "other guild", rule: ct.PermissionRule{}},
+		{name: "no rule", command: ct.Command{Name: "prefix"}, guildID: "guild", rule: ct.PermissionRule{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			if rule := h.permissionRule(&test.command, test.guildID); !reflect.DeepEqual(rule, test.rule) {
+				t.Errorf("permissionRule(%q, %q) = %+v, expected %+v", test.command.Name, test.guildID, rule, test.rule)
+			}
+		})
+	}
+}
+
+func TestPermissionRuleOfSubcommands(t *testing.T) {
+
+	groupRule := ct.PermissionRule{Users: []string{"group rule"}}
+	subcommandRule := ct.PermissionRule{Users: []string{"subcommand rule"}}
+	declaredRule := ct.PermissionRule{Users: []string{"declared rule"}}
+
+	// Subcommands inherit the rule declared by their group
+	group, err := prepareCommand(ct.Command{
+		Name:        "monitor",
+		Permissions: &declaredRule,
+		Subcommands: []ct.Command{
+			{Name: "add", Handler: func(*ct.CommandArgs) (*ct.Response, error) { return nil, nil }},
+			{Name: "list", Handler: func(*ct.CommandArgs) (*ct.Response, error) { return nil, nil }},
+		},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	add, list := &group.Subcommands[0], &group.Subcommands[1]
+
+	h := permissionTestHandler(map[string]map[string]ct.PermissionRule{
+		"guild":      {"monitor": groupRule},
+		"subguild":   {"monitor": groupRule, "monitor add": subcommandRule},
+		allGuildsKey: {"monitor add": subcommandRule},
+	})
+
+	tests := []struct {
+		name    string
+		command *ct.Command
+		guildID string
+		rule    ct.PermissionRule
+	}{
+		{name: "guild config of the group", command: list, guildID: "guild", rule: groupRule},
+		{name: "guild config of the group before config of all guilds", command: add, guildID: "guild", rule: groupRule},
+		{name: "guild config of the subcommand before the group", command: add, guildID: "subguild", rule: subcommandRule},
+		{name: "config of all guilds for the subcommand", command: add, guildID: "other guild", rule: subcommandRule},
+		{name: "declared rule of the group", command: list, guildID: "other guild", rule: declaredRule},
+		{name: "group itself", command: group, guildID: "other guild", rule: declaredRule},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			if rule := h.permissionRule(test.command, test.guildID); !reflect.DeepEqual(rule, test.rule) {
+				t.Errorf("permissionRule(%q, %q) = %+v, expected %+v", test.command.Name, test.guildID, rule, test.rule)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package handler
+
+import (
+	dg "github.com/bwmarrin/discordgo"
+	ct "github.com/generalkenobi/makrochatbot/customtypes"
+	"github.com/generalkenobi/makrochatbot/storage"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// AdministrationCategory is the category of built-in commands meant for guild admins
+const AdministrationCategory = "Administration"
+
+// maxPrefixLength is the maximum length (in characters) of a prefix set by a guild
+const maxPrefixLength = 10
+
+// AdminPermissionRule is the default permission rule of administrative commands - they can be used by the owner of the guild
+// and members with the Manage Server permission
+var AdminPermissionRule = &ct.PermissionRule{
+	GuildOwner:  true,
+	Permissions: dg.PermissionManageGuild,
+}
+
+// prefixCommands returns the built-in commands for querying and changing the prefix of the guild
+func (h *Handler) prefixCommands() []ct.Command {
+	return []ct.Command{
+		{
+			Name:        "prefix",
+			Description: "Shows the command prefix used on this server",
+			Category:    GeneralCategory,
+			Handler:     h.prefix,
+		},
+		{
+			Name:        "setprefix",
+			Description: "Changes the command prefix used on this server",
+			Arguments: []ct.ArgumentSpec{
+				{Name: "prefix", Description: "New prefix, up to " + strconv.Itoa(maxPrefixLength) + " characters without spaces"},
+			},
+			Examples:    []string{"setprefix ?", "setprefix mb!"},
+			Category:    AdministrationCategory,
+			Permissions: AdminPermissionRule,
+			GuildOnly:   true,
+			Handler:     h.setPrefix,
+		},
+	}
+}
+
+// prefix is the handler of the prefix command. It shows the prefix used in the guild.
+func (h *Handler) prefix(args *ct.CommandArgs) (*ct.Response, error) {
+
+	prefix := h.prefixFor(args.GuildID)
+
+	message := &dg.MessageSend{
+		Content: "The command prefix here is `" + prefix + "`, e.g. `" + prefix + "help`.",
+	}
+
+	return ct.MessageResponse(message), nil
+}
+
+// setPrefix is the handler of the setprefix command. It changes the prefix of the guild and saves it. The command is guild-only.
+// User arguments:
+// 1 - prefix, the new prefix. Setting the default prefix removes the guild's own prefix.
+func (h *Handler) setPrefix(args *ct.CommandArgs) (*ct.Response, error) {
+
+	prefix := args.String("prefix")
+
+	// Make sure the prefix can be typed and recognized
+	if len([]rune(prefix)) > maxPrefixLength || strings.IndexFunc(prefix, unicode.IsSpace) >= 0 || prefix == IllegalPrefix {
+		return nil, ct.NewUserError("The prefix must have from 1 to " + strconv.Itoa(maxPrefixLength) + " characters and can't contain spaces.")
+	}
+
+	// The default prefix doesn't need to be stored
+	storedPrefix := prefix
+	if prefix == h.defaultPrefix {
+		storedPrefix = ""
+	}
+
+	if err := h.store.UpdateGuild(args.GuildID, func(settings *storage.GuildSettings) { settings.Prefix = storedPrefix }); err != nil {
+		return nil, err
+	}
+
+	message := &dg.MessageSend{
+		Content: "The command prefix is now `" + prefix + "`, e.g. `" + prefix + "help`.",
+	}
+
+	return ct.MessageResponse(message), nil
+}
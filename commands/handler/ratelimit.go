@@ -0,0 +1,175 @@
+package handler
+
+import (
+	ct "github.com/generalkenobi/makrochatbot/customtypes"
+	"github.com/generalkenobi/makrochatbot/ratelimit"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultRateLimitsKey is the key in ct.Config.RateLimits under which limits applying to all commands are configured
+const defaultRateLimitsKey = "*"
+
+// commandLimiters holds the limiters of one command, nil limiters allow everything
+type commandLimiters struct {
+	user    *ratelimit.Limiter
+	channel *ratelimit.Limiter
+	guild   *ratelimit.Limiter
+}
+
+// limitCheck is a limiter together with the key that should be checked in it
+type limitCheck struct {
+	limiter *ratelimit.Limiter
+	key     string
+}
+
+// rateLimiter limits how often commands can be used, according to the configuration
+type rateLimiter struct {
+
+	// config is the configuration of limits, key is the command name (or defaultRateLimitsKey)
+	config map[string]ct.CommandRateLimits
+
+	// limiters of each command, created when the command is first used. Key is the command name.
+	limiters map[string]*commandLimiters
+
+	// notified holds, for each limited key, the time until which the user doesn't need to be told about the limit again
+	notified map[string]time.Time
+
+	// mutex is used to synchronize access to limiters and notified and to check and take tokens atomically
+	mutex sync.Mutex
+}
+
+// newRateLimiter creates a rate limiter using the given configuration
+func newRateLimiter(config map[string]ct.CommandRateLimits) *rateLimiter {
+	return &rateLimiter{
+		config:   config,
+		limiters: make(map[string]*commandLimiters),
+		notified: make(map[string]time.Time),
+	}
+}
+
+// RateLimitMiddleware prevents the command from running if it's used too often by the user, in the channel or in the guild,
+// according to ct.Config.RateLimits. The first rejected user is politely asked to slow down, further rejections in the same
+// window are silent.
+func (h *Handler) RateLimitMiddleware(command *ct.Command, next ct.CommandHandler) ct.CommandHandler {
+
+	return func(args *ct.CommandArgs) (*ct.Response, error) {
+
+		// Check the limits and take a use from all of them
+		limitedKey, wait := h.rateLimiter.allow(command.Name, command.RateLimits, args)
+
+		if wait == 0 {
+			return next(args)
+		}
+
+		// Limit was exceeded, tell the user about it but only once per window
+		if !h.rateLimiter.shouldNotify(limitedKey, wait) {
+			return nil, ct.NewSilentError("Rate limit of \"" + command.Name + "\" exceeded: " + limitedKey)
+		}
+
+		seconds := strconv.Itoa(int(math.Ceil(wait.Seconds())))
+		return nil, ct.NewUserError("Slow down! You can use `" + h.prefixFor(args.GuildID) + command.Name + "` again in " + seconds + "s.")
+	}
+}
+
+// allow checks all limits of the command (defaults are the limits declared by the command, may be nil). If none is exceeded, takes a use from each of them and returns 0 wait.
+// Otherwise returns the key of the exceeded limit and the time after which the command can be used again.
+func (r *rateLimiter) allow(commandName string, defaults *ct.CommandRateLimits, args *ct.CommandArgs) (string, time.Duration) {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	limiters := r.commandLimiters(commandName, defaults)
+
+	// Limits to check, guild limit doesn't apply to direct messages
+	checks := []limitCheck{
+		{limiters.user, commandName + "/user/" + args.UserID},
+		{limiters.channel, commandName + "/channel/" + args.ChannelID},
+	}
+
+	if args.GuildID != "" {
+		checks = append(checks, limitCheck{limiters.guild, commandName + "/guild/" + args.GuildID})
+	}
+
+	// First make sure that no limit is exceeded, so that rejected uses don't take tokens
+	for _, check := range checks {
+		if wait := check.limiter.Wait(check.key); wait > 0 {
+			return check.key, wait
+		}
+	}
+
+	for _, check := range checks {
+		check.limiter.Take(check.key)
+	}
+
+	return "", 0
+}
+
+// shouldNotify returns true if the user should be told that the limit under the key was exceeded - i.e. if they weren't told
+// about it in the current window. wait is the time until the limit allows the command again.
+func (r *rateLimiter) shouldNotify(key string, wait time.Duration) bool {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+
+	if now.Before(r.notified[key]) {
+		return false
+	}
+
+	// Don't notify again until the limit allows the command
+	r.notified[key] = now.Add(wait)
+
+	// Remove expired entries, so that the map doesn't grow forever
+	for notifiedKey, until := range r.notified {
+		if now.After(until) {
+			delete(r.notified, notifiedKey)
+		}
+	}
+
+	return true
+}
+
+// commandLimiters returns the limiters of the command, creating them if needed. Mutex has to be held by the caller.
+// Limits are taken from the configuration of the command (or its group), if there is none then from limits declared by the
+// command (defaults) and if there are none either then from the configuration applying to all commands.
+func (r *rateLimiter) commandLimiters(commandName string, defaults *ct.CommandRateLimits) *commandLimiters {
+
+	if limiters, ok := r.limiters[commandName]; ok {
+		return limiters
+	}
+
+	var config ct.CommandRateLimits
+	ok := false
+
+	for _, name := range commandPath(commandName) {
+		if config, ok = r.config[name]; ok {
+			break
+		}
+	}
+
+	if !ok {
+		if defaults != nil {
+			config = *defaults
+		} else {
+			config = r.config[defaultRateLimitsKey]
+		}
+	}
+
+	limiters := &commandLimiters{
+		user:    newLimiter(config.PerUser),
+		channel: newLimiter(config.PerChannel),
+		guild:   newLimiter(config.PerGuild),
+	}
+
+	r.limiters[commandName] = limiters
+	return limiters
+}
+
+// newLimiter creates a limiter for the configured limit, nil if the limit is not set
+func newLimiter(limit ct.RateLimit) *ratelimit.Limiter {
+	return ratelimit.New(limit.Count, time.Duration(limit.Seconds)*time.Second)
+}
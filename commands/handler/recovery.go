@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	dg "github.com/bwmarrin/discordgo"
+	"github.com/generalkenobi/makrochatbot/logger"
+	"runtime/debug"
+	"strconv"
+)
+
+// dispatcherCrashKey is the key in crash counts used for panics that happened before a command was recognized or outside of
+// commands (e.g. while handling a reaction)
+const dispatcherCrashKey = "(dispatcher)"
+
+// recoverCommand handles a panic that happened while handling a message. It has to be deferred directly (recover only works
+// in deferred functions). commandName is the name of the command being run - it's empty if the panic happened before the command
+// was recognized. guildID is used to show the right prefix and responder delivers the apology to the user.
+// The panic is logged with a stack trace, counted and the user gets an apology with an ID that can be found in the log.
+func (h *Handler) recoverCommand(guildID string, commandName *string, responder *responder) {
+
+	value := recover()
+
+	// Nothing to do if there was no panic
+	if value == nil {
+		return
+	}
+
+	h.handlePanic(value, guildID, *commandName, responder)
+}
+
+// recoverDispatcher handles a panic that happened outside of a command, e.g. while handling a reaction or deleting responses.
+// It has to be deferred directly, like recoverCommand. The panic is logged and counted, nobody is told about it.
+func (h *Handler) recoverDispatcher() {
+
+	if value := recover(); value != nil {
+		h.handlePanic(value, "", "", nil)
+	}
+}
+
+// runOutsidePool runs the job in a new goroutine instead of a worker, recovering from panics like the workers do. Stop waits for
+// the job to finish. poolMutex has to be held for reading by the caller, so that the job can't start while Stop is waiting.
+func (h *Handler) runOutsidePool(job func()) {
+
+	h.detached.Add(1)
+
+	go func() {
+		defer h.detached.Done()
+		defer h.recoverDispatcher()
+		job()
+	}()
+}
+
+// handlePanic logs the panic value with a stack trace and counts the crash. If commandName is not empty, the user gets an
+// apology with an ID that can be found in the log (see recoverCommand). It has to be called while the panic is being recovered,
+// so that the stack trace shows where it happened.
+func (h *Handler) handlePanic(value interface{}, guildID, commandName string, responder *responder) {
+
+	// Count the crash for diagnostics
+	crashKey := commandName
+	if crashKey == "" {
+		crashKey = dispatcherCrashKey
+	}
+
+	crashCount := h.countCrash(crashKey)
+
+	// Log the panic with the stack trace
+	correlationID := newCorrelationID()
+	logger.LogError(errors.New("[" + correlationID + "] Panic in " + crashKey + " (crash #" + strconv.Itoa(crashCount) + "): " +
+		fmt.Sprint(value) + "\n" + string(debug.Stack())))
+
+	// Apologize to the user, if they invoked a command
+	if commandName != "" {
+		responder.reply(&dg.MessageSend{
+			Content: "Sorry, something went wrong while running `" + h.prefixFor(guildID) + commandName + "`. " +
+				"If the problem persists, report it and mention error ID `" + correlationID + "`.",
+			Flags: dg.MessageFlagsEphemeral,
+		})
+	}
+}
+
+// countCrash increments the crash counter of the given command and returns the new count
+func (h *Handler) countCrash(commandName string) int {
+
+	h.crashesMutex.Lock()
+	defer h.crashesMutex.Unlock()
+
+	h.crashes[commandName]++
+	return h.crashes[commandName]
+}
+
+// CrashCounts returns the number of panics caught for each command since the handler was created. Key is the command name,
+// panics that happened before a command was recognized or outside of commands are counted under "(dispatcher)".
+func (h *Handler) CrashCounts() map[string]int {
+
+	h.crashesMutex.Lock()
+	defer h.crashesMutex.Unlock()
+
+	counts := make(map[string]int, len(h.crashes))
+	for name, count := range h.crashes {
+		counts[name] = count
+	}
+
+	return counts
+}
@@ -0,0 +1,363 @@
+package handler
+
+import (
+	dg "github.com/bwmarrin/discordgo"
+	"github.com/generalkenobi/makrochatbot/communication"
+	ct "github.com/generalkenobi/makrochatbot/customtypes"
+)
+
+// responder delivers messages to the user who invoked a command - to the channel in which the command was typed or as
+// responses to the slash command. It is used by one invocation, so it's not safe for concurrent use.
+type responder struct {
+
+	// communicator is used to send the messages
+	communicator *communication.Communicator
+
+	// paginator switches pages of paginated messages
+	paginator *paginator
+
+	// guildID, channelID and userID describe where and by whom the command was invoked
+	guildID   string
+	channelID string
+	userID    string
+
+	// messageID is the ID of the message with the command, empty for slash commands
+	messageID string
+
+	// interaction is the use of the slash command, nil for typed commands
+	interaction *dg.Interaction
+
+	// responded is true if the interaction was already responded to, further messages are sent as follow-ups
+	responded bool
+
+	// deferred is true if the interaction was acknowledged (see acknowledge) and the acknowledgement is waiting to be replaced
+	// by the response. deferredEphemeral tells whether the acknowledgement is ephemeral.
+	deferred          bool
+	deferredEphemeral bool
+
+	// previous are the messages sent by the previous run of the command (before its message was edited) that were not reused yet
+	previous []sentMessage
+
+	// sent are the messages sent (or reused) by this run of the command, in order
+	sent []sentMessage
+}
+
+// messageResponder creates a responder for a command typed in the message. previous are the messages sent when the command was
+// run before its message was edited, they are edited instead of sending new messages (see send).
+func (h *Handler) messageResponder(message *dg.Message, previous []sentMessage) *responder {
+	return &responder{
+		communicator: h.communicator,
+		paginator:    h.paginator,
+		guildID:      message.GuildID,
+		channelID:    message.ChannelID,
+		userID:       message.Author.ID,
+		messageID:    message.ID,
+		previous:     append([]sentMessage{}, previous...),
+	}
+}
+
+// interactionResponder creates a responder for the use of a slash command
+func (h *Handler) interactionResponder(interaction *dg.Interaction) *responder {
+
+	r := &responder{
+		communicator: h.communicator,
+		paginator:    h.paginator,
+		guildID:      interaction.GuildID,
+		channelID:    interaction.ChannelID,
+		interaction:  interaction,
+	}
+
+	// In guilds the user is a member, in direct messages only the user is known
+	if interaction.Member != nil && interaction.Member.User != nil {
+		r.userID = interaction.Member.User.ID
+	} else if interaction.User != nil {
+		r.userID = interaction.User.ID
+	}
+
+	return r
+}
+
+// reply sends the message to the channel of the typed command or as a response to the slash command. Only responses to
+// interactions can be ephemeral, so in channels ephemeral messages are sent as normal ones.
+// Returns the sent message, nil if sending failed or if the message is the response to an interaction that wasn't acknowledged
+// (see communication.Communicator.InteractionResponse).
+func (r *responder) reply(message *dg.MessageSend) *dg.Message {
+
+	if r.interaction == nil {
+		message.Flags &^= dg.MessageFlagsEphemeral
+		return r.send(message, false)
+	}
+
+	// Each interaction can be responded to only once, other messages are follow-ups
+	if !r.responded {
+		r.responded = true
+
+		if r.deferred {
+			return r.replaceAcknowledgement(message)
+		}
+
+		r.communicator.RespondToInteraction(r.interaction, message)
+		return nil
+	}
+
+	return r.communicator.FollowUpInteraction(r.interaction, message)
+}
+
+// acknowledge tells Discord that the interaction will be responded to later (see communication.Transport.DeferInteraction),
+// the first reply then replaces the acknowledgement. The acknowledgement is ephemeral if ephemeral is true.
+// If acknowledging fails, the interaction is responded to as usual.
+func (r *responder) acknowledge(ephemeral bool) {
+	r.deferred = r.communicator.DeferInteraction(r.interaction, ephemeral)
+	r.deferredEphemeral = ephemeral
+}
+
+// replaceAcknowledgement replaces the acknowledgement of the interaction with the first reply. Visibility of the acknowledgement
+// can't be changed, so if the reply should be visible to others (or only to the user) and the acknowledgement isn't, the
+// acknowledgement is deleted and the reply is sent as a follow-up instead. Returns the sent message, nil if sending failed.
+func (r *responder) replaceAcknowledgement(message *dg.MessageSend) *dg.Message {
+
+	r.deferred = false
+
+	if (message.Flags&dg.MessageFlagsEphemeral != 0) == r.deferredEphemeral {
+		return r.communicator.EditInteractionResponse(r.interaction, message)
+	}
+
+	r.communicator.DeleteInteractionResponse(r.interaction)
+	return r.communicator.FollowUpInteraction(r.interaction, message)
+}
+
+// deliver sends all messages of the response to their targets, in order (see ct.ResponseTarget).
+// Targets that don't exist for slash commands (replies and reactions) are replaced by responses to the interaction.
+func (r *responder) deliver(response *ct.Response) {
+
+	if response == nil {
+		return
+	}
+
+	for _, responseMessage := range response.Messages {
+
+		if len(responseMessage.Pages) > 1 {
+			r.deliverPages(responseMessage.Target, responseMessage.Pages)
+		} else {
+			r.deliverMessage(responseMessage)
+		}
+	}
+}
+
+// deliverMessage sends the message to its target. Returns the sent message, nil if it's not known (see reply).
+func (r *responder) deliverMessage(responseMessage ct.ResponseMessage) *dg.Message {
+
+	message := responseMessage.Message
+
+	// Reactions are the only target without a message
+	if message == nil && responseMessage.Target != ct.ReactionTarget {
+		return nil
+	}
+
+	switch responseMessage.Target {
+
+	case ct.ChannelTarget:
+		{
+			return r.reply(message)
+		}
+
+	case ct.ReplyTarget:
+		{
+			r.setReference(message)
+			return r.reply(message)
+		}
+
+	case ct.DirectMessageTarget:
+		{
+			return r.directMessage(message)
+		}
+
+	case ct.EphemeralTarget:
+		{
+			// Typed commands can't be answered privately in the channel, a direct message is the closest thing
+			if r.interaction == nil {
+				return r.directMessage(message)
+			}
+
+			message.Flags |= dg.MessageFlagsEphemeral
+			return r.reply(message)
+		}
+
+	case ct.ReactionTarget:
+		{
+			if r.interaction == nil {
+				r.react(responseMessage.Reaction)
+				return nil
+			}
+
+			return r.reply(&dg.MessageSend{Content: responseMessage.Reaction, Flags: dg.MessageFlagsEphemeral})
+		}
+	}
+
+	return nil
+}
+
+// deliverPages sends the first page to the target and lets the user who invoked the command switch pages (see paginator).
+// Reactions can't be added to ephemeral responses to interactions, so such responses get all pages at once.
+func (r *responder) deliverPages(target ct.ResponseTarget, pages []*dg.MessageSend) {
+
+	direct := target == ct.DirectMessageTarget || (target == ct.EphemeralTarget && r.interaction == nil)
+	viaInteraction := r.interaction != nil && !direct
+
+	if viaInteraction && target == ct.EphemeralTarget {
+		for _, page := range pages {
+			r.deliverMessage(ct.ResponseMessage{Target: target, Message: page})
+		}
+
+		return
+	}
+
+	var sent *dg.Message
+	if direct {
+		sent = r.directMessage(pages[0])
+	} else {
+
+		if target == ct.ReplyTarget {
+			r.setReference(pages[0])
+		}
+
+		sent = r.prompt(pages[0])
+	}
+
+	if sent == nil {
+		return
+	}
+
+	pagination := &pagination{
+		pages:     pages,
+		userID:    r.userID,
+		channelID: sent.ChannelID,
+		messageID: sent.ID,
+		inGuild:   r.guildID != "" && !direct,
+	}
+
+	if viaInteraction {
+		pagination.interaction = r.interaction
+	}
+
+	r.paginator.start(pagination)
+}
+
+// setReference makes the message a reply to the message with the command. Slash commands have no such message, their messages
+// are not changed.
+func (r *responder) setReference(message *dg.MessageSend) {
+	if r.interaction == nil {
+		message.Reference = &dg.MessageReference{MessageID: r.messageID, ChannelID: r.channelID, GuildID: r.guildID}
+	}
+}
+
+// prompt sends the message like reply, but returns the sent message even if it's the response to the interaction
+// (nil if sending failed)
+func (r *responder) prompt(message *dg.MessageSend) *dg.Message {
+
+	// The response to an interaction that wasn't acknowledged has to be requested, replacing an acknowledgement returns it
+	requestResponse := r.interaction != nil && !r.responded && !r.deferred
+
+	sent := r.reply(message)
+
+	if requestResponse {
+		sent = r.communicator.InteractionResponse(r.interaction)
+	}
+
+	return sent
+}
+
+// directMessage sends the message directly to the user who invoked the command. Returns the sent message, nil if sending failed.
+func (r *responder) directMessage(message *dg.MessageSend) *dg.Message {
+	message.Flags &^= dg.MessageFlagsEphemeral
+	return r.send(message, true)
+}
+
+// send sends the message to the channel of the command or, if direct is true, directly to the user. If the previous run of the
+// command sent a message to the same place, that message is edited instead, so that users see the output of the edited command
+// where they saw the old one. Returns the sent message, nil if sending failed.
+func (r *responder) send(message *dg.MessageSend, direct bool) *dg.Message {
+
+	var sent *dg.Message
+
+	if previous, ok := r.takePrevious(direct); ok {
+
+		// The old pages of the message are not valid anymore
+		if r.paginator.stop(previous.messageID) {
+			r.paginator.removeReactions(previous.channelID, previous.messageID)
+		}
+
+		sent = r.communicator.EditMessage(previous.channelID, previous.messageID, message)
+	}
+
+	// There was nothing to edit or editing failed, e.g. because the message was deleted in the meantime
+	if sent == nil {
+		if direct {
+			sent = r.communicator.SendToUser(r.userID, message)
+		} else {
+			sent = r.communicator.SendToChannel(r.channelID, message)
+		}
+	}
+
+	if sent != nil {
+		r.sent = append(r.sent, sentMessage{channelID: sent.ChannelID, messageID: sent.ID, direct: direct})
+	}
+
+	return sent
+}
+
+// react adds the reaction to the message with the command. If the previous run of the command added the same reaction, it's
+// kept as it is - removing it with the unused responses would remove it for good.
+func (r *responder) react(emoji string) {
+
+	if !r.takePreviousReaction(emoji) {
+		r.communicator.AddReaction(r.channelID, r.messageID, emoji)
+	}
+
+	r.sent = append(r.sent, sentMessage{channelID: r.channelID, messageID: r.messageID, reaction: emoji})
+}
+
+// takePreviousReaction removes the reaction from the previous responses. Returns false if the previous run didn't add it.
+func (r *responder) takePreviousReaction(emoji string) bool {
+
+	for i, previous := range r.previous {
+		if previous.reaction == emoji && emoji != "" {
+			r.previous = append(r.previous[:i:i], r.previous[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// takePrevious removes the first of the previous messages sent to the same place (see send) and returns it.
+// Returns false if there is no such message.
+func (r *responder) takePrevious(direct bool) (sentMessage, bool) {
+
+	for i, previous := range r.previous {
+		if previous.reaction == "" && previous.direct == direct {
+			r.previous = append(r.previous[:i:i], r.previous[i+1:]...)
+			return previous, true
+		}
+	}
+
+	return sentMessage{}, false
+}
+
+// deleteUnused deletes the previous messages and removes the previous reactions that were not reused, the edited command
+// doesn't produce them anymore
+func (r *responder) deleteUnused() {
+
+	for _, previous := range r.previous {
+
+		if previous.reaction != "" {
+			r.communicator.RemoveReaction(previous.channelID, previous.messageID, previous.reaction, r.communicator.Transport().BotUserID())
+			continue
+		}
+
+		r.paginator.stop(previous.messageID)
+		r.communicator.DeleteMessage(previous.channelID, previous.messageID)
+	}
+
+	r.previous = nil
+}
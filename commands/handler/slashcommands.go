@@ -0,0 +1,490 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	dg "github.com/bwmarrin/discordgo"
+	"github.com/generalkenobi/makrochatbot/audit"
+	ct "github.com/generalkenobi/makrochatbot/customtypes"
+	"github.com/generalkenobi/makrochatbot/logger"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Limits of application commands imposed by Discord
+const (
+	// maxSlashDescriptionLength is the maximum length of descriptions of commands and options
+	maxSlashDescriptionLength = 100
+
+	// maxSlashChoices is the maximum number of choices of an option
+	maxSlashChoices = 25
+
+	// maxSlashDepth is the maximum depth of subcommands - a command can have groups of subcommands but they can't be nested deeper
+	maxSlashDepth = 2
+)
+
+// slashNameRegex matches names that can be used for application commands and their options
+var slashNameRegex = regexp.MustCompile(`^[-_\p{Ll}\p{N}]{1,32}$`)
+
+// ApplicationCommands returns the registered commands as Discord application (slash) commands, built from their metadata and
+// argument declarations. Commands whose names can't be used for application commands are skipped.
+func (h *Handler) ApplicationCommands() []*dg.ApplicationCommand {
+
+	var applicationCommands []*dg.ApplicationCommand
+
+	for _, command := range h.getCommands() {
+
+		applicationCommand, err := applicationCommand(command)
+
+		if err != nil {
+			logger.LogError(errors.New("Command \"" + command.Name + "\" can't be published as a slash command. Details: " + err.Error()))
+			continue
+		}
+
+		applicationCommands = append(applicationCommands, applicationCommand)
+	}
+
+	return applicationCommands
+}
+
+// applicationCommand creates the application command corresponding to the command. Each declared argument becomes an option,
+// subcommands become subcommand options.
+func applicationCommand(command *ct.Command) (*dg.ApplicationCommand, error) {
+
+	name := strings.ToLower(command.Name)
+	if !slashNameRegex.MatchString(name) {
+		return nil, errors.New("name \"" + name + "\" is not allowed")
+	}
+
+	options, err := applicationCommandOptions(command, 0)
+
+	if err != nil {
+		return nil, err
+	}
+
+	applicationCommand := &dg.ApplicationCommand{
+		Name:        name,
+		Type:        dg.ChatApplicationCommand,
+		Description: slashDescription(command.Description),
+		Options:     options,
+	}
+
+	// Discord hides guild-only commands in direct messages. It can't hide single subcommands, guild-only subcommands of other
+	// groups are rejected by the handler when they are used there.
+	if command.GuildOnly {
+		dmPermission := false
+		applicationCommand.DMPermission = &dmPermission
+	}
+
+	return applicationCommand, nil
+}
+
+// applicationCommandOptions creates the options of the command at the given depth (0 for top level commands). Options of groups
+// are their subcommands - Discord doesn't allow groups to take arguments, so they can only be used with a subcommand.
+func applicationCommandOptions(command *ct.Command, depth int) ([]*dg.ApplicationCommandOption, error) {
+
+	var options []*dg.ApplicationCommandOption
+
+	if len(command.Subcommands) == 0 {
+
+		for _, spec := range command.Arguments {
+
+			if !slashNameRegex.MatchString(spec.Name) {
+				return nil, errors.New("argument name \"" + spec.Name + "\" is not allowed")
+			}
+
+			options = append(options, applicationCommandOption(spec))
+		}
+
+		return options, nil
+	}
+
+	if depth >= maxSlashDepth {
+		return nil, errors.New("subcommands of \"" + command.Name + "\" are nested too deep")
+	}
+
+	for i := range command.Subcommands {
+
+		subcommand := &command.Subcommands[i]
+
+		name := strings.ToLower(localName(subcommand))
+		if !slashNameRegex.MatchString(name) {
+			return nil, errors.New("subcommand name \"" + name + "\" is not allowed")
+		}
+
+		subcommandOptions, err := applicationCommandOptions(subcommand, depth+1)
+
+		if err != nil {
+			return nil, err
+		}
+
+		// Subcommands that have subcommands of their own are groups
+		optionType := dg.ApplicationCommandOptionSubCommand
+		if len(subcommand.Subcommands) > 0 {
+			optionType = dg.ApplicationCommandOptionSubCommandGroup
+		}
+
+		options = append(options, &dg.ApplicationCommandOption{
+			Type:        optionType,
+			Name:        name,
+			Description: slashDescription(subcommand.Description),
+			Options:     subcommandOptions,
+		})
+	}
+
+	return options, nil
+}
+
+// applicationCommandOption creates the option corresponding to the argument. Values are validated by the handler when the command
+// is invoked, options only help the user to provide the right ones.
+func applicationCommandOption(spec ct.ArgumentSpec) *dg.ApplicationCommandOption {
+
+	option := &dg.ApplicationCommandOption{
+		Type:        dg.ApplicationCommandOptionString,
+		Name:        spec.Name,
+		Description: slashDescription(spec.Description),
+		Required:    !spec.Optional,
+	}
+
+	switch spec.Type {
+
+	case ct.IntArgument:
+		{
+			// Variadic arguments take many numbers, which can only be typed as text
+			if spec.Variadic {
+				break
+			}
+
+			option.Type = dg.ApplicationCommandOptionInteger
+
+			// Only bounds that are set are sent to Discord, 0 means no bound (see ct.ArgumentSpec.Min). The handler still checks the
+			// minimum of 0 of arguments that have only a maximum (see inRange).
+			if spec.Min != 0 {
+				min := float64(spec.Min)
+				option.MinValue = &min
+			}
+
+			if spec.Max != 0 {
+				option.MaxValue = float64(spec.Max)
+			}
+		}
+
+	case ct.EnumArgument:
+		{
+			// Discord limits the number of choices, if there are more the user has to type the value
+			if spec.Variadic || len(spec.Choices) > maxSlashChoices {
+				break
+			}
+
+			for _, choice := range spec.Choices {
+				option.Choices = append(option.Choices, &dg.ApplicationCommandOptionChoice{Name: choice, Value: choice})
+			}
+		}
+
+	case ct.UserArgument:
+		{
+			if !spec.Variadic {
+				option.Type = dg.ApplicationCommandOptionUser
+			}
+		}
+	}
+
+	return option
+}
+
+// slashDescription makes the description fit the limits of Discord - it can't be empty or too long
+func slashDescription(description string) string {
+
+	if description == "" {
+		return "No description"
+	}
+
+	if runes := []rune(description); len(runes) > maxSlashDescriptionLength {
+		return string(runes[:maxSlashDescriptionLength-3]) + "..."
+	}
+
+	return description
+}
+
+// HandleInteraction is a handler for incoming interactions, it is hooked into the transport (see communication.Transport.OnInteraction).
+// Uses of slash commands are acknowledged right away, Discord rejects responses to interactions that weren't acknowledged within
+// 3 seconds. Then they are queued to be run by workers, together with commands typed in the same channel. Other interactions
+// are ignored.
+func (h *Handler) HandleInteraction(interaction *dg.Interaction) {
+
+	if interaction == nil || interaction.Type != dg.InteractionApplicationCommand {
+		return
+	}
+
+	h.poolMutex.RLock()
+	defer h.poolMutex.RUnlock()
+
+	// Ignore interactions if the handler is not running
+	if h.pool == nil {
+		return
+	}
+
+	command, _, ok := h.interactionCommand(interaction.ApplicationCommandData())
+
+	// The visibility of the acknowledgement can't be changed later, so it's guessed from the command. Unknown commands and
+	// groups without a handler are answered ephemerally by runInteraction.
+	responder := h.interactionResponder(interaction)
+	responder.acknowledge(!ok || command.Handler == nil || command.EphemeralResponse)
+
+	// Interactive commands wait for answers, so they can't hold up other commands in the channel
+	if ok && command.Interactive {
+		h.runOutsidePool(func() { h.runInteraction(interaction, responder) })
+		return
+	}
+
+	// Interactions have to be responded to, so unlike dropped messages each dropped interaction gets a notice
+	if !h.pool.submit(interaction.ChannelID, func() { h.runInteraction(interaction, responder) }) {
+		go responder.reply(&dg.MessageSend{
+			Content: "I'm too busy right now. Please try again in a moment.",
+			Flags:   dg.MessageFlagsEphemeral,
+		})
+	}
+}
+
+// runInteraction is a helper function to HandleInteraction. It runs the used slash command and responds to the interaction with
+// the responder created (and acknowledged) by HandleInteraction. Panics are recovered, so that a failing command can't take
+// the whole bot down.
+func (h *Handler) runInteraction(interaction *dg.Interaction, responder *responder) {
+
+	// Name of the recognized command, used when recovering from a panic
+	var commandName string
+
+	defer h.recoverCommand(interaction.GuildID, &commandName, responder)
+
+	data := interaction.ApplicationCommandData()
+
+	command, options, ok := h.interactionCommand(data)
+	if !ok {
+		// Commands published earlier may have been removed since then
+		responder.reply(&dg.MessageSend{Content: "This command is no longer available.", Flags: dg.MessageFlagsEphemeral})
+		return
+	}
+
+	commandName = command.Name
+
+	// Groups without a handler can't be run, show what they contain instead
+	if command.Handler == nil {
+		help := h.groupHelp(command, "", interaction.GuildID)
+		help.Flags = dg.MessageFlagsEphemeral
+
+		responder.reply(help)
+		return
+	}
+
+	// In guilds the user is a member, in direct messages only the user is known
+	user := interaction.User
+	if interaction.Member != nil && interaction.Member.User != nil {
+		user = interaction.Member.User
+	}
+
+	if user == nil {
+		responder.reply(&dg.MessageSend{Content: "I don't know who you are.", Flags: dg.MessageFlagsEphemeral})
+		return
+	}
+
+	// Convert the options to arguments
+	userArgs, parsedArgs, err := parseOptions(command.Arguments, options)
+
+	if err != nil {
+
+		// The options couldn't be converted, the log gets their values as they were given
+		var values []string
+		for _, option := range options {
+			values = append(values, optionValue(option))
+		}
+
+		h.auditRejection(command, &ct.CommandArgs{
+			Username:  user.Username,
+			UserID:    user.ID,
+			GuildID:   interaction.GuildID,
+			ChannelID: interaction.ChannelID,
+			UserArgs:  values,
+		}, audit.ErrorClassUser)
+		h.reportError(interaction.GuildID, command.Name, ct.NewUserError(err.Error()), responder)
+		return
+	}
+
+	args := ct.CommandArgs{
+		CommandName:   command.Name,
+		Username:      user.Username,
+		UserID:        user.ID,
+		GuildID:       interaction.GuildID,
+		ChannelID:     interaction.ChannelID,
+		InteractionID: interaction.ID,
+		UserArgs:      userArgs,
+		RawArgs:       strings.Join(userArgs, " "),
+		ParsedArgs:    parsedArgs,
+		Source:        ct.SlashCommandInvocation}
+
+	// Members are only sent with interactions in guilds
+	if interaction.Member != nil {
+		args.MemberRoles = interaction.Member.Roles
+	}
+
+	// Users, roles and attachments chosen in options are sent separately from the options. They are sorted by ID, so that their
+	// order doesn't change between runs.
+	if resolved := data.Resolved; resolved != nil {
+
+		for _, user := range resolved.Users {
+			args.MentionedUsers = append(args.MentionedUsers, user)
+		}
+		sort.Slice(args.MentionedUsers, func(i, j int) bool { return args.MentionedUsers[i].ID < args.MentionedUsers[j].ID })
+
+		for roleID := range resolved.Roles {
+			args.MentionedRoles = append(args.MentionedRoles, roleID)
+		}
+		sort.Strings(args.MentionedRoles)
+
+		for _, attachment := range resolved.Attachments {
+			args.Attachments = append(args.Attachments, attachment)
+		}
+		sort.Slice(args.Attachments, func(i, j int) bool { return args.Attachments[i].ID < args.Attachments[j].ID })
+	}
+
+	h.runCommand(command, &args, responder)
+
+	// Commands that don't respond (e.g. they only send direct messages) still have to respond to the interaction
+	if !responder.responded {
+		responder.reply(&dg.MessageSend{Content: "Done.", Flags: dg.MessageFlagsEphemeral})
+	}
+}
+
+// interactionCommand finds the command used in the interaction, including the used subcommand, and returns it together with
+// its options. Returns false if there is no such command.
+func (h *Handler) interactionCommand(data dg.ApplicationCommandInteractionData) (*ct.Command, []*dg.ApplicationCommandInteractionDataOption, bool) {
+
+	command, ok := h.getCommand(data.Name)
+	if !ok {
+		return nil, nil, false
+	}
+
+	// The used subcommand is the only option of its group
+	options := data.Options
+
+	for len(command.Subcommands) > 0 && len(options) == 1 && isSubcommandOption(options[0]) {
+
+		subcommand, ok := h.getCommand(strings.ToLower(command.Name) + " " + options[0].Name)
+		if !ok {
+			break
+		}
+
+		command, options = subcommand, options[0].Options
+	}
+
+	return command, options, true
+}
+
+// isSubcommandOption returns true if the option is a subcommand or a group of subcommands
+func isSubcommandOption(option *dg.ApplicationCommandInteractionDataOption) bool {
+	return option.Type == dg.ApplicationCommandOptionSubCommand || option.Type == dg.ApplicationCommandOptionSubCommandGroup
+}
+
+// parseOptions converts the options of a slash command to the arguments of the command - values as the user would type them and
+// the parsed values (see ct.CommandArgs). Values of variadic arguments are split like typed arguments.
+// If the options don't match the declarations an error describing the problem in a user-friendly way is returned.
+func parseOptions(specs []ct.ArgumentSpec, options []*dg.ApplicationCommandInteractionDataOption) ([]string, map[string]interface{}, error) {
+
+	// Commands that don't declare arguments have no options
+	if specs == nil {
+		return nil, nil, nil
+	}
+
+	// Options can be given in any order, find them by name
+	values := make(map[string]string, len(options))
+	for _, option := range options {
+		values[option.Name] = optionValue(option)
+	}
+
+	var userArgs []string
+	parsed := make(map[string]interface{})
+
+	for _, spec := range specs {
+
+		value, ok := values[spec.Name]
+
+		if !ok {
+			if spec.Optional {
+				continue
+			}
+
+			return nil, nil, errors.New("Missing argument `" + spec.Name + "`.")
+		}
+
+		if !spec.Variadic {
+			parsedValue, err := parseArgument(spec, value)
+
+			if err != nil {
+				return nil, nil, err
+			}
+
+			userArgs = append(userArgs, value)
+			parsed[spec.Name] = parsedValue
+			continue
+		}
+
+		// Variadic argument takes many values in one option, split them like typed ones
+		tokens, err := tokenize(value)
+
+		if err != nil {
+			return nil, nil, errors.New("Can't read argument `" + spec.Name + "`: " + err.Error())
+		}
+
+		if len(tokens) == 0 && !spec.Optional {
+			return nil, nil, errors.New("Missing argument `" + spec.Name + "`.")
+		}
+
+		var parsedValues []interface{}
+
+		for _, token := range tokens {
+			parsedValue, err := parseArgument(spec, token.value)
+
+			if err != nil {
+				return nil, nil, err
+			}
+
+			userArgs = append(userArgs, token.value)
+			parsedValues = append(parsedValues, parsedValue)
+		}
+
+		if len(parsedValues) > 0 {
+			parsed[spec.Name] = parsedValues
+		}
+	}
+
+	return userArgs, parsed, nil
+}
+
+// optionValue returns the value of the option as text, the way the user would type it. Users are represented by their IDs.
+func optionValue(option *dg.ApplicationCommandInteractionDataOption) string {
+
+	switch value := option.Value.(type) {
+
+	case string:
+		{
+			return value
+		}
+
+	case float64:
+		{
+			// Numbers are decoded from JSON as floats, integers are printed without the fraction
+			return strconv.FormatFloat(value, 'f', -1, 64)
+		}
+
+	case int:
+		{
+			return strconv.Itoa(value)
+		}
+
+	default:
+		{
+			return fmt.Sprint(value)
+		}
+	}
+}
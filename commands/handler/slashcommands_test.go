@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"testing"
+
+	dg "github.com/bwmarrin/discordgo"
+	ct "github.com/generalkenobi/makrochatbot/customtypes"
+)
+
+// publishedCommand registers the command in a new handler and returns the application command it is published as
+func publishedCommand(t *testing.T, command ct.Command) *dg.ApplicationCommand {
+
+	h := &Handler{registeredCommands: make(map[string]*ct.Command)}
+
+	if err := h.RegisterCommand(command); err != nil {
+		t.Fatal(err)
+	}
+
+	applicationCommands := h.ApplicationCommands()
+	if len(applicationCommands) != 1 {
+		t.Fatalf("Published %d application commands, expected 1", len(applicationCommands))
+	}
+
+	return applicationCommands[0]
+}
+
+func TestApplicationCommandIntegerBounds(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		min, max int
+	}{
+		{name: "no bounds"},
+		{name: "only min", min: 1},
+		{name: "only max", max: 100},
+		{name: "both", min: -10, max: 10},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			command := publishedCommand(t, ct.Command{
+				Name:      "roll",
+				Arguments: []ct.ArgumentSpec{{Name: "sides", Type: ct.IntArgument, Min: test.min, Max: test.max}},
+				Handler:   func(*ct.CommandArgs) (*ct.Response, error) { return nil, nil },
+			})
+
+			option := command.Options[0]
+
+			if option.Type != dg.ApplicationCommandOptionInteger {
+				t.Fatalf("Option type = %v, expected an integer", option.Type)
+			}
+
+			// Bounds that are not set are not sent to Discord
+			if test.min == 0 && option.MinValue != nil {
+				t.Errorf("MinValue = %v, expected none", *option.MinValue)
+			}
+
+			if test.min != 0 && (option.MinValue == nil || *option.MinValue != float64(test.min)) {
+				t.Errorf("MinValue = %v, expected %d", option.MinValue, test.min)
+			}
+
+			if option.MaxValue != float64(test.max) {
+				t.Errorf("MaxValue = %v, expected %d", option.MaxValue, test.max)
+			}
+		})
+	}
+}
+
+func TestApplicationCommandDMPermission(t *testing.T) {
+
+	handler := func(*ct.CommandArgs) (*ct.Response, error) { return nil, nil }
+
+	tests := []struct {
+		name      string
+		command   ct.Command
+		guildOnly bool
+	}{
+		{name: "command", command: ct.Command{Name: "roll", Handler: handler}, guildOnly: false},
+		{name: "guild-only command", command: ct.Command{Name: "setprefix", GuildOnly: true, Handler: handler}, guildOnly: true},
+		{
+			name: "guild-only group",
+			command: ct.Command{
+				Name:        "audit",
+				GuildOnly:   true,
+				Subcommands: []ct.Command{{Name: "recent", Handler: handler}},
+			},
+			guildOnly: true,
+		},
+		{
+			name: "group with a guild-only subcommand",
+			command: ct.Command{
+				Name:        "monitor",
+				Subcommands: []ct.Command{{Name: "add", GuildOnly: true, Handler: handler}, {Name: "list", Handler: handler}},
+			},
+			guildOnly: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			command := publishedCommand(t, test.command)
+
+			// Commands that can be used everywhere leave the default, which allows direct messages
+			if !test.guildOnly && command.DMPermission != nil {
+				t.Errorf("DMPermission = %v, expected the default", *command.DMPermission)
+			}
+
+			if test.guildOnly && (command.DMPermission == nil || *command.DMPermission) {
+				t.Errorf("DMPermission = %v, expected false", command.DMPermission)
+			}
+		})
+	}
+}
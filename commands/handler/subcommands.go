@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"errors"
+	dg "github.com/bwmarrin/discordgo"
+	ct "github.com/generalkenobi/makrochatbot/customtypes"
+	"strings"
+	"unicode"
+)
+
+// prepareCommand validates the command and its subcommands and returns the copy of the command that gets registered.
+// Subcommands of the copy are named with their full path (e.g. "monitor add") and inherit the category, permission rule,
+// rate limits and middlewares of their parent (parent is nil for top level commands).
+func prepareCommand(command ct.Command, parent *ct.Command) (*ct.Command, error) {
+
+	// Subcommands are recognized by the word typed after their parent, so names can't contain whitespace
+	if command.Name == "" || strings.IndexFunc(command.Name, unicode.IsSpace) >= 0 {
+		return nil, errors.New("command needs a name without whitespace")
+	}
+
+	if parent != nil {
+		command.Name = parent.Name + " " + command.Name
+	}
+
+	// Make sure the command can be invoked at all - groups show their help if they have no handler
+	if command.Handler == nil && len(command.Subcommands) == 0 {
+		return nil, errors.New("command \"" + command.Name + "\" needs a handler or subcommands")
+	}
+
+	// Make sure the arguments are declared correctly
+	if err := validateArgumentSpecs(command.Arguments); err != nil {
+		return nil, errors.New("command \"" + command.Name + "\" - " + err.Error())
+	}
+
+	// Inherit the settings that were not set
+	if parent != nil {
+
+		if command.Category == "" {
+			command.Category = parent.Category
+		}
+
+		if command.Permissions == nil {
+			command.Permissions = parent.Permissions
+		}
+
+		if command.RateLimits == nil {
+			command.RateLimits = parent.RateLimits
+		}
+
+		command.GuildOnly = command.GuildOnly || parent.GuildOnly
+
+		command.Middlewares = append(append([]ct.Middleware{}, parent.Middlewares...), command.Middlewares...)
+	}
+
+	// Prepare the subcommands, the slice is copied so that the caller's commands are not modified
+	subcommands := command.Subcommands
+	command.Subcommands = make([]ct.Command, len(subcommands))
+
+	for i, subcommand := range subcommands {
+
+		prepared, err := prepareCommand(subcommand, &command)
+
+		if err != nil {
+			return nil, err
+		}
+
+		command.Subcommands[i] = *prepared
+	}
+
+	return &command, nil
+}
+
+// commandKeys returns the keys under which the prepared command and all its subcommands are registered (see
+// Handler.registeredCommands). Top level commands are registered under their names and aliases, subcommands under the name of
+// their parent followed by their own name or alias, e.g. "monitor add".
+// Returns an error if any key is used more than once.
+func commandKeys(command *ct.Command, parentKey string) (map[string]*ct.Command, error) {
+
+	keys := make(map[string]*ct.Command)
+
+	for _, name := range append([]string{localName(command)}, command.Aliases...) {
+
+		key := strings.ToLower(name)
+		if parentKey != "" {
+			key = parentKey + " " + key
+		}
+
+		if _, ok := keys[key]; ok {
+			return nil, errors.New("name \"" + key + "\" is used more than once")
+		}
+
+		keys[key] = command
+	}
+
+	// Subcommands are found by the full name of the parent, so aliases of the parent work for them as well
+	for i := range command.Subcommands {
+
+		subcommandKeys, err := commandKeys(&command.Subcommands[i], strings.ToLower(command.Name))
+
+		if err != nil {
+			return nil, err
+		}
+
+		for key, subcommand := range subcommandKeys {
+
+			if _, ok := keys[key]; ok {
+				return nil, errors.New("name \"" + key + "\" is used more than once")
+			}
+
+			keys[key] = subcommand
+		}
+	}
+
+	return keys, nil
+}
+
+// localName returns the name of the command without the names of its parents, e.g. "add" for "monitor add"
+func localName(command *ct.Command) string {
+	return command.Name[strings.LastIndex(command.Name, " ")+1:]
+}
+
+// commandPath returns the full name of the command followed by the full names of its parents, e.g. "monitor add", "monitor".
+// Settings configured for a group apply to its subcommands, unless they are configured for the subcommand.
+func commandPath(name string) []string {
+
+	path := []string{name}
+
+	for i := strings.LastIndex(name, " "); i >= 0; i = strings.LastIndex(name, " ") {
+		name = name[:i]
+		path = append(path, name)
+	}
+
+	return path
+}
+
+// findCommand finds the command invoked by the given words - the first word is the name of a top level command and each next
+// one may be the name of a subcommand. Returns the most nested command found and the number of words naming it, the remaining
+// words are arguments. Returns false if the first word is not a name of any command.
+func (h *Handler) findCommand(words []string) (*ct.Command, int, bool) {
+
+	if len(words) == 0 {
+		return nil, 0, false
+	}
+
+	h.commandsMutex.RLock()
+	defer h.commandsMutex.RUnlock()
+
+	command, ok := h.registeredCommands[strings.ToLower(words[0])]
+	if !ok {
+		return nil, 0, false
+	}
+
+	used := 1
+
+	for used < len(words) && len(command.Subcommands) > 0 {
+
+		subcommand, ok := h.registeredCommands[strings.ToLower(command.Name)+" "+strings.ToLower(words[used])]
+		if !ok {
+			break
+		}
+
+		command = subcommand
+		used++
+	}
+
+	return command, used, true
+}
+
+// groupHelp creates the reply to a group invoked without a valid subcommand - the help of the group, preceded by a notice
+// about the unknown subcommand if one was typed
+func (h *Handler) groupHelp(group *ct.Command, unknownSubcommand, guildID string) *dg.MessageSend {
+
+	message := &dg.MessageSend{Embeds: []*dg.MessageEmbed{h.commandEmbed(group, guildID)}}
+
+	if unknownSubcommand != "" {
+		message.Content = "Unknown subcommand `" + unknownSubcommand + "` of `" + h.prefixFor(guildID) + group.Name + "`."
+	}
+
+	return message
+}
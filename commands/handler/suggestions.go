@@ -0,0 +1,175 @@
+package handler
+
+import (
+	dg "github.com/bwmarrin/discordgo"
+	ct "github.com/generalkenobi/makrochatbot/customtypes"
+	"github.com/generalkenobi/makrochatbot/storage"
+	"strings"
+	"time"
+)
+
+// Limits of suggestions, so that typos in a busy channel don't flood it with replies
+const (
+	// suggestionLimitCount is the number of suggestions that can be sent in one channel per suggestionLimitPeriod
+	suggestionLimitCount = 3
+
+	// suggestionLimitPeriod is the period of the suggestion limit
+	suggestionLimitPeriod = time.Minute
+)
+
+// minSuggestedLength is the minimum length of an unknown command for which a suggestion is made. Shorter words are more likely
+// to be a part of a normal message that happens to start with the prefix.
+const minSuggestedLength = 2
+
+// suggestionCommands returns the built-in commands for configuring suggestions
+func (h *Handler) suggestionCommands() []ct.Command {
+	return []ct.Command{
+		{
+			Name:        "suggestions",
+			Description: "Turns suggestions of commands for mistyped ones on or off on this server",
+			Arguments: []ct.ArgumentSpec{
+				{Name: "state", Description: "Whether suggestions should be made", Type: ct.EnumArgument, Choices: []string{"on", "off"}},
+			},
+			Examples:    []string{"suggestions off"},
+			Category:    AdministrationCategory,
+			Permissions: AdminPermissionRule,
+			GuildOnly:   true,
+			Handler:     h.setSuggestions,
+		},
+	}
+}
+
+// setSuggestions is the handler of the suggestions command. It turns suggestions in the guild on or off and saves the setting.
+// User arguments:
+// 1 - state, "on" or "off"
+func (h *Handler) setSuggestions(args *ct.CommandArgs) (*ct.Response, error) {
+
+	disable := args.String("state") == "off"
+
+	if err := h.store.UpdateGuild(args.GuildID, func(settings *storage.GuildSettings) { settings.DisableSuggestions = disable }); err != nil {
+		return nil, err
+	}
+
+	message := &dg.MessageSend{
+		Content: "Suggestions of commands are now " + args.String("state") + ".",
+	}
+
+	return ct.MessageResponse(message), nil
+}
+
+// suggestCommand tells the user which command they probably meant when they used an unknown one. Nothing is sent if there is
+// no similar command the user is allowed to use, if the guild turned suggestions off or if too many suggestions were sent in
+// the channel recently.
+func (h *Handler) suggestCommand(message *dg.Message, unknown string, responder *responder) {
+
+	if len([]rune(unknown)) < minSuggestedLength || h.store.Guild(message.GuildID).DisableSuggestions {
+		return
+	}
+
+	suggestion, ok := h.similarCommand(unknown, message.GuildID, message.ChannelID, message.Author.ID)
+	if !ok {
+		return
+	}
+
+	// Take from the limit only when there is something to say
+	if allowed, _ := h.suggestionLimiter.Allow(message.ChannelID); !allowed {
+		return
+	}
+
+	prefix := h.prefixFor(message.GuildID)
+
+	responder.reply(&dg.MessageSend{
+		Content: "Unknown command `" + prefix + unknown + "`, did you mean `" + prefix + suggestion + "`?",
+	})
+}
+
+// similarCommand finds the name or alias of a command that is the most similar to the unknown one and that the user is allowed
+// to use. Names are similar if they differ by at most a third of the characters (and at least one). If several names are equally
+// similar, the one registered first is returned. Returns false if no name is similar enough.
+func (h *Handler) similarCommand(unknown, guildID, channelID, userID string) (string, bool) {
+
+	unknown = strings.ToLower(unknown)
+
+	maxDistance := len([]rune(unknown)) / 3
+	if maxDistance < 1 {
+		maxDistance = 1
+	}
+
+	bestName, bestDistance := "", maxDistance+1
+
+	for _, command := range h.getCommands() {
+
+		for _, name := range append([]string{command.Name}, command.Aliases...) {
+
+			name = strings.ToLower(name)
+
+			distance := editDistance(unknown, name)
+			if distance >= bestDistance {
+				continue
+			}
+
+			// Don't suggest commands the user can't use, checking permissions may need the transport so it's done last
+			if !h.availability(command, guildID, channelID).enabled {
+				continue
+			}
+
+			if allowed, err := h.isAllowed(command, guildID, channelID, userID); err != nil || !allowed {
+				continue
+			}
+
+			bestName, bestDistance = name, distance
+		}
+	}
+
+	return bestName, bestName != ""
+}
+
+// editDistance returns the Damerau-Levenshtein distance (optimal string alignment variant) of the words - the number of characters
+// that have to be inserted, deleted, substituted or swapped with their neighbour to turn one word into the other
+func editDistance(a, b string) int {
+
+	first, second := []rune(a), []rune(b)
+
+	// distances[i][j] is the distance between the first i characters of the first word and the first j characters of the second
+	distances := make([][]int, len(first)+1)
+	for i := range distances {
+		distances[i] = make([]int, len(second)+1)
+		distances[i][0] = i
+	}
+
+	for j := range distances[0] {
+		distances[0][j] = j
+	}
+
+	for i := 1; i <= len(first); i++ {
+		for j := 1; j <= len(second); j++ {
+
+			cost := 1
+			if first[i-1] == second[j-1] {
+				cost = 0
+			}
+
+			distances[i][j] = minimum(distances[i-1][j]+1, distances[i][j-1]+1, distances[i-1][j-1]+cost)
+
+			// Swapped neighbours, e.g. "rlol" and "roll"
+			if i > 1 && j > 1 && first[i-1] == second[j-2] && first[i-2] == second[j-1] {
+				distances[i][j] = minimum(distances[i][j], distances[i-2][j-2]+1)
+			}
+		}
+	}
+
+	return distances[len(first)][len(second)]
+}
+
+// minimum returns the smallest of the numbers
+func minimum(first int, others ...int) int {
+
+	result := first
+	for _, number := range others {
+		if number < result {
+			result = number
+		}
+	}
+
+	return result
+}
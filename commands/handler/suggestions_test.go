@@ -0,0 +1,39 @@
+package handler
+
+import "testing"
+
+func TestEditDistance(t *testing.T) {
+
+	tests := []struct {
+		a, b     string
+		distance int
+	}{
+		{a: "", b: "", distance: 0},
+		{a: "roll", b: "", distance: 4},
+		{a: "", b: "roll", distance: 4},
+		{a: "roll", b: "roll", distance: 0},
+		{a: "rol", b: "roll", distance: 1},
+		{a: "rolll", b: "roll", distance: 1},
+		{a: "rell", b: "roll", distance: 1},
+		{a: "rlol", b: "roll", distance: 1},
+		{a: "orll", b: "roll", distance: 1},
+		{a: "help", b: "hlep", distance: 1},
+		{a: "monitor", b: "mointor", distance: 1},
+		{a: "ca", b: "abc", distance: 3},
+		{a: "kitten", b: "sitting", distance: 3},
+		{a: "prefix", b: "setprefix", distance: 3},
+		{a: "żółw", b: "zółw", distance: 1},
+	}
+
+	for _, test := range tests {
+
+		if distance := editDistance(test.a, test.b); distance != test.distance {
+			t.Errorf("editDistance(%q, %q) = %d, expected %d", test.a, test.b, distance, test.distance)
+		}
+
+		// The distance is symmetric
+		if distance := editDistance(test.b, test.a); distance != test.distance {
+			t.Errorf("editDistance(%q, %q) = %d, expected %d", test.b, test.a, distance, test.distance)
+		}
+	}
+}
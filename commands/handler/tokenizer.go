@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// token is a single argument found in the input
+type token struct {
+
+	// value of the token with quotes removed and escapes resolved
+	value string
+
+	// start is the index in input of the first byte of the token
+	start int
+
+	// end is the index in input just after the last byte of the token
+	end int
+}
+
+// tokenize splits the input into tokens. Tokens are separated by whitespace, except for:
+//   - text enclosed in double (") or single (') quotes, which is a part of one token (e.g. "Jan Kowalski"). Quotes are recognized only
+//     at the beginning of a token, so apostrophes inside words (e.g. can't) are left as they are,
+//   - characters preceded by a backslash, which are always taken literally (e.g. \" or \ ). Inside single quotes backslash has
+//     no special meaning.
+//
+// Case of the input is preserved. Returns an error if a quote is not closed or the input ends with a lone backslash.
+func tokenize(input string) ([]token, error) {
+
+	var tokens []token
+
+	// The token being built, inToken is true if any character of it was already processed
+	var current strings.Builder
+	inToken := false
+	start := 0
+
+	// Quote character of the currently open quote, 0 if no quote is open
+	var quote rune
+
+	// Position of the opening quote, used for error messages
+	quoteStart := 0
+
+	// True if the previous character was a backslash that escapes the current one
+	escaped := false
+
+	for index, character := range input {
+
+		switch {
+
+		case escaped:
+			{
+				// Escaped character is always taken literally
+				current.WriteRune(character)
+				escaped = false
+			}
+
+		case character == '\\' && quote != '\'':
+			{
+				// Backslash starts a token just like any other character
+				if !inToken {
+					inToken, start = true, index
+				}
+
+				escaped = true
+			}
+
+		case quote != 0:
+			{
+				// Inside quotes everything except the closing quote is taken literally
+				if character == quote {
+					quote = 0
+				} else {
+					current.WriteRune(character)
+				}
+			}
+
+		case unicode.IsSpace(character):
+			{
+				// Whitespace ends the current token, if there is any
+				if inToken {
+					tokens = append(tokens, token{value: current.String(), start: start, end: index})
+					current.Reset()
+					inToken = false
+				}
+			}
+
+		case (character == '"' || character == '\'') && !inToken:
+			{
+				// Quote at the beginning of a token opens a quoted section
+				inToken, start = true, index
+				quote, quoteStart = character, index
+			}
+
+		default:
+			{
+				if !inToken {
+					inToken, start = true, index
+				}
+
+				current.WriteRune(character)
+			}
+		}
+	}
+
+	// Make sure the input ended in a consistent state
+	if quote != 0 {
+		return nil, errors.New("Quote " + string(quote) + " opened at position " + strconv.Itoa(utf8.RuneCountInString(input[:quoteStart])+1) +
+			" is not closed")
+	}
+
+	if escaped {
+		return nil, errors.New("Input can't end with a backslash")
+	}
+
+	// Add the last token
+	if inToken {
+		tokens = append(tokens, token{value: current.String(), start: start, end: len(input)})
+	}
+
+	return tokens, nil
+}
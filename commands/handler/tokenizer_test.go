@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		input  string
+		values []string
+		err    string
+	}{
+		{name: "empty", input: "", values: nil},
+		{name: "whitespace only", input: " \t\n ", values: nil},
+		{name: "words", input: "monitor add Kowalski", values: []string{"monitor", "add", "Kowalski"}},
+		{name: "repeated whitespace", input: "  roll \t 20  ", values: []string{"roll", "20"}},
+		{name: "case preserved", input: "ROLL Jan", values: []string{"ROLL", "Jan"}},
+		{name: "double quotes", input: `add "Jan Kowalski" rau2`, values: []string{"add", "Jan Kowalski", "rau2"}},
+		{name: "single quotes", input: `add 'Jan Kowalski'`, values: []string{"add", "Jan Kowalski"}},
+		{name: "empty quotes", input: `add ""`, values: []string{"add", ""}},
+		{name: "quote continued by text", input: `"Jan "Kowalski`, values: []string{"Jan Kowalski"}},
+		{name: "apostrophe inside word", input: "can't stop", values: []string{"can't", "stop"}},
+		{name: "other quote inside quotes", input: `"it's here"`, values: []string{"it's here"}},
+		{name: "escaped space", input: `Jan\ Kowalski`, values: []string{"Jan Kowalski"}},
+		{name: "escaped quote", input: `\"Jan`, values: []string{`"Jan`}},
+		{name: "escaped quote inside double quotes", input: `"say \"hi\""`, values: []string{`say "hi"`}},
+		{name: "backslash inside single quotes", input: `'C:\path'`, values: []string{`C:\path`}},
+		{name: "unicode", input: "dodaj Łukasz", values: []string{"dodaj", "Łukasz"}},
+		{name: "unclosed double quote", input: `add "Jan`, err: "Quote \" opened at position 5 is not closed"},
+		{name: "unclosed single quote", input: `Ł 'Jan`, err: "Quote ' opened at position 3 is not closed"},
+		{name: "trailing backslash", input: `add \`, err: "Input can't end with a backslash"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			tokens, err := tokenize(test.input)
+
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("tokenize(%q) error = %v, expected %q", test.input, err, test.err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("tokenize(%q) returned error %v", test.input, err)
+			}
+
+			var values []string
+			for _, token := range tokens {
+				values = append(values, token.value)
+			}
+
+			if !reflect.DeepEqual(values, test.values) {
+				t.Errorf("tokenize(%q) = %q, expected %q", test.input, values, test.values)
+			}
+		})
+	}
+}
+
+func TestTokenizePositions(t *testing.T) {
+
+	// Positions point to the input as it was typed, quotes included - RawArgs of commands is cut out by them
+	input := `add  "Jan Kowalski" rau2`
+
+	tokens, err := tokenize(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"add", `"Jan Kowalski"`, "rau2"}
+
+	if len(tokens) != len(expected) {
+		t.Fatalf("tokenize(%q) returned %d tokens, expected %d", input, len(tokens), len(expected))
+	}
+
+	for i, token := range tokens {
+		if raw := input[token.start:token.end]; raw != expected[i] {
+			t.Errorf("Token %d covers %q, expected %q", i, raw, expected[i])
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"sync"
+	"time"
+)
+
+// Limits of tracking invocations, so that the memory used doesn't grow with the number of commands
+const (
+	// trackedInvocationLifetime is the time after which edits and deletions of a message with a command are ignored
+	trackedInvocationLifetime = 15 * time.Minute
+
+	// maxTrackedInvocations is the maximum number of tracked messages with commands, the oldest ones are forgotten first
+	maxTrackedInvocations = 1000
+)
+
+// sentMessage identifies a message sent by the bot or a reaction the bot added to the message with the command
+type sentMessage struct {
+
+	// channelID and messageID identify the message
+	channelID string
+	messageID string
+
+	// direct is true if the message was sent directly to the user
+	direct bool
+
+	// reaction is the emoji of the reaction, empty if this is a message
+	reaction string
+}
+
+// trackedInvocation is a message with a command together with the messages the bot sent in response to it
+type trackedInvocation struct {
+
+	// content of the message when the command was last run, edits that don't change it (e.g. added link previews) are ignored
+	content string
+
+	// responses are the messages sent in response to the command, in order
+	responses []sentMessage
+
+	// created is the time at which the message was first tracked
+	created time.Time
+}
+
+// invocationTracker remembers which messages the bot sent in response to recent typed commands, so that the responses can be
+// edited when the command is edited and deleted when the command is deleted. It is safe for concurrent use.
+type invocationTracker struct {
+
+	// invocations are the tracked messages with commands, key is channel ID and message ID separated by a slash
+	invocations map[string]*trackedInvocation
+
+	// order contains keys of invocations in order of tracking, the oldest first
+	order []string
+
+	// mutex is used to synchronize access to invocations and order
+	mutex sync.Mutex
+}
+
+// newInvocationTracker creates a tracker without any invocations
+func newInvocationTracker() *invocationTracker {
+	return &invocationTracker{invocations: make(map[string]*trackedInvocation)}
+}
+
+// invocationKey returns the key of the message in invocationTracker.invocations
+func invocationKey(channelID, messageID string) string {
+	return channelID + "/" + messageID
+}
+
+// get returns the invocation tracked for the message. Returns false if the message is not tracked.
+func (t *invocationTracker) get(channelID, messageID string) (trackedInvocation, bool) {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.forgetExpired()
+
+	invocation, ok := t.invocations[invocationKey(channelID, messageID)]
+	if !ok {
+		return trackedInvocation{}, false
+	}
+
+	return *invocation, true
+}
+
+// track remembers the content of the message and the responses sent to it, replacing what was tracked before.
+// Messages tracked again (e.g. after an edit) keep their place in order, so edits don't extend their lifetime.
+func (t *invocationTracker) track(channelID, messageID, content string, responses []sentMessage) {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	key := invocationKey(channelID, messageID)
+
+	if invocation, ok := t.invocations[key]; ok {
+		invocation.content, invocation.responses = content, responses
+		return
+	}
+
+	t.invocations[key] = &trackedInvocation{content: content, responses: responses, created: time.Now()}
+	t.order = append(t.order, key)
+
+	t.forgetExpired()
+}
+
+// forget stops tracking the message and returns the responses sent to it. Returns false if the message was not tracked.
+func (t *invocationTracker) forget(channelID, messageID string) ([]sentMessage, bool) {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	key := invocationKey(channelID, messageID)
+
+	invocation, ok := t.invocations[key]
+	if !ok {
+		return nil, false
+	}
+
+	delete(t.invocations, key)
+
+	for i, orderedKey := range t.order {
+		if orderedKey == key {
+			t.order = append(t.order[:i:i], t.order[i+1:]...)
+			break
+		}
+	}
+
+	return invocation.responses, true
+}
+
+// forgetExpired stops tracking the invocations that are too old or too many. Mutex has to be held by the caller.
+func (t *invocationTracker) forgetExpired() {
+
+	expired := 0
+
+	for _, key := range t.order {
+
+		if len(t.order)-expired <= maxTrackedInvocations && time.Since(t.invocations[key].created) < trackedInvocationLifetime {
+			break
+		}
+
+		delete(t.invocations, key)
+		expired++
+	}
+
+	t.order = t.order[expired:]
+}
@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+)
+
+// Default size of the worker pool, used when the config doesn't specify it
+const (
+	// defaultWorkerCount is the default number of workers running commands
+	defaultWorkerCount = 4
+
+	// defaultQueueSize is the default number of commands that can wait for each worker
+	defaultQueueSize = 16
+)
+
+// PoolStats contains metrics of the worker pool running commands
+type PoolStats struct {
+
+	// Number of commands currently waiting in queues
+	QueueDepth int
+
+	// Total number of commands that can wait in queues
+	QueueCapacity int
+
+	// Number of commands dropped because the queue was full, since the handler was started
+	Dropped int64
+
+	// Number of commands run, since the handler was started
+	Processed int64
+}
+
+// workerPool runs jobs on a fixed number of goroutines. Each worker has its own bounded queue and jobs with the same key always go
+// to the same worker, so jobs with the same key (e.g. commands from one channel) run in the order they were submitted.
+type workerPool struct {
+
+	// queues of the workers, one per worker
+	queues []chan func()
+
+	// waitGroup is used to wait for workers to finish
+	waitGroup sync.WaitGroup
+
+	// dropped is the number of jobs rejected because the queue was full
+	dropped int64
+
+	// processed is the number of jobs run
+	processed int64
+
+	// recoverJob is called with the value of a panic that happened in a job, while the panic is being recovered. The worker
+	// continues with the next job.
+	recoverJob func(value interface{})
+}
+
+// newWorkerPool creates a pool with the given number of workers and queue size of each worker and starts the workers.
+// Non-positive values are replaced with defaults. Panics in jobs are passed to recoverJob, so that they can't kill the workers.
+func newWorkerPool(workers, queueSize int, recoverJob func(value interface{})) *workerPool {
+
+	if workers <= 0 {
+		workers = defaultWorkerCount
+	}
+
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+
+	pool := &workerPool{queues: make([]chan func(), workers), recoverJob: recoverJob}
+
+	for i := range pool.queues {
+		pool.queues[i] = make(chan func(), queueSize)
+		pool.waitGroup.Add(1)
+		go pool.workerRoutine(pool.queues[i])
+	}
+
+	return pool
+}
+
+// submit puts the job in the queue of the worker assigned to the key. Returns false if the queue is full - the job is dropped then.
+func (p *workerPool) submit(key string, job func()) bool {
+
+	// Choose the worker basing on the hash of the key
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	queue := p.queues[hash.Sum32()%uint32(len(p.queues))]
+
+	// Don't block if the queue is full
+	select {
+	case queue <- job:
+		return true
+	default:
+		atomic.AddInt64(&p.dropped, 1)
+		return false
+	}
+}
+
+// stop closes the queues and waits until workers finish all queued jobs. The pool can't be used after it's stopped.
+func (p *workerPool) stop() {
+
+	for _, queue := range p.queues {
+		close(queue)
+	}
+
+	p.waitGroup.Wait()
+}
+
+// stats returns the current metrics of the pool
+func (p *workerPool) stats() PoolStats {
+
+	stats := PoolStats{
+		Dropped:   atomic.LoadInt64(&p.dropped),
+		Processed: atomic.LoadInt64(&p.processed),
+	}
+
+	for _, queue := range p.queues {
+		stats.QueueDepth += len(queue)
+		stats.QueueCapacity += cap(queue)
+	}
+
+	return stats
+}
+
+// workerRoutine runs jobs from the queue until it's closed
+func (p *workerPool) workerRoutine(queue chan func()) {
+
+	defer p.waitGroup.Done()
+
+	for job := range queue {
+		p.runJob(job)
+		atomic.AddInt64(&p.processed, 1)
+	}
+}
+
+// runJob runs the job, a panic in it is passed to recoverJob
+func (p *workerPool) runJob(job func()) {
+
+	defer func() {
+		if value := recover(); value != nil {
+			p.recoverJob(value)
+		}
+	}()
+
+	job()
+}
@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestWorkerPoolKeepsOrderOfKeys(t *testing.T) {
+
+	keys := []string{"channel 1", "channel 2", "channel 3", "channel 4", "channel 5"}
+	const jobsPerKey = 100
+
+	pool := newWorkerPool(3, len(keys)*jobsPerKey, nil)
+
+	var mutex sync.Mutex
+	order := make(map[string][]int)
+
+	// Jobs of different keys are interleaved, some keys share a worker
+	for i := 0; i < jobsPerKey; i++ {
+		for _, key := range keys {
+
+			key, number := key, i
+
+			if !pool.submit(key, func() {
+				mutex.Lock()
+				defer mutex.Unlock()
+				order[key] = append(order[key], number)
+			}) {
+				t.Fatalf("Job %d of %s was dropped", number, key)
+			}
+		}
+	}
+
+	pool.stop()
+
+	expected := make([]int, jobsPerKey)
+	for i := range expected {
+		expected[i] = i
+	}
+
+	for _, key := range keys {
+		if !reflect.DeepEqual(order[key], expected) {
+			t.Errorf("Jobs of %s were run in the order %v", key, order[key])
+		}
+	}
+
+	if stats := pool.stats(); stats.Processed != int64(len(keys)*jobsPerKey) || stats.Dropped != 0 || stats.QueueDepth != 0 {
+		t.Errorf("Stats = %+v, expected %d processed and nothing queued or dropped", stats, len(keys)*jobsPerKey)
+	}
+}
+
+func TestWorkerPoolDropsWhenQueueIsFull(t *testing.T) {
+
+	pool := newWorkerPool(1, 2, nil)
+
+	started, release := make(chan struct{}), make(chan struct{})
+
+	// Keep the only worker busy, so that the next jobs wait in its queue
+	pool.submit("channel", func() {
+		close(started)
+		<-release
+	})
+
+	<-started
+
+	for i := 0; i < 2; i++ {
+		if !pool.submit("channel", func() {}) {
+			t.Fatalf("Job %d was dropped before the queue was full", i+1)
+		}
+	}
+
+	// The queue is shared by all keys of the worker
+	if pool.submit("other channel", func() {}) {
+		t.Error("Job was queued although the queue was full")
+	}
+
+	expected := PoolStats{QueueDepth: 2, QueueCapacity: 2, Dropped: 1, Processed: 0}
+	if stats := pool.stats(); stats != expected {
+		t.Errorf("Stats with a full queue = %+v, expected %+v", stats, expected)
+	}
+
+	close(release)
+	pool.stop()
+
+	expected = PoolStats{QueueDepth: 0, QueueCapacity: 2, Dropped: 1, Processed: 3}
+	if stats := pool.stats(); stats != expected {
+		t.Errorf("Stats after stopping = %+v, expected %+v", stats, expected)
+	}
+}
+
+func TestWorkerPoolDefaults(t *testing.T) {
+
+	pool := newWorkerPool(0, -1, nil)
+	defer pool.stop()
+
+	if len(pool.queues) != defaultWorkerCount {
+		t.Errorf("Pool has %d workers, expected %d", len(pool.queues), defaultWorkerCount)
+	}
+
+	if capacity := pool.stats().QueueCapacity; capacity != defaultWorkerCount*defaultQueueSize {
+		t.Errorf("Queue capacity = %d, expected %d", capacity, defaultWorkerCount*defaultQueueSize)
+	}
+
+	// Handlers that are not started have no pool
+	if stats := (&Handler{}).Stats(); stats != (PoolStats{}) {
+		t.Errorf("Stats of a handler that is not started = %+v, expected zeros", stats)
+	}
+}
+
+func TestWorkerPoolRecoversPanics(t *testing.T) {
+
+	var recovered []interface{}
+
+	// One worker, so that the job after the panic runs on the worker that panicked
+	pool := newWorkerPool(1, 4, func(value interface{}) { recovered = append(recovered, value) })
+
+	ran := false
+
+	pool.submit("channel", func() { panic("job failed") })
+	pool.submit("channel", func() { ran = true })
+
+	pool.stop()
+
+	if !reflect.DeepEqual(recovered, []interface{}{"job failed"}) {
+		t.Errorf("Recovered %v, expected the value of the panic", recovered)
+	}
+
+	if !ran {
+		t.Error("Job after the panic was not run")
+	}
+
+	if processed := pool.stats().Processed; processed != 2 {
+		t.Errorf("Processed = %d, expected 2", processed)
+	}
+}
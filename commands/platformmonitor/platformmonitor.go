@@ -9,7 +9,7 @@ import (
 	dg "github.com/bwmarrin/discordgo"
 	"io/ioutil"
 	"net/http"
-	"strconv"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -19,100 +19,287 @@ import (
 // It is not possible to configure platform monitor to check with greater freqency.
 const MinimumSleepSeconds = 10
 
-// monitoredURLs holds all subscribers assigned to the monitored URL
-// Key is the monitored URL.
-// Value is a map used as a set (value is an empty struct) which holds monitorSubscriptions - structs used to hold subscribers
-// and their targets.
-var monitoredURLs = make(map[string]map[monitorSubscription]struct{})
+// listPageLength is the maximum number of characters on one page of the lists of subscriptions and platforms
+const listPageLength = 1000
 
-// monitoredURLsMutex is a mutex used to take ownership of monitoredURLs
-var monitoredURLsMutex sync.Mutex
+// Limits of the guided subscription (see GuidedSubscription)
+const (
+	// guideAnswerTimeout is the time the user has to answer each question
+	guideAnswerTimeout = 2 * time.Minute
 
-// whitelistedURLs contains whitelisted urls and their aliases - those are only urls that may be subscribed to.
-var whitelistedURLs = map[string]string{
-	"rau2": "https://platforma.polsl.pl/rau2",
-	"rau3": "https://platforma.polsl.pl/rau3",
+	// guidePlatformAttempts is the number of times the user can give an unknown platform before the guide gives up
+	guidePlatformAttempts = 3
+
+	// guideCancelAnswer is the answer which stops the guide without subscribing
+	guideCancelAnswer = "cancel"
+)
+
+// Monitor periodically checks monitored platforms and notifies subscribers when the person they subscribed to appears there.
+// Each monitor keeps its own subscriptions, so multiple monitors can work independently in one process.
+type Monitor struct {
+
+	// monitoredURLs holds all subscribers assigned to the monitored URL
+	// Key is the monitored URL.
+	// Value is a map used as a set (value is an empty struct) which holds monitorSubscriptions - structs used to hold subscribers
+	// and their targets.
+	monitoredURLs map[string]map[monitorSubscription]struct{}
+
+	// monitoredURLsMutex is a mutex used to take ownership of monitoredURLs
+	monitoredURLsMutex sync.Mutex
+
+	// whitelistedURLs contains whitelisted urls and their aliases - those are only urls that may be subscribed to.
+	whitelistedURLs map[string]string
+
+	// communicator is used to notify subscribers
+	communicator *communication.Communicator
+
+	// stopChannel is used to stop the monitoring routine, it is nil if the routine is not running
+	stopChannel chan int
+
+	// stopChannelMutex is a mutex used to take ownership of stopChannel
+	stopChannelMutex sync.Mutex
 }
 
-// CreateMonitorSubscription adds a new subscription to the monitor service
-// Arguments:
-// 1. Name to subscribe to
-// 2. Platform alias (e.g. "rau1", "rau2")
-func CreateMonitorSubscription(args *ct.CommandArgs) (*dg.MessageSend, error) {
+// DefaultPlatforms returns the platforms (aliases and urls) that may be subscribed to if no others were configured
+func DefaultPlatforms() map[string]string {
+	return map[string]string{
+		"rau2": "https://platforma.polsl.pl/rau2",
+		"rau3": "https://platforma.polsl.pl/rau3",
+	}
+}
 
-	// Message that will be sent to the user as feedback at the end of the call
-	message := &dg.MessageSend{}
-	defer communication.SendToUser(args.UserID, message)
+// New creates a monitor that allows subscribing to the given platforms (key is the alias, value is the url) and notifies
+// subscribers using communicator. If platforms is empty then DefaultPlatforms are used.
+func New(communicator *communication.Communicator, platforms map[string]string) *Monitor {
 
-	if len(args.UserArgs) < 2 {
-		// Can't subscribe - not enough arguments
-		return nil, errors.New("CreateMonitorSubscription: Not enough arguments: need 2, received " + strconv.Itoa(len(args.UserArgs)))
+	// Fall back to default platforms if none were given
+	if len(platforms) == 0 {
+		platforms = DefaultPlatforms()
 	}
 
-	listenToName, urlAlias := args.UserArgs[0], args.UserArgs[1]
+	monitor := &Monitor{
+		monitoredURLs:   make(map[string]map[monitorSubscription]struct{}),
+		whitelistedURLs: platforms,
+		communicator:    communicator,
+	}
+
+	return monitor
+}
+
+// Platforms returns aliases of all platforms that may be subscribed to, sorted alphabetically
+func (m *Monitor) Platforms() []string {
+
+	aliases := make([]string, 0, len(m.whitelistedURLs))
+	for alias := range m.whitelistedURLs {
+		aliases = append(aliases, alias)
+	}
+
+	sort.Strings(aliases)
+	return aliases
+}
+
+// SubscriptionArguments returns the arguments of the CreateMonitorSubscription and RemoveSubscription commands. Platforms accepted by
+// the commands depend on the configuration of the monitor.
+func (m *Monitor) SubscriptionArguments() []ct.ArgumentSpec {
+	return []ct.ArgumentSpec{
+		{Name: "name", Description: "Name to look for on the platform"},
+		{Name: "platform", Description: "Platform to monitor", Type: ct.EnumArgument, Choices: m.Platforms()},
+	}
+}
+
+// CreateMonitorSubscription adds a new subscription to the monitor service
+// Arguments (see SubscriptionArguments):
+// 1. name - Name to subscribe to
+// 2. platform - Platform alias (e.g. "rau1", "rau2")
+func (m *Monitor) CreateMonitorSubscription(args *ct.CommandArgs) (*ct.Response, error) {
+
+	listenToName, urlAlias := args.String("name"), args.String("platform")
 
 	// Try to get the url out of whitelist
-	url, ok := whitelistedURLs[urlAlias]
+	url, ok := m.whitelistedURLs[urlAlias]
 
 	if !ok {
-		// TODO: Notify user that the specified platform is incorrect
-		message.Content = "The specified platform is incorrect"
-		return nil, errors.New("CreateMonitorSubscription: Incorrect platform specified: " + urlAlias)
+		// The user specified a platform that can't be monitored
+		return nil, ct.NewUserError("Unknown platform `" + urlAlias + "`. Available platforms: " + strings.Join(m.Platforms(), ", "))
 	}
 
 	// If everything was correct, add a new subscription. Use its return value as feedback for user
-	message.Content = addSubscriber(args.UserID, listenToName, url)
+	message := &dg.MessageSend{
+		Content: m.addSubscriber(args.UserID, listenToName, url),
+	}
 
-	return nil, nil
+	// Feedback is shown only to the user
+	return ct.NewResponse().Ephemeral(message), nil
 }
 
-// RemoveAllSubscriptions removes all subscriptions from the user that invoked the command
-func RemoveAllSubscriptions(args *ct.CommandArgs) (*dg.MessageSend, error) {
+// GuidedSubscription is an interactive command (see ct.Command.Interactive) which asks the user for the platform and the name
+// one by one and then subscribes them, like CreateMonitorSubscription. The user can answer "cancel" to stop.
+func (m *Monitor) GuidedSubscription(args *ct.CommandArgs) (*ct.Response, error) {
 
-	// Remove the subscriptions
-	removedSubscriptions := removeSubscriber(args.UserID)
+	conversation := args.Conversation
+	if conversation == nil {
+		return nil, errors.New("GuidedSubscription has to be registered as an interactive command")
+	}
 
-	var messageContent string
+	cancelled := ct.MessageResponse(&dg.MessageSend{Content: "Okay, I didn't subscribe you to anything."})
+
+	conversation.Prompt(&dg.MessageSend{
+		Content: "Which platform should I monitor? Answer with one of `" + strings.Join(m.Platforms(), "`, `") + "` or `" +
+			guideCancelAnswer + "`.",
+	})
+
+	// Ask for the platform until the user gives a known one
+	var url, urlAlias string
+
+	for attempt := 1; url == ""; attempt++ {
+
+		answer, err := conversation.AwaitMessage(guideAnswerTimeout)
+		if err != nil {
+			return nil, err
+		}
+
+		urlAlias = strings.TrimSpace(answer.Content)
+		if strings.EqualFold(urlAlias, guideCancelAnswer) {
+			return cancelled, nil
+		}
+
+		// Try to get the url out of whitelist. Like the platform argument of other commands, the alias is case insensitive.
+		for _, alias := range m.Platforms() {
+			if strings.EqualFold(alias, urlAlias) {
+				url, urlAlias = m.whitelistedURLs[alias], alias
+				break
+			}
+		}
+
+		if url != "" {
+			break
+		}
+
+		if attempt == guidePlatformAttempts {
+			return nil, ct.NewUserError("I still don't know that platform, let's try again later.")
+		}
+
+		conversation.Send(ct.MessageResponse(&dg.MessageSend{
+			Content: "Unknown platform `" + urlAlias + "`, please answer with one of `" + strings.Join(m.Platforms(), "`, `") + "`.",
+		}))
+	}
+
+	conversation.Prompt(&dg.MessageSend{Content: "Which name should I look for on " + urlAlias + "?"})
+
+	answer, err := conversation.AwaitMessage(guideAnswerTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(answer.Content)
+	if name == "" || strings.EqualFold(name, guideCancelAnswer) {
+		return cancelled, nil
+	}
+
+	return ct.MessageResponse(&dg.MessageSend{Content: m.addSubscriber(args.UserID, name, url)}), nil
+}
+
+// RemoveSubscription removes one subscription of the user that invoked the command
+// Arguments (see SubscriptionArguments):
+// 1. name - Name the user is subscribed to
+// 2. platform - Platform alias (e.g. "rau1", "rau2")
+func (m *Monitor) RemoveSubscription(args *ct.CommandArgs) (*ct.Response, error) {
 
-	if len(removedSubscriptions) > 0 {
+	name, urlAlias := args.String("name"), args.String("platform")
+
+	url, ok := m.whitelistedURLs[urlAlias]
+
+	if !ok {
+		return nil, ct.NewUserError("Unknown platform `" + urlAlias + "`. Available platforms: " + strings.Join(m.Platforms(), ", "))
+	}
 
-		// Add a header to the slice of removed subscriptions
-		removedSubscriptions = append([]string{"Removed:"}, removedSubscriptions...)
+	var messageContent string
 
-		// And join it using newline as separator.
-		// It will look like that:
-		// Removed:
-		// https://platform.polsl.pl/rau1 : Smiths
-		// https://platform.polsl.pl/rau2 : Thompson
-		messageContent = strings.Join(removedSubscriptions, "\n")
+	if m.removeSubscriberFrom(args.UserID, name, url) {
+		messageContent = "Unsubscribed from " + strings.ToLower(name) + " on " + urlAlias
 	} else {
-		messageContent = "You weren't subscribed to anyone"
+		messageContent = "You weren't subscribed to " + strings.ToLower(name) + " on " + urlAlias
 	}
 
-	// Create a message with the string message
-	message := &dg.MessageSend{
-		Content: messageContent,
+	// Feedback is shown only to the user
+	return ct.NewResponse().Ephemeral(&dg.MessageSend{Content: messageContent}), nil
+}
+
+// ListSubscriptions lists all subscriptions of the user that invoked the command
+func (m *Monitor) ListSubscriptions(args *ct.CommandArgs) (*ct.Response, error) {
+
+	subscriptions := m.subscriptionsOf(args.UserID)
+
+	// Feedback is shown only to the user
+	if len(subscriptions) == 0 {
+		return ct.NewResponse().Ephemeral(&dg.MessageSend{Content: "You aren't subscribed to anyone"}), nil
 	}
 
-	// And send it to the user
-	communication.SendToUser(args.UserID, message)
+	// The list may be too long for one message
+	return ct.NewResponse().Paginate(ct.EphemeralTarget, ct.ContentPages("Your subscriptions:", subscriptions, listPageLength)), nil
+}
+
+// ListPlatforms lists the platforms that may be subscribed to, with their urls
+func (m *Monitor) ListPlatforms(args *ct.CommandArgs) (*ct.Response, error) {
+
+	var lines []string
+	for _, alias := range m.Platforms() {
+		lines = append(lines, "`"+alias+"` - <"+m.whitelistedURLs[alias]+">")
+	}
 
-	return nil, nil
+	return ct.NewResponse().Paginate(ct.ChannelTarget, ct.ContentPages("Available platforms:", lines, listPageLength)), nil
+}
+
+// RemoveAllSubscriptions removes all subscriptions from the user that invoked the command
+func (m *Monitor) RemoveAllSubscriptions(args *ct.CommandArgs) (*ct.Response, error) {
+
+	// Remove the subscriptions
+	removedSubscriptions := m.removeSubscriber(args.UserID)
+
+	// Feedback is shown only to the user
+	if len(removedSubscriptions) == 0 {
+		return ct.NewResponse().Ephemeral(&dg.MessageSend{Content: "You weren't subscribed to anyone"}), nil
+	}
+
+	// List the removed subscriptions under a header, split into pages if the list is long.
+	// It will look like that:
+	// Removed:
+	// https://platform.polsl.pl/rau1 : Smiths
+	// https://platform.polsl.pl/rau2 : Thompson
+	return ct.NewResponse().Paginate(ct.EphemeralTarget, ct.ContentPages("Removed:", removedSubscriptions, listPageLength)), nil
 }
 
 // Start starts a new monitoring routine that will check all registered subscriptions, sleep for the provided number of seconds and
 // then repeating the process indefinitely. The minimum number of seconds is MinimumSleepSeconds.
-// Return value is a channel which is used to stop the created monitoring routine - it will be stopped when value 1 is passed to
-// the channel or the channel is closed.
-func Start(seconds int) chan int {
+// The routine runs until Stop is called. If the routine is already running then nothing happens.
+func (m *Monitor) Start(seconds int) {
+
+	m.stopChannelMutex.Lock()
+	defer m.stopChannelMutex.Unlock()
+
+	// Don't start a second routine
+	if m.stopChannel != nil {
+		return
+	}
 
 	// Create a channel that will be used to send stop signal
-	stopChannel := make(chan int)
+	m.stopChannel = make(chan int)
 
 	// Start the monitoring routine using the provided number of seconds and the created stop channel
-	go monitorRoutine(seconds, stopChannel)
+	go m.monitorRoutine(seconds, m.stopChannel)
+}
 
-	return stopChannel
+// Stop stops the monitoring routine started with Start. If the routine is not running then nothing happens.
+func (m *Monitor) Stop() {
+
+	m.stopChannelMutex.Lock()
+	defer m.stopChannelMutex.Unlock()
+
+	if m.stopChannel != nil {
+		// Closing the channel is the condition of stopping for the routine
+		close(m.stopChannel)
+		m.stopChannel = nil
+	}
 }
 
 // monitorRoutine fetches all urls and checks whether people that are monitored are present on the platform.
@@ -120,7 +307,7 @@ func Start(seconds int) chan int {
 // Then it sleeps for the requested number of seconds (for safety reasons seconds cannot be smaller than MinimumSleepSeconds, if it is
 // then it the minimum value of 10 will be used instead).
 // Routine will stop if the channel is closed or value 1 is sent to the channel
-func monitorRoutine(seconds int, stopChannel chan int) {
+func (m *Monitor) monitorRoutine(seconds int, stopChannel chan int) {
 
 	// Make sure that there are at least 10 seconds between subsequent platform checks
 	if seconds < MinimumSleepSeconds {
@@ -143,7 +330,7 @@ func monitorRoutine(seconds int, stopChannel chan int) {
 		// Otherwise run the platform check
 		default:
 			{
-				runPlatfromCheck()
+				m.runPlatfromCheck()
 			}
 		}
 
@@ -154,18 +341,18 @@ func monitorRoutine(seconds int, stopChannel chan int) {
 
 // runPlatformCheck checks all registered platforms and subscriptions to those platforms and notifies all subscribers about eventual
 // matches.
-func runPlatfromCheck() {
+func (m *Monitor) runPlatfromCheck() {
 
 	logger.Log("Running platform check")
 
 	// Take ownership of the mutex in order to work with monitoredURLs - we don't want it to be modified in the process
-	monitoredURLsMutex.Lock()
-	defer monitoredURLsMutex.Unlock()
+	m.monitoredURLsMutex.Lock()
+	defer m.monitoredURLsMutex.Unlock()
 
 	// Contains users that should be notified - key is userID and value is the message to send to him
 	toNotify := make(map[string]string)
 
-	for url, subscriptions := range monitoredURLs {
+	for url, subscriptions := range m.monitoredURLs {
 
 		// Use helper to download the html
 		htmlText, err := downloadURLAsHTML(url)
@@ -192,12 +379,12 @@ func runPlatfromCheck() {
 	}
 
 	// Finally send notifications to users
-	sendToUsers(toNotify)
+	m.sendToUsers(toNotify)
 }
 
 // sendToUsers sends messages to a group of users.
 // Each key in the provided map is a userID. Each value corresponding to it is the content of the message that should be sent to that user.
-func sendToUsers(messages map[string]string) {
+func (m *Monitor) sendToUsers(messages map[string]string) {
 
 	// For each user to notify
 	for userID, message := range messages {
@@ -208,7 +395,7 @@ func sendToUsers(messages map[string]string) {
 		}
 
 		// And send it
-		communication.SendToUser(userID, messageSend)
+		m.communicator.SendToUser(userID, messageSend)
 	}
 }
 
@@ -286,11 +473,11 @@ func downloadURLAsHTML(url string) (string, error) {
 
 // addSubscriber adds a new subscriber to the specified url
 // Returns that can be sent to user as feedback (Information about success, failure, etc.).
-func addSubscriber(userID, subscribeTo, url string) string {
+func (m *Monitor) addSubscriber(userID, subscribeTo, url string) string {
 
 	// Take ownership of the mutex in order to work with monitoredURLs
-	monitoredURLsMutex.Lock()
-	defer monitoredURLsMutex.Unlock()
+	m.monitoredURLsMutex.Lock()
+	defer m.monitoredURLsMutex.Unlock()
 
 	// Create a subscription containing the required information
 	subscription := monitorSubscription{
@@ -299,38 +486,38 @@ func addSubscriber(userID, subscribeTo, url string) string {
 	}
 
 	// First, check if the url exists
-	if _, ok := monitoredURLs[url]; !ok {
+	if _, ok := m.monitoredURLs[url]; !ok {
 		// If not, add it to the map
-		monitoredURLs[url] = make(map[monitorSubscription]struct{})
+		m.monitoredURLs[url] = make(map[monitorSubscription]struct{})
 	}
 
 	// Check if such subscription is already present (url is guaranteed to be in the map)
-	if _, ok := monitoredURLs[url][subscription]; ok {
+	if _, ok := m.monitoredURLs[url][subscription]; ok {
 		// If so, notify the user that he's already subscribed to this particular person on this particular platform
 		return "You're already subscribed to this name on this url"
 	}
 
 	// If the subscription is new, add it to the map
-	monitoredURLs[url][subscription] = struct{}{}
+	m.monitoredURLs[url][subscription] = struct{}{}
 	return "Subscribed successfully"
 }
 
 // removeSubscriber removes all subscriptions assigned to the given userID.
 // Returns all removed subscriptions as a slice. Each entry has a form "url : subscribed_to".
-func removeSubscriber(userID string) []string {
+func (m *Monitor) removeSubscriber(userID string) []string {
 
 	// Take ownership of the mutex in order to work with monitoredURLs
-	monitoredURLsMutex.Lock()
-	defer monitoredURLsMutex.Unlock()
+	m.monitoredURLsMutex.Lock()
+	defer m.monitoredURLsMutex.Unlock()
 
 	// Slice for all removed subscriptions - it will be used to inform the user about all removed subscriptions
 	removedSubscriptions := []string{}
 
 	// For each registered url
-	for url, urlSubscriptions := range monitoredURLs {
+	for url, urlSubscriptions := range m.monitoredURLs {
 
 		// For each subscription in the url
-		for subscription := range monitoredURLs[url] {
+		for subscription := range m.monitoredURLs[url] {
 
 			// If its userID matches the searched one
 			if subscription.SubscriberID == userID {
@@ -344,7 +531,7 @@ func removeSubscriber(userID string) []string {
 
 			// If there are no more subscriptions for this url, remove it from the collection
 			if len(urlSubscriptions) == 0 {
-				delete(monitoredURLs, url)
+				delete(m.monitoredURLs, url)
 			}
 		}
 	}
@@ -353,39 +540,71 @@ func removeSubscriber(userID string) []string {
 }
 
 // removeSubscriberFrom removes the specified subscription (userID & subscribedTo pair) from the given url.
-// Notifies user (given by userID) about the result.
-// If the subscription wasn't found then nothing will happen.
-func removeSubscriberFrom(userID, subscribedTo, url string) {
+// Returns true if the subscription was found and removed, false if the user wasn't subscribed.
+func (m *Monitor) removeSubscriberFrom(userID, subscribedTo, url string) bool {
 
 	// Take ownership of the mutex in order to work with monitoredURLs
-	monitoredURLsMutex.Lock()
-	defer monitoredURLsMutex.Unlock()
+	m.monitoredURLsMutex.Lock()
+	defer m.monitoredURLsMutex.Unlock()
 
 	// Check if the url is present in the collection
-	if _, ok := monitoredURLs[url]; !ok {
+	if _, ok := m.monitoredURLs[url]; !ok {
 		// Nothing to do - user was not subscribed to anyone on that URL
-		// TODO: Notify user that he was not subscribed
-		return
+		return false
 	}
 
 	// Create a subscription containing the required information
 	subscription := monitorSubscription{
 		SubscriberID: userID,
-		SubscribedTo: subscribedTo,
+		SubscribedTo: strings.ToLower(subscribedTo),
 	}
 
 	// Check if the subscription is present
-	if _, ok := monitoredURLs[url][subscription]; ok {
-		// Subscription found: remove it
-		delete(monitoredURLs[url], subscription)
+	if _, ok := m.monitoredURLs[url][subscription]; !ok {
+		return false
+	}
+
+	// Subscription found: remove it
+	delete(m.monitoredURLs[url], subscription)
+
+	// If it was the last subscription to that url then remove the url as well
+	if len(m.monitoredURLs[url]) == 0 {
+		delete(m.monitoredURLs, url)
+	}
+
+	return true
+}
 
-		// If it was the last subscription to that url then remove the url as well
-		if len(monitoredURLs[url]) == 0 {
-			delete(monitoredURLs, url)
+// subscriptionsOf returns all subscriptions of the user, sorted. Each entry has a form "platform : subscribed_to", where platform
+// is the alias of the platform.
+func (m *Monitor) subscriptionsOf(userID string) []string {
+
+	// Take ownership of the mutex in order to work with monitoredURLs
+	m.monitoredURLsMutex.Lock()
+	defer m.monitoredURLsMutex.Unlock()
+
+	subscriptions := []string{}
+
+	for url, urlSubscriptions := range m.monitoredURLs {
+		for subscription := range urlSubscriptions {
+			if subscription.SubscriberID == userID {
+				subscriptions = append(subscriptions, m.platformAlias(url)+" : "+subscription.SubscribedTo)
+			}
 		}
+	}
 
-		// TODO: Notif the user that he unsubscribed successfully
-	} else {
-		// TODO: Notif the user that the requested subscription wasn't found
+	sort.Strings(subscriptions)
+	return subscriptions
+}
+
+// platformAlias returns the alias of the platform with the given url, or the url itself if it's not whitelisted
+func (m *Monitor) platformAlias(url string) string {
+
+	for alias, whitelistedURL := range m.whitelistedURLs {
+		if whitelistedURL == url {
+			return alias
+		}
 	}
+
+	return url
 }
@@ -17,7 +17,7 @@ var fileNames = map[string]string{
 const reactionImagesPath = "resources/imagereactions/"
 
 // ImageReaction returns a message containing some reaction image (depending on the invoked command)
-func ImageReaction(args *ct.CommandArgs) (*dg.MessageSend, error) {
+func ImageReaction(args *ct.CommandArgs) (*ct.Response, error) {
 
 	// Variable for full path of the file - initialize it with directory name
 	fullFilePath := reactionImagesPath
@@ -55,5 +55,5 @@ func ImageReaction(args *ct.CommandArgs) (*dg.MessageSend, error) {
 		},
 	}
 
-	return message, nil
+	return ct.MessageResponse(message), nil
 }
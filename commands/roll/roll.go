@@ -10,20 +10,32 @@ import (
 // Default maximum value for random number geenration - i.e. result of random will be from 0 to 100
 const defaultMaxRandomValue = 100
 
+// MaxRandomValue is the greatest boundary the user can request
+const MaxRandomValue = 1000000000
+
+// Arguments declares the arguments of the Roll command
+var Arguments = []ct.ArgumentSpec{
+	{
+		Name:        "max",
+		Description: "The greatest number that can be rolled, 100 by default",
+		Type:        ct.IntArgument,
+		Optional:    true,
+		Min:         1,
+		Max:         MaxRandomValue,
+	},
+}
+
 // Roll command
-// User arguments:
-// 1 - if convertible to int and positive it's treated as the boundary for random number generation
-func Roll(args *ct.CommandArgs) (*dg.MessageSend, error) {
+// User arguments (see Arguments):
+// 1 - max, optional, the boundary for random number generation
+func Roll(args *ct.CommandArgs) (*ct.Response, error) {
 
 	// Take the default max value
 	max := defaultMaxRandomValue
 
-	// If there is more than 1 argument
-	if len(args.UserArgs) > 0 {
-		// Try to convert it to an int, if conversion is successful and the number is positive use it as maximum instead
-		if conversion, err := strconv.Atoi(args.UserArgs[0]); err == nil && conversion > 0 {
-			max = conversion
-		}
+	// If the user provided the boundary, use it as maximum instead (it's guaranteed to be in range by the handler)
+	if args.Has("max") {
+		max = args.Int("max")
 	}
 
 	// Create a message to send, it has text content only. Text is generated by helper function
@@ -31,7 +43,7 @@ func Roll(args *ct.CommandArgs) (*dg.MessageSend, error) {
 		Content: rollHelper(max, args.Username),
 	}
 
-	return message, nil
+	return ct.MessageResponse(message), nil
 }
 
 // rollHelper returns a random integer number from 0 to max (excluding), assigns a reaction message that can be displayed to user.
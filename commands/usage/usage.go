@@ -0,0 +1,407 @@
+package usage
+
+import (
+	"encoding/json"
+	"errors"
+	dg "github.com/bwmarrin/discordgo"
+	ct "github.com/generalkenobi/makrochatbot/customtypes"
+	"github.com/generalkenobi/makrochatbot/logger"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// usageFileName is the name of the file in which usage statistics are stored
+const usageFileName = "usage.json"
+
+// dayFormat is the format of the days of the buckets, days are in UTC
+const dayFormat = "2006-01-02"
+
+// RetentionDays is the number of days for which usage is kept, older buckets are removed
+const RetentionDays = 90
+
+// saveInterval is the minimum time between two saves of the statistics, uses recorded in the meantime are saved with the next
+// use or by Flush
+const saveInterval = time.Minute
+
+// Limits of the stats command
+const (
+	// defaultStatsDays is the number of days summarized when the user doesn't specify it
+	defaultStatsDays = 30
+
+	// topEntries is the number of commands and users listed in the summary
+	topEntries = 10
+
+	// trendDays is the length of the periods compared in the trend
+	trendDays = 7
+)
+
+// statsEmbedColor is the color of the embed created by the stats command
+const statsEmbedColor = 0x2ecc71
+
+// DayCounts are the uses of commands in one guild on one day
+type DayCounts struct {
+
+	// Commands counts the uses of each command, key is the full name of the command (e.g. "monitor add")
+	Commands map[string]int
+
+	// Users counts the uses by each user, key is the user ID
+	Users map[string]int
+}
+
+// Stats counts uses of commands per command, user and guild in daily buckets and persists them in a JSON file, so that they
+// survive restarts. It is safe for concurrent use.
+type Stats struct {
+
+	// path of the file with the statistics, empty if they are not persisted
+	path string
+
+	// guilds holds the buckets of each guild, key is the guild ID ("" for direct messages). Key of the inner map is the day.
+	guilds map[string]map[string]*DayCounts
+
+	// dirty is true if there are uses that weren't saved yet
+	dirty bool
+
+	// lastSave is the time at which the statistics were last saved
+	lastSave time.Time
+
+	// mutex is used to synchronize access to guilds and the file
+	mutex sync.Mutex
+}
+
+// Arguments declares the arguments of the ShowStats command
+var Arguments = []ct.ArgumentSpec{
+	{
+		Name:        "days",
+		Description: "Number of days to summarize, " + strconv.Itoa(defaultStatsDays) + " by default",
+		Type:        ct.IntArgument,
+		Optional:    true,
+		Min:         1,
+		Max:         RetentionDays,
+	},
+}
+
+// Open creates statistics persisted in the given directory. Statistics saved there earlier are loaded.
+// If directory is empty then the statistics are not persisted - they are kept in memory only.
+// Returns an error if the directory can't be created or the existing file can't be read.
+func Open(directory string) (*Stats, error) {
+
+	stats := &Stats{guilds: make(map[string]map[string]*DayCounts)}
+
+	if directory == "" {
+		return stats, nil
+	}
+
+	// Make sure the directory exists
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return nil, errors.New("Can't create data directory " + directory + ". Details: " + err.Error())
+	}
+
+	stats.path = filepath.Join(directory, usageFileName)
+
+	// Load the statistics saved earlier, if there are any
+	data, err := ioutil.ReadFile(stats.path)
+
+	if os.IsNotExist(err) {
+		return stats, nil
+	}
+
+	if err != nil {
+		return nil, errors.New("Can't read " + stats.path + ". Details: " + err.Error())
+	}
+
+	if err = json.Unmarshal(data, &stats.guilds); err != nil {
+		return nil, errors.New("Can't decode " + stats.path + ". Details: " + err.Error())
+	}
+
+	// Decoding "null" results in a nil map
+	if stats.guilds == nil {
+		stats.guilds = make(map[string]map[string]*DayCounts)
+	}
+
+	return stats, nil
+}
+
+// Record counts a use of the command by the user in the guild (empty for direct messages). The statistics are saved if the last
+// save was more than saveInterval ago, errors are only logged - losing a use is not worth failing the command.
+func (s *Stats) Record(guildID, userID, commandName string) {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	day := time.Now().UTC().Format(dayFormat)
+
+	if s.guilds[guildID] == nil {
+		s.guilds[guildID] = make(map[string]*DayCounts)
+	}
+
+	counts, ok := s.guilds[guildID][day]
+	if !ok {
+		counts = &DayCounts{Commands: make(map[string]int), Users: make(map[string]int)}
+		s.guilds[guildID][day] = counts
+	}
+
+	counts.Commands[commandName]++
+	counts.Users[userID]++
+	s.dirty = true
+
+	if time.Since(s.lastSave) < saveInterval {
+		return
+	}
+
+	if err := s.save(); err != nil {
+		logger.LogError(err)
+	}
+}
+
+// Flush saves the uses that weren't saved yet, it should be called before the program exits
+func (s *Stats) Flush() error {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.dirty {
+		return nil
+	}
+
+	return s.save()
+}
+
+// Middleware counts every use of the command that reaches it, so it should come after middlewares that deny uses
+// (e.g. permissions and rate limits) - uses that were denied are not counted
+func (s *Stats) Middleware(command *ct.Command, next ct.CommandHandler) ct.CommandHandler {
+
+	return func(args *ct.CommandArgs) (*ct.Response, error) {
+
+		s.Record(args.GuildID, args.UserID, command.Name)
+		return next(args)
+	}
+}
+
+// ShowStats command replies with an embed summarizing the uses of commands in the guild - the most used commands, the most active
+// users and the trend of the last days. Uses in direct messages are counted too, but they are not shown - they are made by users
+// of all servers, whose activity should stay private. The command has to be registered as guild-only (see ct.Command.GuildOnly).
+// User arguments (see Arguments):
+// 1 - days, optional, number of days to summarize
+func (s *Stats) ShowStats(args *ct.CommandArgs) (*ct.Response, error) {
+
+	days := defaultStatsDays
+	if args.Has("days") {
+		days = args.Int("days")
+	}
+
+	period := "in the last " + strconv.Itoa(days) + " days"
+	if days == 1 {
+		period = "today"
+	}
+
+	commands, users := s.totals(args.GuildID, days)
+
+	embed := &dg.MessageEmbed{
+		Title: "Usage of commands",
+		Color: statsEmbedColor,
+	}
+
+	total := 0
+	for _, count := range commands {
+		total += count
+	}
+
+	if total == 0 {
+		embed.Description = "No commands were used on this server " + period + "."
+		return ct.MessageResponse(&dg.MessageSend{Embeds: []*dg.MessageEmbed{embed}}), nil
+	}
+
+	embed.Description = "Commands were used **" + strconv.Itoa(total) + "** times by **" + strconv.Itoa(len(users)) + "** users on this server " +
+		period + "."
+
+	// Top commands and users
+	var commandLines, userLines []string
+
+	for _, entry := range topCounts(commands, topEntries) {
+		commandLines = append(commandLines, "`"+entry.name+"` - "+strconv.Itoa(entry.count))
+	}
+
+	for _, entry := range topCounts(users, topEntries) {
+		userLines = append(userLines, "<@"+entry.name+"> - "+strconv.Itoa(entry.count))
+	}
+
+	// The trend doesn't depend on the summarized period, it always compares the last two weeks
+	daily := s.dailyCounts(args.GuildID, 2*trendDays)
+
+	// Uses on each of the last days, the newest first
+	var dayLines []string
+	for i := 0; i < trendDays; i++ {
+		day := time.Now().UTC().AddDate(0, 0, -i).Format(dayFormat)
+		dayLines = append(dayLines, "`"+day+"` - "+strconv.Itoa(daily[i]))
+	}
+
+	embed.Fields = []*dg.MessageEmbedField{
+		{Name: "Top commands", Value: strings.Join(commandLines, "\n"), Inline: true},
+		{Name: "Top users", Value: strings.Join(userLines, "\n"), Inline: true},
+		{Name: "Trend", Value: describeTrend(daily) + "\n" + strings.Join(dayLines, "\n")},
+	}
+
+	return ct.MessageResponse(&dg.MessageSend{Embeds: []*dg.MessageEmbed{embed}}), nil
+}
+
+// totals sums the uses of each command and by each user in the guild over the last days (including today)
+func (s *Stats) totals(guildID string, days int) (map[string]int, map[string]int) {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	commands, users := make(map[string]int), make(map[string]int)
+
+	for i := 0; i < days; i++ {
+
+		counts, ok := s.guilds[guildID][time.Now().UTC().AddDate(0, 0, -i).Format(dayFormat)]
+		if !ok {
+			continue
+		}
+
+		for name, count := range counts.Commands {
+			commands[name] += count
+		}
+
+		for userID, count := range counts.Users {
+			users[userID] += count
+		}
+	}
+
+	return commands, users
+}
+
+// dailyCounts returns the number of uses in the guild on each of the last days, today first
+func (s *Stats) dailyCounts(guildID string, days int) []int {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	daily := make([]int, days)
+
+	for i := range daily {
+
+		counts, ok := s.guilds[guildID][time.Now().UTC().AddDate(0, 0, -i).Format(dayFormat)]
+		if !ok {
+			continue
+		}
+
+		for _, count := range counts.Commands {
+			daily[i] += count
+		}
+	}
+
+	return daily
+}
+
+// save removes the buckets older than RetentionDays and writes the statistics to the file. The file is replaced atomically, so
+// that a crash can't leave it half-written. Mutex has to be held by the caller.
+func (s *Stats) save() error {
+
+	// Days are formatted so that they can be compared as strings
+	oldestDay := time.Now().UTC().AddDate(0, 0, 1-RetentionDays).Format(dayFormat)
+
+	for guildID, days := range s.guilds {
+
+		for day := range days {
+			if day < oldestDay {
+				delete(days, day)
+			}
+		}
+
+		if len(days) == 0 {
+			delete(s.guilds, guildID)
+		}
+	}
+
+	s.lastSave = time.Now()
+
+	// Nothing to write if the statistics are not persisted
+	if s.path == "" {
+		s.dirty = false
+		return nil
+	}
+
+	data, err := json.Marshal(s.guilds)
+	if err != nil {
+		return errors.New("Can't encode usage statistics. Details: " + err.Error())
+	}
+
+	// Write to a temporary file and then replace the old one with it
+	temporaryPath := s.path + ".tmp"
+
+	if err = ioutil.WriteFile(temporaryPath, data, 0644); err != nil {
+		return errors.New("Can't write " + temporaryPath + ". Details: " + err.Error())
+	}
+
+	if err = os.Rename(temporaryPath, s.path); err != nil {
+		return errors.New("Can't replace " + s.path + ". Details: " + err.Error())
+	}
+
+	s.dirty = false
+	return nil
+}
+
+// namedCount is a count of uses of a command or by a user
+type namedCount struct {
+	name  string
+	count int
+}
+
+// topCounts returns at most limit of the greatest counts, the greatest first. Equal counts are ordered by name.
+func topCounts(counts map[string]int, limit int) []namedCount {
+
+	sorted := make([]namedCount, 0, len(counts))
+	for name, count := range counts {
+		sorted = append(sorted, namedCount{name: name, count: count})
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].count != sorted[j].count {
+			return sorted[i].count > sorted[j].count
+		}
+
+		return sorted[i].name < sorted[j].name
+	})
+
+	if len(sorted) > limit {
+		sorted = sorted[:limit]
+	}
+
+	return sorted
+}
+
+// describeTrend compares the uses in the last trendDays days with the trendDays days before them. daily holds the uses on each
+// day, today first, for twice as many days.
+func describeTrend(daily []int) string {
+
+	recent, previous := 0, 0
+	for i, count := range daily {
+		if i < trendDays {
+			recent += count
+		} else {
+			previous += count
+		}
+	}
+
+	description := strconv.Itoa(recent) + " uses in the last " + strconv.Itoa(trendDays) + " days"
+
+	if previous == 0 {
+		return description + ", none in the " + strconv.Itoa(trendDays) + " days before."
+	}
+
+	change := (recent - previous) * 100 / previous
+
+	sign := ""
+	if change >= 0 {
+		sign = "+"
+	}
+
+	return description + ", " + sign + strconv.Itoa(change) + "% compared to the " + strconv.Itoa(trendDays) + " days before."
+}
@@ -0,0 +1,221 @@
+package usage
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// daysAgo returns the bucket day the given number of days before today
+func daysAgo(days int) string {
+	return time.Now().UTC().AddDate(0, 0, -days).Format(dayFormat)
+}
+
+// bucket creates the counts of one day, with uses of the command by the user
+func bucket(command, userID string, uses int) *DayCounts {
+	return &DayCounts{Commands: map[string]int{command: uses}, Users: map[string]int{userID: uses}}
+}
+
+func TestRecordCountsDailyBuckets(t *testing.T) {
+
+	stats, err := Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats.Record("guild", "user", "roll")
+	stats.Record("guild", "user", "roll")
+	stats.Record("guild", "admin", "monitor add")
+	stats.Record("other guild", "user", "roll")
+	stats.Record("", "user", "help")
+
+	expected := map[string]map[string]*DayCounts{
+		"guild": {daysAgo(0): {
+			Commands: map[string]int{"roll": 2, "monitor add": 1},
+			Users:    map[string]int{"user": 2, "admin": 1},
+		}},
+		"other guild": {daysAgo(0): bucket("roll", "user", 1)},
+		"":            {daysAgo(0): bucket("help", "user", 1)},
+	}
+
+	if !reflect.DeepEqual(stats.guilds, expected) {
+		t.Errorf("Buckets = %v, expected %v", stats.guilds, expected)
+	}
+}
+
+func TestTotals(t *testing.T) {
+
+	stats, err := Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats.guilds["guild"] = map[string]*DayCounts{
+		daysAgo(0):  bucket("roll", "user", 1),
+		daysAgo(1):  bucket("roll", "admin", 2),
+		daysAgo(6):  bucket("help", "user", 4),
+		daysAgo(40): bucket("help", "admin", 8),
+	}
+
+	stats.guilds["other guild"] = map[string]*DayCounts{daysAgo(0): bucket("roll", "user", 16)}
+
+	tests := []struct {
+		days     int
+		commands map[string]int
+		users    map[string]int
+		daily    []int
+	}{
+		{days: 1, commands: map[string]int{"roll": 1}, users: map[string]int{"user": 1}, daily: []int{1}},
+		{days: 2, commands: map[string]int{"roll": 3}, users: map[string]int{"user": 1, "admin": 2}, daily: []int{1, 2}},
+		{
+			days:     7,
+			commands: map[string]int{"roll": 3, "help": 4},
+			users:    map[string]int{"user": 5, "admin": 2},
+			daily:    []int{1, 2, 0, 0, 0, 0, 4},
+		},
+		{days: RetentionDays, commands: map[string]int{"roll": 3, "help": 12}, users: map[string]int{"user": 5, "admin": 10}},
+	}
+
+	for _, test := range tests {
+
+		commands, users := stats.totals("guild", test.days)
+
+		if !reflect.DeepEqual(commands, test.commands) || !reflect.DeepEqual(users, test.users) {
+			t.Errorf("totals for %d days = %v and %v, expected %v and %v", test.days, commands, users, test.commands, test.users)
+		}
+
+		if test.daily == nil {
+			continue
+		}
+
+		if daily := stats.dailyCounts("guild", test.days); !reflect.DeepEqual(daily, test.daily) {
+			t.Errorf("dailyCounts for %d days = %v, expected %v", test.days, daily, test.daily)
+		}
+	}
+}
+
+func TestSaveRemovesOldBuckets(t *testing.T) {
+
+	directory := t.TempDir()
+
+	stats, err := Open(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats.guilds["guild"] = map[string]*DayCounts{
+		daysAgo(0):                 bucket("roll", "user", 1),
+		daysAgo(RetentionDays - 1): bucket("roll", "user", 2),
+		daysAgo(RetentionDays):     bucket("roll", "user", 4),
+		daysAgo(2 * RetentionDays): bucket("roll", "user", 8),
+	}
+
+	// Guilds without recent uses are removed entirely
+	stats.guilds["old guild"] = map[string]*DayCounts{daysAgo(RetentionDays + 1): bucket("roll", "user", 16)}
+
+	stats.dirty = true
+	if err = stats.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]map[string]*DayCounts{
+		"guild": {
+			daysAgo(0):                 bucket("roll", "user", 1),
+			daysAgo(RetentionDays - 1): bucket("roll", "user", 2),
+		},
+	}
+
+	if !reflect.DeepEqual(stats.guilds, expected) {
+		t.Errorf("Buckets after saving = %v, expected %v", stats.guilds, expected)
+	}
+
+	// The statistics survive a restart
+	reopened, err := Open(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(reopened.guilds, expected) {
+		t.Errorf("Loaded buckets = %v, expected %v", reopened.guilds, expected)
+	}
+}
+
+func TestRecordSavesOncePerInterval(t *testing.T) {
+
+	directory := t.TempDir()
+
+	stats, err := Open(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// savedUses returns the number of uses of roll today in the file
+	savedUses := func() int {
+
+		data, err := ioutil.ReadFile(filepath.Join(directory, usageFileName))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var guilds map[string]map[string]*DayCounts
+		if err = json.Unmarshal(data, &guilds); err != nil {
+			t.Fatal(err)
+		}
+
+		return guilds["guild"][daysAgo(0)].Commands["roll"]
+	}
+
+	// The first use is saved right away, the next ones wait for the interval or Flush
+	stats.Record("guild", "user", "roll")
+	stats.Record("guild", "user", "roll")
+
+	if uses := savedUses(); uses != 1 {
+		t.Errorf("Saved %d uses before Flush, expected 1", uses)
+	}
+
+	if err = stats.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if uses := savedUses(); uses != 2 {
+		t.Errorf("Saved %d uses after Flush, expected 2", uses)
+	}
+}
+
+func TestDescribeTrend(t *testing.T) {
+
+	tests := []struct {
+		daily       []int
+		description string
+	}{
+		{daily: make([]int, 2*trendDays), description: "0 uses in the last 7 days, none in the 7 days before."},
+		{daily: []int{3, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0}, description: "4 uses in the last 7 days, none in the 7 days before."},
+		{daily: []int{3, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0}, description: "3 uses in the last 7 days, +50% compared to the 7 days before."},
+		{daily: []int{1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 4}, description: "1 uses in the last 7 days, -75% compared to the 7 days before."},
+		{daily: []int{2, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0}, description: "2 uses in the last 7 days, +0% compared to the 7 days before."},
+	}
+
+	for _, test := range tests {
+		if description := describeTrend(test.daily); description != test.description {
+			t.Errorf("describeTrend(%v) = %q, expected %q", test.daily, description, test.description)
+		}
+	}
+}
+
+func TestTopCounts(t *testing.T) {
+
+	counts := map[string]int{"roll": 5, "help": 9, "monitor add": 5, "prefix": 1}
+
+	expected := []namedCount{{name: "help", count: 9}, {name: "monitor add", count: 5}, {name: "roll", count: 5}}
+
+	if top := topCounts(counts, 3); !reflect.DeepEqual(top, expected) {
+		t.Errorf("topCounts = %v, expected %v", top, expected)
+	}
+
+	if top := topCounts(counts, 10); len(top) != len(counts) {
+		t.Errorf("topCounts returned %d counts, expected all %d", len(top), len(counts))
+	}
+}
@@ -0,0 +1,327 @@
+package communication
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	dg "github.com/bwmarrin/discordgo"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Identifiers used for messages typed into the console
+const (
+	// ConsoleChannelID is the ID of the channel all console messages are posted to
+	ConsoleChannelID = "console"
+
+	// ConsoleGuildID is the ID of the guild all console messages are posted to
+	ConsoleGuildID = "console-guild"
+
+	// ConsoleUserID is the ID of the user typing into the console
+	ConsoleUserID = "console-user"
+
+	// ConsoleUsername is the name of the user typing into the console
+	ConsoleUsername = "console"
+
+	// ConsoleBotUserID is the user ID of the bot, it can be mentioned in the console as <@console-bot>
+	ConsoleBotUserID = "console-bot"
+)
+
+// ConsoleTransport is a Transport implementation which reads messages line by line from an input (e.g. stdin) and prints
+// everything the bot sends to an output (e.g. stdout). It allows running the bot locally, without Discord.
+type ConsoleTransport struct {
+
+	// input is the source of incoming messages, each line is one message
+	input io.Reader
+
+	// output is where sent messages are printed
+	output io.Writer
+
+	// outputMutex makes sure that printed messages don't get mixed
+	outputMutex sync.Mutex
+
+	// handlers are the functions registered with OnMessage
+	handlers []func(*dg.Message)
+
+	// done is closed when the input is exhausted
+	done chan struct{}
+
+	// lastID is used to generate IDs of messages
+	lastID int
+}
+
+// NewConsoleTransport creates a new console transport reading from input and writing to output
+func NewConsoleTransport(input io.Reader, output io.Writer) *ConsoleTransport {
+	return &ConsoleTransport{
+		input:  input,
+		output: output,
+		done:   make(chan struct{}),
+	}
+}
+
+// Open starts reading lines from the input
+func (t *ConsoleTransport) Open() error {
+
+	if t.input == nil {
+		return errors.New("Can't open console transport - input is nil")
+	}
+
+	go t.readRoutine()
+	return nil
+}
+
+// Close does nothing, console transport doesn't hold any resources
+func (t *ConsoleTransport) Close() error {
+	return nil
+}
+
+// Done returns a channel which is closed when the input is exhausted (e.g. user pressed CTRL-D)
+func (t *ConsoleTransport) Done() <-chan struct{} {
+	return t.done
+}
+
+// OnMessage registers the handler for lines read from the input.
+// It has to be called before Open.
+func (t *ConsoleTransport) OnMessage(handler func(*dg.Message)) {
+	t.handlers = append(t.handlers, handler)
+}
+
+// OnMessageEdit does nothing - lines typed into the console can't be edited
+func (t *ConsoleTransport) OnMessageEdit(handler func(*dg.Message)) {
+}
+
+// OnMessageDelete does nothing - lines typed into the console can't be deleted
+func (t *ConsoleTransport) OnMessageDelete(handler func(*dg.Message)) {
+}
+
+// OnReactionAdd does nothing - reactions can't be added in the console
+func (t *ConsoleTransport) OnReactionAdd(handler func(*dg.MessageReaction)) {
+}
+
+// OnReactionRemove does nothing - reactions can't be removed in the console
+func (t *ConsoleTransport) OnReactionRemove(handler func(*dg.MessageReaction)) {
+}
+
+// OnInteraction does nothing - interactions can't be created in the console, only typed commands are supported
+func (t *ConsoleTransport) OnInteraction(handler func(*dg.Interaction)) {
+}
+
+// DeferInteraction returns an error - interactions can't be created in the console
+func (t *ConsoleTransport) DeferInteraction(interaction *dg.Interaction, ephemeral bool) error {
+	return errors.New("Console transport doesn't support interactions")
+}
+
+// EditInteractionResponse prints the response to the output, like RespondToInteraction
+func (t *ConsoleTransport) EditInteractionResponse(interaction *dg.Interaction, message *dg.MessageSend) (*dg.Message, error) {
+	return t.SendMessage(interaction.ChannelID, message)
+}
+
+// DeleteInteractionResponse returns an error - interactions can't be created in the console, so they are never responded to
+func (t *ConsoleTransport) DeleteInteractionResponse(interaction *dg.Interaction) error {
+	return errors.New("Console transport doesn't support interactions")
+}
+
+// RespondToInteraction prints the response to the output, as a message sent to the channel of the interaction
+func (t *ConsoleTransport) RespondToInteraction(interaction *dg.Interaction, message *dg.MessageSend) error {
+	_, err := t.SendMessage(interaction.ChannelID, message)
+	return err
+}
+
+// FollowUpInteraction prints the message to the output, like RespondToInteraction
+func (t *ConsoleTransport) FollowUpInteraction(interaction *dg.Interaction, message *dg.MessageSend) (*dg.Message, error) {
+	return t.SendMessage(interaction.ChannelID, message)
+}
+
+// InteractionResponse returns an error - interactions can't be created in the console, so they are never responded to
+func (t *ConsoleTransport) InteractionResponse(interaction *dg.Interaction) (*dg.Message, error) {
+	return nil, errors.New("Console transport doesn't support interactions")
+}
+
+// EditInteractionMessage prints the new version of the message to the output, like EditMessage
+func (t *ConsoleTransport) EditInteractionMessage(interaction *dg.Interaction, messageID string, message *dg.MessageSend) error {
+	_, err := t.EditMessage(interaction.ChannelID, messageID, message)
+	return err
+}
+
+// AddReaction prints the reaction to the output
+func (t *ConsoleTransport) AddReaction(channelID, messageID, emoji string) error {
+
+	t.outputMutex.Lock()
+	defer t.outputMutex.Unlock()
+
+	fmt.Fprintln(t.output, "[#"+channelID+"] [reaction to "+messageID+": "+emoji+"]")
+	return nil
+}
+
+// RemoveReaction prints the removal of the reaction to the output
+func (t *ConsoleTransport) RemoveReaction(channelID, messageID, emoji, userID string) error {
+
+	t.outputMutex.Lock()
+	defer t.outputMutex.Unlock()
+
+	fmt.Fprintln(t.output, "[#"+channelID+"] [reaction of "+userID+" removed from "+messageID+": "+emoji+"]")
+	return nil
+}
+
+// PublishCommands prints the names of the published commands to the output
+func (t *ConsoleTransport) PublishCommands(commands []*dg.ApplicationCommand) error {
+
+	t.outputMutex.Lock()
+	defer t.outputMutex.Unlock()
+
+	names := make([]string, len(commands))
+	for i, command := range commands {
+		names[i] = "/" + command.Name
+	}
+
+	fmt.Fprintln(t.output, "[commands] "+strings.Join(names, " "))
+	return nil
+}
+
+// SendMessage prints the message to the output. Direct messages are marked with the ID of the receiving user.
+func (t *ConsoleTransport) SendMessage(channelID string, message *dg.MessageSend) (*dg.Message, error) {
+
+	t.outputMutex.Lock()
+	defer t.outputMutex.Unlock()
+
+	// Create a header describing where the message would go
+	var header string
+	if strings.HasPrefix(channelID, userChannelPrefix) {
+		header = "[DM to " + strings.TrimPrefix(channelID, userChannelPrefix) + "]"
+	} else {
+		header = "[#" + channelID + "]"
+	}
+
+	// Mark replies with the message they refer to
+	if message.Reference != nil {
+		header += " [reply to " + message.Reference.MessageID + "]"
+	}
+
+	// Print the text content, if any
+	if message.Content != "" {
+		fmt.Fprintln(t.output, header, message.Content)
+	}
+
+	// Print the embeds
+	for _, embed := range message.Embeds {
+		fmt.Fprintln(t.output, header, formatEmbed(embed))
+	}
+
+	// Print names of the attached files, close their readers as nobody else will read them
+	for _, file := range message.Files {
+		fmt.Fprintln(t.output, header, "[attachment: "+file.Name+"]")
+
+		if closer, ok := file.Reader.(io.Closer); ok {
+			closer.Close()
+		}
+	}
+
+	t.lastID++
+	return &dg.Message{ID: "console-message-" + strconv.Itoa(t.lastID), ChannelID: channelID, Content: message.Content}, nil
+}
+
+// EditMessage prints the new version of the message to the output, marked as an edit
+func (t *ConsoleTransport) EditMessage(channelID, messageID string, message *dg.MessageSend) (*dg.Message, error) {
+
+	t.outputMutex.Lock()
+	fmt.Fprintln(t.output, "[#"+channelID+"] [edited "+messageID+"]")
+	t.outputMutex.Unlock()
+
+	if _, err := t.SendMessage(channelID, message); err != nil {
+		return nil, err
+	}
+
+	return &dg.Message{ID: messageID, ChannelID: channelID, Content: message.Content}, nil
+}
+
+// DeleteMessage prints the deletion to the output
+func (t *ConsoleTransport) DeleteMessage(channelID, messageID string) error {
+
+	t.outputMutex.Lock()
+	defer t.outputMutex.Unlock()
+
+	fmt.Fprintln(t.output, "[#"+channelID+"] [deleted "+messageID+"]")
+	return nil
+}
+
+// UserChannel returns ID of the direct message channel with the given user
+func (t *ConsoleTransport) UserChannel(userID string) (string, error) {
+	return userChannelPrefix + userID, nil
+}
+
+// BotUserID returns ConsoleBotUserID
+func (t *ConsoleTransport) BotUserID() string {
+	return ConsoleBotUserID
+}
+
+// UpdateStatus prints the new status to the output
+func (t *ConsoleTransport) UpdateStatus(status string) error {
+
+	t.outputMutex.Lock()
+	defer t.outputMutex.Unlock()
+
+	fmt.Fprintln(t.output, "[status] "+status)
+	return nil
+}
+
+// Member returns information about a member. The console user owns the console guild and has all permissions, so that
+// every command can be tried locally. Other users have no roles and no permissions.
+func (t *ConsoleTransport) Member(guildID, channelID, userID string) (*MemberInfo, error) {
+
+	if userID == ConsoleUserID {
+		return &MemberInfo{IsGuildOwner: true, Permissions: dg.PermissionAll}, nil
+	}
+
+	return &MemberInfo{}, nil
+}
+
+// readRoutine reads lines from input and passes them to handlers until the input is exhausted
+func (t *ConsoleTransport) readRoutine() {
+
+	// Notify everyone waiting that there will be no more input
+	defer close(t.done)
+
+	scanner := bufio.NewScanner(t.input)
+
+	for scanner.Scan() {
+
+		t.outputMutex.Lock()
+		t.lastID++
+		id := t.lastID
+		t.outputMutex.Unlock()
+
+		// Create a message as if it was posted by the console user
+		message := &dg.Message{
+			ID:        "console-message-" + strconv.Itoa(id),
+			ChannelID: ConsoleChannelID,
+			GuildID:   ConsoleGuildID,
+			Content:   scanner.Text(),
+			Author: &dg.User{
+				ID:       ConsoleUserID,
+				Username: ConsoleUsername,
+			},
+		}
+
+		for _, handler := range t.handlers {
+			handler(message)
+		}
+	}
+}
+
+// formatEmbed creates a plain text representation of the embed
+func formatEmbed(embed *dg.MessageEmbed) string {
+
+	lines := []string{"[embed: " + embed.Title + "]"}
+
+	if embed.Description != "" {
+		lines = append(lines, embed.Description)
+	}
+
+	for _, field := range embed.Fields {
+		lines = append(lines, field.Name+": "+field.Value)
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,356 @@
+package communication
+
+import (
+	"errors"
+	dg "github.com/bwmarrin/discordgo"
+)
+
+// DiscordTransport is a Transport implementation which communicates with Discord using a discordgo session
+type DiscordTransport struct {
+
+	// session is the discordgo session used to communicate with Discord
+	session *dg.Session
+}
+
+// NewDiscordTransport creates a new transport using the given bot token. The connection is not opened until Open is called.
+// If the discordgo session couldn't be created then the returned transport is nil and error contains information about the error.
+func NewDiscordTransport(token string) (*DiscordTransport, error) {
+
+	// Create a new session for Discord
+	session, err := dg.New("Bot " + token)
+
+	// If the process failed return an error
+	if err != nil {
+		return nil, errors.New("Can't create Discord session. Details: " + err.Error())
+	}
+
+	return &DiscordTransport{session: session}, nil
+}
+
+// Open opens the websocket connection to Discord
+func (t *DiscordTransport) Open() error {
+
+	// Try to open connection, if it failed return an error
+	if err := t.session.Open(); err != nil {
+		return errors.New("Can't open websocket connection to Discord. Details: " + err.Error())
+	}
+
+	return nil
+}
+
+// BotUserID returns the ID of the bot user, which is known once the connection to Discord is ready
+func (t *DiscordTransport) BotUserID() string {
+
+	if t.session.State == nil || t.session.State.User == nil {
+		return ""
+	}
+
+	return t.session.State.User.ID
+}
+
+// Close closes the websocket connection to Discord
+func (t *DiscordTransport) Close() error {
+	return t.session.Close()
+}
+
+// OnMessage registers the handler for messages created on any channel visible to the bot
+func (t *DiscordTransport) OnMessage(handler func(*dg.Message)) {
+
+	// Wrap the handler in a discordgo event handler which unpacks the created message
+	t.session.AddHandler(func(session *dg.Session, event *dg.MessageCreate) {
+		handler(event.Message)
+	})
+}
+
+// OnMessageEdit registers the handler for messages edited on any channel visible to the bot
+func (t *DiscordTransport) OnMessageEdit(handler func(*dg.Message)) {
+
+	// Wrap the handler in a discordgo event handler which unpacks the edited message
+	t.session.AddHandler(func(session *dg.Session, event *dg.MessageUpdate) {
+		handler(event.Message)
+	})
+}
+
+// OnMessageDelete registers the handler for messages deleted on any channel visible to the bot
+func (t *DiscordTransport) OnMessageDelete(handler func(*dg.Message)) {
+
+	// Wrap the handler in a discordgo event handler which unpacks the deleted message
+	t.session.AddHandler(func(session *dg.Session, event *dg.MessageDelete) {
+		handler(event.Message)
+	})
+}
+
+// OnReactionAdd registers the handler for reactions added to messages on any channel visible to the bot
+func (t *DiscordTransport) OnReactionAdd(handler func(*dg.MessageReaction)) {
+
+	// Wrap the handler in a discordgo event handler which unpacks the reaction
+	t.session.AddHandler(func(session *dg.Session, event *dg.MessageReactionAdd) {
+		handler(event.MessageReaction)
+	})
+}
+
+// OnReactionRemove registers the handler for reactions removed from messages on any channel visible to the bot
+func (t *DiscordTransport) OnReactionRemove(handler func(*dg.MessageReaction)) {
+
+	// Wrap the handler in a discordgo event handler which unpacks the reaction
+	t.session.AddHandler(func(session *dg.Session, event *dg.MessageReactionRemove) {
+		handler(event.MessageReaction)
+	})
+}
+
+// OnInteraction registers the handler for interactions with the bot, e.g. uses of its slash commands
+func (t *DiscordTransport) OnInteraction(handler func(*dg.Interaction)) {
+
+	// Wrap the handler in a discordgo event handler which unpacks the interaction
+	t.session.AddHandler(func(session *dg.Session, event *dg.InteractionCreate) {
+		handler(event.Interaction)
+	})
+}
+
+// RespondToInteraction replies to the interaction with a message sent to the channel in which the interaction happened
+func (t *DiscordTransport) RespondToInteraction(interaction *dg.Interaction, message *dg.MessageSend) error {
+
+	response := &dg.InteractionResponse{
+		Type: dg.InteractionResponseChannelMessageWithSource,
+		Data: &dg.InteractionResponseData{
+			Content: message.Content,
+			Embeds:  message.Embeds,
+			Files:   message.Files,
+			Flags:   message.Flags,
+		},
+	}
+
+	if err := t.session.InteractionRespond(interaction, response); err != nil {
+		return errors.New("Can't respond to interaction. Details: " + err.Error())
+	}
+
+	return nil
+}
+
+// DeferInteraction acknowledges the interaction, Discord shows that the bot is thinking until the response is edited
+func (t *DiscordTransport) DeferInteraction(interaction *dg.Interaction, ephemeral bool) error {
+
+	response := &dg.InteractionResponse{
+		Type: dg.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &dg.InteractionResponseData{},
+	}
+
+	if ephemeral {
+		response.Data.Flags = dg.MessageFlagsEphemeral
+	}
+
+	if err := t.session.InteractionRespond(interaction, response); err != nil {
+		return errors.New("Can't acknowledge interaction. Details: " + err.Error())
+	}
+
+	return nil
+}
+
+// EditInteractionResponse replaces the response to the interaction. Discord allows it only for a limited time after the
+// interaction (15 minutes).
+func (t *DiscordTransport) EditInteractionResponse(interaction *dg.Interaction, message *dg.MessageSend) (*dg.Message, error) {
+
+	edit := &dg.WebhookEdit{
+		Content: &message.Content,
+		Embeds:  &message.Embeds,
+		Files:   message.Files,
+	}
+
+	edited, err := t.session.InteractionResponseEdit(interaction, edit)
+	if err != nil {
+		return nil, errors.New("Can't edit response to interaction. Details: " + err.Error())
+	}
+
+	return edited, nil
+}
+
+// DeleteInteractionResponse deletes the response to the interaction
+func (t *DiscordTransport) DeleteInteractionResponse(interaction *dg.Interaction) error {
+
+	if err := t.session.InteractionResponseDelete(interaction); err != nil {
+		return errors.New("Can't delete response to interaction. Details: " + err.Error())
+	}
+
+	return nil
+}
+
+// FollowUpInteraction sends a follow-up message to the interaction, it has to be responded to first
+func (t *DiscordTransport) FollowUpInteraction(interaction *dg.Interaction, message *dg.MessageSend) (*dg.Message, error) {
+
+	params := &dg.WebhookParams{
+		Content: message.Content,
+		Embeds:  message.Embeds,
+		Files:   message.Files,
+		Flags:   message.Flags,
+	}
+
+	sent, err := t.session.FollowupMessageCreate(interaction, true, params)
+	if err != nil {
+		return nil, errors.New("Can't send follow-up message to interaction. Details: " + err.Error())
+	}
+
+	return sent, nil
+}
+
+// InteractionResponse requests the message created by the response to the interaction from Discord
+func (t *DiscordTransport) InteractionResponse(interaction *dg.Interaction) (*dg.Message, error) {
+
+	response, err := t.session.InteractionResponse(interaction)
+	if err != nil {
+		return nil, errors.New("Can't get response to interaction. Details: " + err.Error())
+	}
+
+	return response, nil
+}
+
+// EditInteractionMessage edits the response or a follow-up message of the interaction. Discord allows it only for a limited
+// time after the interaction (15 minutes).
+func (t *DiscordTransport) EditInteractionMessage(interaction *dg.Interaction, messageID string, message *dg.MessageSend) error {
+
+	edit := &dg.WebhookEdit{
+		Content: &message.Content,
+		Embeds:  &message.Embeds,
+	}
+
+	if _, err := t.session.FollowupMessageEdit(interaction, messageID, edit); err != nil {
+		return errors.New("Can't edit message " + messageID + " of interaction. Details: " + err.Error())
+	}
+
+	return nil
+}
+
+// AddReaction adds the reaction of the bot to the Discord message
+func (t *DiscordTransport) AddReaction(channelID, messageID, emoji string) error {
+
+	if err := t.session.MessageReactionAdd(channelID, messageID, emoji); err != nil {
+		return errors.New("Can't add reaction " + emoji + " to message " + messageID + ". Details: " + err.Error())
+	}
+
+	return nil
+}
+
+// RemoveReaction removes the reaction of the user from the Discord message, the bot needs the Manage Messages permission
+// to remove reactions of other users
+func (t *DiscordTransport) RemoveReaction(channelID, messageID, emoji, userID string) error {
+
+	if err := t.session.MessageReactionRemove(channelID, messageID, emoji, userID); err != nil {
+		return errors.New("Can't remove reaction " + emoji + " from message " + messageID + ". Details: " + err.Error())
+	}
+
+	return nil
+}
+
+// PublishCommands registers the commands as global application commands of the bot, replacing all existing ones
+func (t *DiscordTransport) PublishCommands(commands []*dg.ApplicationCommand) error {
+
+	// Application ID of a bot is the ID of its user
+	applicationID := t.BotUserID()
+	if applicationID == "" {
+		return errors.New("Can't publish application commands - the connection to Discord is not ready")
+	}
+
+	if _, err := t.session.ApplicationCommandBulkOverwrite(applicationID, "", commands); err != nil {
+		return errors.New("Can't publish application commands. Details: " + err.Error())
+	}
+
+	return nil
+}
+
+// SendMessage sends the message to the Discord channel with the given ID
+func (t *DiscordTransport) SendMessage(channelID string, message *dg.MessageSend) (*dg.Message, error) {
+	return t.session.ChannelMessageSendComplex(channelID, message)
+}
+
+// EditMessage edits the Discord message, attachments of the message are replaced by the files of the new one
+func (t *DiscordTransport) EditMessage(channelID, messageID string, message *dg.MessageSend) (*dg.Message, error) {
+
+	edit := &dg.MessageEdit{
+		ID:          messageID,
+		Channel:     channelID,
+		Content:     &message.Content,
+		Embeds:      &message.Embeds,
+		Files:       message.Files,
+		Attachments: &[]*dg.MessageAttachment{},
+	}
+
+	edited, err := t.session.ChannelMessageEditComplex(edit)
+	if err != nil {
+		return nil, errors.New("Can't edit message " + messageID + ". Details: " + err.Error())
+	}
+
+	return edited, nil
+}
+
+// DeleteMessage deletes the Discord message
+func (t *DiscordTransport) DeleteMessage(channelID, messageID string) error {
+
+	if err := t.session.ChannelMessageDelete(channelID, messageID); err != nil {
+		return errors.New("Can't delete message " + messageID + ". Details: " + err.Error())
+	}
+
+	return nil
+}
+
+// UserChannel creates a direct message channel with the user and returns its ID
+func (t *DiscordTransport) UserChannel(userID string) (string, error) {
+
+	// Try to create a channel with the user
+	channel, err := t.session.UserChannelCreate(userID)
+
+	if err != nil {
+		return "", err
+	}
+
+	return channel.ID, nil
+}
+
+// UpdateStatus sets the game status of the bot
+func (t *DiscordTransport) UpdateStatus(status string) error {
+	return t.session.UpdateGameStatus(0, status)
+}
+
+// Member returns the roles of the user in the guild and their permissions in the channel.
+// Data cached in the session state is used when possible, otherwise it's requested from Discord.
+func (t *DiscordTransport) Member(guildID, channelID, userID string) (*MemberInfo, error) {
+
+	// Get the guild, it's needed for the owner and names of the roles
+	guild, err := t.session.State.Guild(guildID)
+	if err != nil {
+		if guild, err = t.session.Guild(guildID); err != nil {
+			return nil, errors.New("Can't get guild " + guildID + ". Details: " + err.Error())
+		}
+	}
+
+	// Get the member, it holds IDs of the roles
+	member, err := t.session.State.Member(guildID, userID)
+	if err != nil {
+		if member, err = t.session.GuildMember(guildID, userID); err != nil {
+			return nil, errors.New("Can't get member " + userID + " of guild " + guildID + ". Details: " + err.Error())
+		}
+	}
+
+	// Get the permissions of the member in the channel
+	permissions, err := t.session.State.UserChannelPermissions(userID, channelID)
+	if err != nil {
+		if permissions, err = t.session.UserChannelPermissions(userID, channelID); err != nil {
+			return nil, errors.New("Can't get permissions of " + userID + " in channel " + channelID + ". Details: " + err.Error())
+		}
+	}
+
+	info := &MemberInfo{
+		IsGuildOwner: guild.OwnerID == userID,
+		Permissions:  permissions,
+	}
+
+	// Resolve the IDs of the member's roles to roles
+	for _, roleID := range member.Roles {
+		for _, role := range guild.Roles {
+			if role.ID == roleID {
+				info.Roles = append(info.Roles, role)
+				break
+			}
+		}
+	}
+
+	return info, nil
+}
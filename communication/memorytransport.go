@@ -0,0 +1,746 @@
+package communication
+
+import (
+	"errors"
+	dg "github.com/bwmarrin/discordgo"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SentMessage is a record of a message sent through MemoryTransport
+type SentMessage struct {
+
+	// ID of the channel the message was sent to
+	ChannelID string
+
+	// The message that was sent
+	Message *dg.MessageSend
+
+	// ID of the interaction the message responded to, empty if the message was sent to the channel directly
+	InteractionID string
+
+	// ID of the created message
+	MessageID string
+
+	// True if the message was edited with EditMessage, Message is the last version then
+	Edited bool
+
+	// True if the message was deleted with DeleteMessage or DeleteInteractionResponse
+	Deleted bool
+
+	// True if the message is the acknowledgement of an interaction created by DeferInteraction and it wasn't replaced by the
+	// response yet. Message then holds only the flags of the acknowledgement.
+	Deferred bool
+}
+
+// createdMessage returns the message object that the real service would return for the sent message - everything that was sent
+// (content, embeds, components, flags and reference), but not the uploaded files
+func (s *SentMessage) createdMessage() *dg.Message {
+
+	return &dg.Message{
+		ID:               s.MessageID,
+		ChannelID:        s.ChannelID,
+		Content:          s.Message.Content,
+		Embeds:           s.Message.Embeds,
+		Components:       s.Message.Components,
+		TTS:              s.Message.TTS,
+		Flags:            s.Message.Flags,
+		MessageReference: s.Message.Reference,
+	}
+}
+
+// SentReaction is a record of a reaction added through MemoryTransport - by the bot with AddReaction or by a user with
+// ReceiveReaction
+type SentReaction struct {
+
+	// ID of the channel of the message
+	ChannelID string
+
+	// ID of the message the reaction was added to
+	MessageID string
+
+	// The emoji of the reaction
+	Emoji string
+
+	// ID of the user who reacted, MemoryBotUserID for reactions of the bot
+	UserID string
+}
+
+// MemoryTransport is an in-memory Transport implementation. It doesn't connect anywhere - incoming messages are injected with
+// Receive and everything sent by the bot is recorded and can be inspected with Sent.
+// It is meant to be used in tests and for running the bot against a local stand-in. It is safe for concurrent use.
+type MemoryTransport struct {
+
+	// mutex guards all fields below
+	mutex sync.Mutex
+
+	// open is true between calls to Open and Close
+	open bool
+
+	// handlers are the functions registered with OnMessage
+	handlers []func(*dg.Message)
+
+	// editHandlers are the functions registered with OnMessageEdit
+	editHandlers []func(*dg.Message)
+
+	// deleteHandlers are the functions registered with OnMessageDelete
+	deleteHandlers []func(*dg.Message)
+
+	// interactionHandlers are the functions registered with OnInteraction
+	interactionHandlers []func(*dg.Interaction)
+
+	// respondedInteractions holds IDs of interactions that were already responded to
+	respondedInteractions map[string]struct{}
+
+	// commands are the application commands set with PublishCommands
+	commands []*dg.ApplicationCommand
+
+	// sent holds all messages sent through the transport, in order
+	sent []SentMessage
+
+	// reactionHandlers are the functions registered with OnReactionAdd
+	reactionHandlers []func(*dg.MessageReaction)
+
+	// reactionRemoveHandlers are the functions registered with OnReactionRemove
+	reactionRemoveHandlers []func(*dg.MessageReaction)
+
+	// reactions holds all reactions added through the transport and not removed, in order
+	reactions []SentReaction
+
+	// sentSignal is closed (and replaced) whenever a message is sent, edited or deleted, it is used to wait for messages
+	sentSignal chan struct{}
+
+	// status is the last status set with UpdateStatus
+	status string
+
+	// lastID is used to generate IDs of sent messages
+	lastID int
+
+	// members holds information about members set with SetMember, key is guild ID and user ID separated by a slash
+	members map[string]MemberInfo
+}
+
+// MemoryBotUserID is the user ID of the bot connected through MemoryTransport
+const MemoryBotUserID = "memory-bot"
+
+// userChannelPrefix is the prefix of IDs of direct message channels created by local transports (memory and console)
+const userChannelPrefix = "dm-"
+
+// NewMemoryTransport creates a new, closed MemoryTransport
+func NewMemoryTransport() *MemoryTransport {
+	return &MemoryTransport{
+		sentSignal:            make(chan struct{}),
+		members:               make(map[string]MemberInfo),
+		respondedInteractions: make(map[string]struct{}),
+	}
+}
+
+// Open marks the transport as open - from now on messages passed to Receive are delivered to handlers
+func (t *MemoryTransport) Open() error {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	// Don't allow opening the transport twice
+	if t.open {
+		return errors.New("Memory transport is already open")
+	}
+
+	t.open = true
+	return nil
+}
+
+// Close marks the transport as closed - messages passed to Receive will be ignored
+func (t *MemoryTransport) Close() error {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.open = false
+	return nil
+}
+
+// OnMessage registers the handler for messages injected with Receive
+func (t *MemoryTransport) OnMessage(handler func(*dg.Message)) {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.handlers = append(t.handlers, handler)
+}
+
+// SendMessage records the message as sent to the given channel
+func (t *MemoryTransport) SendMessage(channelID string, message *dg.MessageSend) (*dg.Message, error) {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if !t.open {
+		return nil, errors.New("Can't send message - memory transport is not open")
+	}
+
+	created := t.record(SentMessage{ChannelID: channelID, Message: message})
+	return created, nil
+}
+
+// EditMessage replaces the recorded message with the new one and marks it as edited (see SentMessage.Edited).
+// Returns an error if no such message was sent or if it was deleted.
+func (t *MemoryTransport) EditMessage(channelID, messageID string, message *dg.MessageSend) (*dg.Message, error) {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	sent, err := t.findSent(channelID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	sent.Message, sent.Edited = message, true
+	t.signal()
+
+	return sent.createdMessage(), nil
+}
+
+// DeleteMessage marks the recorded message as deleted (see SentMessage.Deleted).
+// Returns an error if no such message was sent or if it was already deleted.
+func (t *MemoryTransport) DeleteMessage(channelID, messageID string) error {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	sent, err := t.findSent(channelID, messageID)
+	if err != nil {
+		return err
+	}
+
+	sent.Deleted = true
+	t.signal()
+
+	return nil
+}
+
+// findSent returns the record of the message that was sent and not deleted. Mutex has to be held by the caller.
+func (t *MemoryTransport) findSent(channelID, messageID string) (*SentMessage, error) {
+
+	if !t.open {
+		return nil, errors.New("Can't change message - memory transport is not open")
+	}
+
+	for i := range t.sent {
+		if sent := &t.sent[i]; sent.ChannelID == channelID && sent.MessageID == messageID && !sent.Deleted {
+			return sent, nil
+		}
+	}
+
+	return nil, errors.New("Unknown message " + messageID + " in channel " + channelID)
+}
+
+// record gives the message an ID, adds it to the sent ones and wakes up everyone waiting for messages. Returns the message object
+// that would be returned by the real service. Mutex has to be held by the caller.
+func (t *MemoryTransport) record(message SentMessage) *dg.Message {
+
+	t.lastID++
+	message.MessageID = "memory-message-" + strconv.Itoa(t.lastID)
+
+	t.sent = append(t.sent, message)
+	t.signal()
+
+	return message.createdMessage()
+}
+
+// signal wakes up everyone waiting for messages and prepares a new signal for the next change. Mutex has to be held by the caller.
+func (t *MemoryTransport) signal() {
+	close(t.sentSignal)
+	t.sentSignal = make(chan struct{})
+}
+
+// OnMessageEdit registers the handler for edits injected with ReceiveEdit
+func (t *MemoryTransport) OnMessageEdit(handler func(*dg.Message)) {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.editHandlers = append(t.editHandlers, handler)
+}
+
+// OnMessageDelete registers the handler for deletions injected with ReceiveDelete
+func (t *MemoryTransport) OnMessageDelete(handler func(*dg.Message)) {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.deleteHandlers = append(t.deleteHandlers, handler)
+}
+
+// OnReactionAdd registers the handler for reactions injected with ReceiveReaction
+func (t *MemoryTransport) OnReactionAdd(handler func(*dg.MessageReaction)) {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.reactionHandlers = append(t.reactionHandlers, handler)
+}
+
+// OnReactionRemove registers the handler for removals of reactions injected with ReceiveReactionRemove
+func (t *MemoryTransport) OnReactionRemove(handler func(*dg.MessageReaction)) {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.reactionRemoveHandlers = append(t.reactionRemoveHandlers, handler)
+}
+
+// OnInteraction registers the handler for interactions injected with ReceiveInteraction
+func (t *MemoryTransport) OnInteraction(handler func(*dg.Interaction)) {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.interactionHandlers = append(t.interactionHandlers, handler)
+}
+
+// RespondToInteraction records the message as sent to the channel of the interaction (see SentMessage.InteractionID).
+// Like Discord, it returns an error if the interaction was already responded to.
+func (t *MemoryTransport) RespondToInteraction(interaction *dg.Interaction, message *dg.MessageSend) error {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if !t.open {
+		return errors.New("Can't respond to interaction - memory transport is not open")
+	}
+
+	if _, ok := t.respondedInteractions[interaction.ID]; ok {
+		return errors.New("Interaction " + interaction.ID + " was already responded to")
+	}
+	t.respondedInteractions[interaction.ID] = struct{}{}
+
+	t.record(SentMessage{ChannelID: interaction.ChannelID, Message: message, InteractionID: interaction.ID})
+	return nil
+}
+
+// DeferInteraction records the acknowledgement as a message sent to the channel of the interaction (see SentMessage.Deferred).
+// Like Discord, it returns an error if the interaction was already responded to.
+func (t *MemoryTransport) DeferInteraction(interaction *dg.Interaction, ephemeral bool) error {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if !t.open {
+		return errors.New("Can't acknowledge interaction - memory transport is not open")
+	}
+
+	if _, ok := t.respondedInteractions[interaction.ID]; ok {
+		return errors.New("Interaction " + interaction.ID + " was already responded to")
+	}
+	t.respondedInteractions[interaction.ID] = struct{}{}
+
+	message := &dg.MessageSend{}
+	if ephemeral {
+		message.Flags = dg.MessageFlagsEphemeral
+	}
+
+	t.record(SentMessage{ChannelID: interaction.ChannelID, Message: message, InteractionID: interaction.ID, Deferred: true})
+	return nil
+}
+
+// EditInteractionResponse replaces the recorded response to the interaction. The flags of the response are kept, like on Discord
+// the visibility of the response can't be changed. Replacing an acknowledgement doesn't count as an edit (see SentMessage.Edited).
+func (t *MemoryTransport) EditInteractionResponse(interaction *dg.Interaction, message *dg.MessageSend) (*dg.Message, error) {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	sent, err := t.interactionResponse(interaction)
+	if err != nil {
+		return nil, err
+	}
+
+	edited := *message
+	edited.Flags = sent.Message.Flags
+
+	sent.Message = &edited
+	sent.Edited = sent.Edited || !sent.Deferred
+	sent.Deferred = false
+	t.signal()
+
+	return sent.createdMessage(), nil
+}
+
+// DeleteInteractionResponse marks the recorded response to the interaction as deleted
+func (t *MemoryTransport) DeleteInteractionResponse(interaction *dg.Interaction) error {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	sent, err := t.interactionResponse(interaction)
+	if err != nil {
+		return err
+	}
+
+	sent.Deleted = true
+	t.signal()
+
+	return nil
+}
+
+// interactionResponse returns the record of the response to the interaction, which is the first message sent for it.
+// Returns an error if the interaction wasn't responded to or the response was deleted. Mutex has to be held by the caller.
+func (t *MemoryTransport) interactionResponse(interaction *dg.Interaction) (*SentMessage, error) {
+
+	if !t.open {
+		return nil, errors.New("Can't change response - memory transport is not open")
+	}
+
+	for i := range t.sent {
+		if t.sent[i].InteractionID != interaction.ID {
+			continue
+		}
+
+		if t.sent[i].Deleted {
+			return nil, errors.New("Response to interaction " + interaction.ID + " was deleted")
+		}
+
+		return &t.sent[i], nil
+	}
+
+	return nil, errors.New("Interaction " + interaction.ID + " wasn't responded to yet")
+}
+
+// FollowUpInteraction records the message as sent to the channel of the interaction (see SentMessage.InteractionID).
+// Like Discord, it returns an error if the interaction wasn't responded to yet.
+func (t *MemoryTransport) FollowUpInteraction(interaction *dg.Interaction, message *dg.MessageSend) (*dg.Message, error) {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if !t.open {
+		return nil, errors.New("Can't send follow-up message - memory transport is not open")
+	}
+
+	if _, ok := t.respondedInteractions[interaction.ID]; !ok {
+		return nil, errors.New("Interaction " + interaction.ID + " wasn't responded to yet")
+	}
+
+	created := t.record(SentMessage{ChannelID: interaction.ChannelID, Message: message, InteractionID: interaction.ID})
+	return created, nil
+}
+
+// InteractionResponse returns the message recorded by RespondToInteraction (or DeferInteraction), with everything that was sent
+func (t *MemoryTransport) InteractionResponse(interaction *dg.Interaction) (*dg.Message, error) {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	// The response is the first message sent for the interaction
+	for i := range t.sent {
+		if t.sent[i].InteractionID == interaction.ID {
+			return t.sent[i].createdMessage(), nil
+		}
+	}
+
+	return nil, errors.New("Interaction " + interaction.ID + " wasn't responded to yet")
+}
+
+// EditInteractionMessage replaces the recorded response or follow-up message of the interaction, like EditMessage
+func (t *MemoryTransport) EditInteractionMessage(interaction *dg.Interaction, messageID string, message *dg.MessageSend) error {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	sent, err := t.findSent(interaction.ChannelID, messageID)
+	if err != nil {
+		return err
+	}
+
+	if sent.InteractionID != interaction.ID {
+		return errors.New("Message " + messageID + " doesn't belong to interaction " + interaction.ID)
+	}
+
+	sent.Message, sent.Edited = message, true
+	t.signal()
+
+	return nil
+}
+
+// AddReaction records the reaction, it can be read with Reactions
+func (t *MemoryTransport) AddReaction(channelID, messageID, emoji string) error {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if !t.open {
+		return errors.New("Can't add reaction - memory transport is not open")
+	}
+
+	t.reactions = append(t.reactions, SentReaction{ChannelID: channelID, MessageID: messageID, Emoji: emoji, UserID: MemoryBotUserID})
+	return nil
+}
+
+// RemoveReaction removes the recorded reaction of the user. Returns an error if there is no such reaction.
+func (t *MemoryTransport) RemoveReaction(channelID, messageID, emoji, userID string) error {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if !t.open {
+		return errors.New("Can't remove reaction - memory transport is not open")
+	}
+
+	removed := SentReaction{ChannelID: channelID, MessageID: messageID, Emoji: emoji, UserID: userID}
+
+	for i, reaction := range t.reactions {
+		if reaction == removed {
+			t.reactions = append(t.reactions[:i:i], t.reactions[i+1:]...)
+			return nil
+		}
+	}
+
+	return errors.New("Unknown reaction " + emoji + " of user " + userID + " to message " + messageID)
+}
+
+// Reactions returns a copy of all reactions added through the transport so far and not removed, in order
+func (t *MemoryTransport) Reactions() []SentReaction {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return append([]SentReaction{}, t.reactions...)
+}
+
+// PublishCommands records the commands, they can be read with PublishedCommands
+func (t *MemoryTransport) PublishCommands(commands []*dg.ApplicationCommand) error {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.commands = commands
+	return nil
+}
+
+// PublishedCommands returns the commands set with PublishCommands
+func (t *MemoryTransport) PublishedCommands() []*dg.ApplicationCommand {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.commands
+}
+
+// ReceiveInteraction delivers the interaction to all handlers registered with OnInteraction, as if a user caused it (e.g. used
+// a slash command). The interaction is ignored if the transport is not open.
+func (t *MemoryTransport) ReceiveInteraction(interaction *dg.Interaction) {
+
+	// Copy the handlers so that they aren't called with the mutex locked
+	t.mutex.Lock()
+	handlers := append([]func(*dg.Interaction){}, t.interactionHandlers...)
+	open := t.open
+	t.mutex.Unlock()
+
+	if !open {
+		return
+	}
+
+	for _, handler := range handlers {
+		handler(interaction)
+	}
+}
+
+// UserChannel returns ID of the direct message channel with the given user. The ID is the user ID with a "dm-" prefix.
+func (t *MemoryTransport) UserChannel(userID string) (string, error) {
+	return userChannelPrefix + userID, nil
+}
+
+// BotUserID returns MemoryBotUserID
+func (t *MemoryTransport) BotUserID() string {
+	return MemoryBotUserID
+}
+
+// UpdateStatus records the status, it can be read with Status
+func (t *MemoryTransport) UpdateStatus(status string) error {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.status = status
+	return nil
+}
+
+// Receive delivers the message to all handlers registered with OnMessage, as if it was posted by a user.
+// The message is ignored if the transport is not open.
+func (t *MemoryTransport) Receive(message *dg.Message) {
+
+	// Copy the handlers so that they aren't called with the mutex locked (they are likely to send messages)
+	t.mutex.Lock()
+	handlers := append([]func(*dg.Message){}, t.handlers...)
+	open := t.open
+	t.mutex.Unlock()
+
+	if !open {
+		return
+	}
+
+	for _, handler := range handlers {
+		handler(message)
+	}
+}
+
+// ReceiveEdit delivers the message to all handlers registered with OnMessageEdit, as if a user edited it to its current content.
+// The edit is ignored if the transport is not open.
+func (t *MemoryTransport) ReceiveEdit(message *dg.Message) {
+
+	t.mutex.Lock()
+	handlers := append([]func(*dg.Message){}, t.editHandlers...)
+	open := t.open
+	t.mutex.Unlock()
+
+	if !open {
+		return
+	}
+
+	for _, handler := range handlers {
+		handler(message)
+	}
+}
+
+// ReceiveDelete delivers the message to all handlers registered with OnMessageDelete, as if a user deleted it.
+// The deletion is ignored if the transport is not open.
+func (t *MemoryTransport) ReceiveDelete(message *dg.Message) {
+
+	t.mutex.Lock()
+	handlers := append([]func(*dg.Message){}, t.deleteHandlers...)
+	open := t.open
+	t.mutex.Unlock()
+
+	if !open {
+		return
+	}
+
+	for _, handler := range handlers {
+		handler(message)
+	}
+}
+
+// ReceiveReaction records the reaction (see Reactions) and delivers it to all handlers registered with OnReactionAdd, as if
+// a user added it. The reaction is ignored if the transport is not open.
+func (t *MemoryTransport) ReceiveReaction(reaction *dg.MessageReaction) {
+
+	t.mutex.Lock()
+	handlers := append([]func(*dg.MessageReaction){}, t.reactionHandlers...)
+	open := t.open
+
+	if open {
+		t.reactions = append(t.reactions, SentReaction{
+			ChannelID: reaction.ChannelID,
+			MessageID: reaction.MessageID,
+			Emoji:     reaction.Emoji.APIName(),
+			UserID:    reaction.UserID,
+		})
+	}
+	t.mutex.Unlock()
+
+	if !open {
+		return
+	}
+
+	for _, handler := range handlers {
+		handler(reaction)
+	}
+}
+
+// ReceiveReactionRemove removes the recorded reaction (see Reactions) and delivers the removal to all handlers registered with
+// OnReactionRemove, as if a user removed the reaction. Removals of reactions that were not recorded are delivered too, like
+// Discord does for reactions added before the bot connected. The removal is ignored if the transport is not open.
+func (t *MemoryTransport) ReceiveReactionRemove(reaction *dg.MessageReaction) {
+
+	t.mutex.Lock()
+	handlers := append([]func(*dg.MessageReaction){}, t.reactionRemoveHandlers...)
+	open := t.open
+
+	if open {
+		removed := SentReaction{
+			ChannelID: reaction.ChannelID,
+			MessageID: reaction.MessageID,
+			Emoji:     reaction.Emoji.APIName(),
+			UserID:    reaction.UserID,
+		}
+
+		for i, recorded := range t.reactions {
+			if recorded == removed {
+				t.reactions = append(t.reactions[:i:i], t.reactions[i+1:]...)
+				break
+			}
+		}
+	}
+	t.mutex.Unlock()
+
+	if !open {
+		return
+	}
+
+	for _, handler := range handlers {
+		handler(reaction)
+	}
+}
+
+// Sent returns a copy of all messages sent through the transport so far, in order
+func (t *MemoryTransport) Sent() []SentMessage {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return append([]SentMessage{}, t.sent...)
+}
+
+// WaitForSent blocks until at least count messages were sent through the transport or until timeout passes.
+// Returns true if the expected number of messages was sent in time. Useful because commands are handled asynchronously.
+func (t *MemoryTransport) WaitForSent(count int, timeout time.Duration) bool {
+
+	deadline := time.After(timeout)
+
+	for {
+		t.mutex.Lock()
+		sentCount, signal := len(t.sent), t.sentSignal
+		t.mutex.Unlock()
+
+		if sentCount >= count {
+			return true
+		}
+
+		// Wait for another message or for the timeout
+		select {
+		case <-signal:
+		case <-deadline:
+			return false
+		}
+	}
+}
+
+// Status returns the last status set with UpdateStatus
+func (t *MemoryTransport) Status() string {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.status
+}
+
+// SetMember sets the information returned by Member for the user in the guild (in every channel)
+func (t *MemoryTransport) SetMember(guildID, userID string, info MemberInfo) {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.members[guildID+"/"+userID] = info
+}
+
+// Member returns the information set with SetMember. Users for which nothing was set have no roles and no permissions.
+func (t *MemoryTransport) Member(guildID, channelID, userID string) (*MemberInfo, error) {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	info := t.members[guildID+"/"+userID]
+	return &info, nil
+}
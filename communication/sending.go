@@ -4,35 +4,234 @@ import (
 	"errors"
 	dg "github.com/bwmarrin/discordgo"
 	"github.com/generalkenobi/makrochatbot/logger"
+	"sync"
 )
 
+// Communicator sends messages through a transport. It makes sure that messages sent to one channel from different goroutines
+// don't get mixed, while messages to different channels are sent at the same time.
+// One communicator should be created per transport and all communication should go through it.
+type Communicator struct {
+
+	// transport is used to deliver messages
+	transport Transport
+
+	// channels holds the locks of channels that are being used, key is channel ID
+	channels map[string]*channelLock
+
+	// mutex is used to synchronize access to channels, it's never held while the transport is used
+	mutex sync.Mutex
+}
+
+// channelLock synchronizes uses of the transport in one channel
+type channelLock struct {
+
+	// mutex is held while the transport is used in the channel
+	mutex sync.Mutex
+
+	// users is the number of goroutines holding or waiting for the lock, the lock is removed when there are none
+	users int
+}
+
+// NewCommunicator creates a communicator that sends messages through the given transport
+func NewCommunicator(transport Transport) *Communicator {
+	return &Communicator{transport: transport, channels: make(map[string]*channelLock)}
+}
+
+// Transport returns the transport used by the communicator
+func (c *Communicator) Transport() Transport {
+	return c.transport
+}
+
 // SendToChannel delivers the provided messages to appropriate discord server/channel.
 // It makes sure that the sending will not be interrupted - i.e. some other entity won't try to send messages at the same time resulting in mixed messages.
 // To make this happen all communication has to go through this function.
-func SendToChannel(channelID string, message *dg.MessageSend) {
-	sendHelper(channelID, message)
+// Returns the sent message, nil if sending failed.
+func (c *Communicator) SendToChannel(channelID string, message *dg.MessageSend) *dg.Message {
+	return c.sendHelper(channelID, message)
 }
 
 // SendToUser delivers the provided messages to appropriate discord server/channel.
 // It makes sure that the sending will not be interrupted - i.e. some other entity won't try to send messages at the same time resulting in mixed messages.
 // To make this happen all communication has to go through this function.
-func SendToUser(userID string, message *dg.MessageSend) {
+// Returns the sent message, nil if sending failed.
+func (c *Communicator) SendToUser(userID string, message *dg.MessageSend) *dg.Message {
 
 	// Try to create a channel with the user
-	if userChannel, err := session.UserChannelCreate(userID); err == nil {
+	if userChannelID, err := c.transport.UserChannel(userID); err == nil {
 		// If successful, use the helper to send the message to him
-		sendHelper(userChannel.ID, message)
-	} else {
-		// Otherwise log error
-		logger.LogError(errors.New("Can't create channel for communication with user (ID): " + userID))
+		return c.sendHelper(userChannelID, message)
+	}
+
+	// Otherwise log error
+	logger.LogError(errors.New("Can't create channel for communication with user (ID): " + userID))
+	return nil
+}
+
+// DeferInteraction acknowledges the interaction, so that it can be responded to later with EditInteractionResponse (see
+// Transport.DeferInteraction). Returns false if acknowledging failed (the error is logged).
+func (c *Communicator) DeferInteraction(interaction *dg.Interaction, ephemeral bool) bool {
+
+	defer c.lockChannel(interaction.ChannelID)()
+
+	if err := c.transport.DeferInteraction(interaction, ephemeral); err != nil {
+		logger.LogError(err)
+		return false
+	}
+
+	return true
+}
+
+// EditInteractionResponse replaces the response to the interaction with the message. Returns the edited message, nil if
+// editing failed (the error is logged).
+func (c *Communicator) EditInteractionResponse(interaction *dg.Interaction, message *dg.MessageSend) *dg.Message {
+
+	if message == nil {
+		logger.LogError(errors.New("Can't edit response to nil message."))
+		return nil
+	}
+
+	defer c.lockChannel(interaction.ChannelID)()
+
+	edited, err := c.transport.EditInteractionResponse(interaction, message)
+	if err != nil {
+		logger.LogError(err)
+		return nil
+	}
+
+	return edited
+}
+
+// DeleteInteractionResponse deletes the response to the interaction. Errors are logged.
+func (c *Communicator) DeleteInteractionResponse(interaction *dg.Interaction) {
+
+	defer c.lockChannel(interaction.ChannelID)()
+
+	if err := c.transport.DeleteInteractionResponse(interaction); err != nil {
+		logger.LogError(err)
+	}
+}
+
+// RespondToInteraction replies to the interaction with the message. Like other sends, the reply is synchronized with all
+// communication in the channel that goes through the communicator. Errors are logged.
+func (c *Communicator) RespondToInteraction(interaction *dg.Interaction, message *dg.MessageSend) {
+
+	if message == nil {
+		logger.LogError(errors.New("Can't respond with nil message."))
+		return
+	}
+
+	defer c.lockChannel(interaction.ChannelID)()
+
+	if err := c.transport.RespondToInteraction(interaction, message); err != nil {
+		logger.LogError(err)
+	}
+}
+
+// FollowUpInteraction sends another message in response to the interaction, after it was responded to with
+// RespondToInteraction. Returns the sent message, nil if sending failed (the error is logged).
+func (c *Communicator) FollowUpInteraction(interaction *dg.Interaction, message *dg.MessageSend) *dg.Message {
+
+	if message == nil {
+		logger.LogError(errors.New("Can't send nil follow-up message."))
+		return nil
+	}
+
+	defer c.lockChannel(interaction.ChannelID)()
+
+	sent, err := c.transport.FollowUpInteraction(interaction, message)
+	if err != nil {
+		logger.LogError(err)
+		return nil
+	}
+
+	return sent
+}
+
+// InteractionResponse returns the message created by RespondToInteraction, nil if it can't be found (the error is logged)
+func (c *Communicator) InteractionResponse(interaction *dg.Interaction) *dg.Message {
+
+	defer c.lockChannel(interaction.ChannelID)()
+
+	response, err := c.transport.InteractionResponse(interaction)
+	if err != nil {
+		logger.LogError(err)
+		return nil
+	}
+
+	return response
+}
+
+// EditInteractionMessage replaces the response or a follow-up message of the interaction with the new message. Errors are logged.
+func (c *Communicator) EditInteractionMessage(interaction *dg.Interaction, messageID string, message *dg.MessageSend) {
+
+	if message == nil {
+		logger.LogError(errors.New("Can't edit message to nil message."))
+		return
+	}
+
+	defer c.lockChannel(interaction.ChannelID)()
+
+	if err := c.transport.EditInteractionMessage(interaction, messageID, message); err != nil {
+		logger.LogError(err)
+	}
+}
+
+// AddReaction reacts to the message in the channel with the emoji. Errors are logged.
+func (c *Communicator) AddReaction(channelID, messageID, emoji string) {
+
+	defer c.lockChannel(channelID)()
+
+	if err := c.transport.AddReaction(channelID, messageID, emoji); err != nil {
+		logger.LogError(err)
+	}
+}
+
+// EditMessage replaces the message sent earlier to the channel with the new one. Returns the edited message, nil if editing
+// failed (the error is logged).
+func (c *Communicator) EditMessage(channelID, messageID string, message *dg.MessageSend) *dg.Message {
+
+	if message == nil {
+		logger.LogError(errors.New("Can't edit message to nil message."))
+		return nil
+	}
+
+	defer c.lockChannel(channelID)()
+
+	edited, err := c.transport.EditMessage(channelID, messageID, message)
+	if err != nil {
+		logger.LogError(err)
+		return nil
+	}
+
+	return edited
+}
+
+// DeleteMessage deletes the message from the channel. Errors are logged.
+func (c *Communicator) DeleteMessage(channelID, messageID string) {
+
+	defer c.lockChannel(channelID)()
+
+	if err := c.transport.DeleteMessage(channelID, messageID); err != nil {
+		logger.LogError(err)
+	}
+}
+
+// RemoveReaction removes the reaction of the user to the message in the channel. Errors are logged.
+func (c *Communicator) RemoveReaction(channelID, messageID, emoji, userID string) {
+
+	defer c.lockChannel(channelID)()
+
+	if err := c.transport.RemoveReaction(channelID, messageID, emoji, userID); err != nil {
+		logger.LogError(err)
 	}
 }
 
 // sendHelper is a helper function for sending messages to Discord.
-// It uses sessionMutex to gain ownership of session before sending.
+// It locks the channel before sending, so that messages sent to it at the same time don't get mixed.
 // It will check to make sure message is not nil (if it is it will log an error).
 // It will also log an error if sending failed.
-func sendHelper(channelID string, message *dg.MessageSend) {
+// Returns the sent message, nil if nothing was sent.
+func (c *Communicator) sendHelper(channelID string, message *dg.MessageSend) *dg.Message {
 
 	// Check if the message is nil
 	if message == nil {
@@ -44,22 +243,52 @@ func sendHelper(channelID string, message *dg.MessageSend) {
 
 		logger.LogError(errors.New(errMessage))
 
-		return
+		return nil
 	}
 
-	// Lock the mutex and defer the unlock
-	sessionMutex.Lock()
-	defer sessionMutex.Unlock()
-
-	// Make sure the session is not nil
-	if session == nil {
-		logger.LogError(errors.New("Can't send message - Discord session is nil"))
-		return
-	}
+	// Lock the channel and defer the unlock
+	defer c.lockChannel(channelID)()
 
 	// Send the message
-	if _, err := session.ChannelMessageSendComplex(channelID, message); err != nil {
+	sent, err := c.transport.SendMessage(channelID, message)
+
+	if err != nil {
 		// If something went wrong, log the error
 		logger.LogError(err)
+		return nil
+	}
+
+	return sent
+}
+
+// lockChannel locks the channel for using the transport in it and returns the function that unlocks it. Only uses in one channel
+// are synchronized - their order matters, e.g. parts of a long response must not be mixed with other messages.
+func (c *Communicator) lockChannel(channelID string) func() {
+
+	c.mutex.Lock()
+
+	lock, ok := c.channels[channelID]
+	if !ok {
+		lock = &channelLock{}
+		c.channels[channelID] = lock
+	}
+
+	lock.users++
+	c.mutex.Unlock()
+
+	lock.mutex.Lock()
+
+	return func() {
+
+		lock.mutex.Unlock()
+
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
+		// Forget the lock when nobody needs it, so that locks of all channels ever used are not kept
+		lock.users--
+		if lock.users == 0 {
+			delete(c.channels, channelID)
+		}
 	}
 }
@@ -0,0 +1,113 @@
+package communication
+
+import dg "github.com/bwmarrin/discordgo"
+
+// Transport is an abstraction over the chat service the bot is connected to.
+// All communication with the outside world goes through it, which makes it possible to run the bot against Discord
+// (DiscordTransport) as well as against a local stand-in (e.g. MemoryTransport) without changing any command code.
+type Transport interface {
+
+	// Open connects the transport. After it returns successfully, functions registered with OnMessage will start receiving
+	// messages.
+	Open() error
+
+	// Close disconnects the transport
+	Close() error
+
+	// OnMessage registers a function that will be called for every message received by the transport.
+	// It should be called before Open, otherwise some messages may be missed.
+	OnMessage(handler func(*dg.Message))
+
+	// OnMessageEdit registers a function that will be called for every edited message. The message has the new content.
+	// It should be called before Open, otherwise some edits may be missed.
+	OnMessageEdit(handler func(*dg.Message))
+
+	// OnMessageDelete registers a function that will be called for every deleted message. Only the IDs of the message, its
+	// channel and its guild are guaranteed to be set. It should be called before Open, otherwise some deletions may be missed.
+	OnMessageDelete(handler func(*dg.Message))
+
+	// OnInteraction registers a function that will be called for every interaction (e.g. use of a slash command) received by
+	// the transport. It should be called before Open, otherwise some interactions may be missed.
+	OnInteraction(handler func(*dg.Interaction))
+
+	// OnReactionAdd registers a function that will be called for every reaction added to a message, including the reactions of
+	// the bot. It should be called before Open, otherwise some reactions may be missed.
+	OnReactionAdd(handler func(*dg.MessageReaction))
+
+	// OnReactionRemove registers a function that will be called for every reaction removed from a message, including reactions
+	// removed by the bot. It should be called before Open, otherwise some removals may be missed.
+	OnReactionRemove(handler func(*dg.MessageReaction))
+
+	// DeferInteraction acknowledges the interaction without a message - users see that the bot is thinking until the response
+	// is replaced with EditInteractionResponse. Interactions have to be acknowledged within 3 seconds, deferring gives the bot
+	// 15 minutes to respond. The response will be ephemeral if ephemeral is true, it can't be changed later. Acknowledging
+	// counts as responding - the interaction can't be responded to with RespondToInteraction afterwards.
+	DeferInteraction(interaction *dg.Interaction, ephemeral bool) error
+
+	// EditInteractionResponse replaces the response to the interaction (e.g. the one created by DeferInteraction) with the message.
+	// Returns the edited message.
+	EditInteractionResponse(interaction *dg.Interaction, message *dg.MessageSend) (*dg.Message, error)
+
+	// DeleteInteractionResponse deletes the response to the interaction. Follow-up messages can still be sent afterwards.
+	DeleteInteractionResponse(interaction *dg.Interaction) error
+
+	// RespondToInteraction replies to the interaction with the message. The message is ephemeral (visible only to the user who
+	// caused the interaction) if its flags include dg.MessageFlagsEphemeral. Each interaction can be responded to only once.
+	RespondToInteraction(interaction *dg.Interaction, message *dg.MessageSend) error
+
+	// FollowUpInteraction sends another message in response to an interaction that was already responded to. Like the
+	// response, it is ephemeral if its flags include dg.MessageFlagsEphemeral. Returns the message that was created.
+	FollowUpInteraction(interaction *dg.Interaction, message *dg.MessageSend) (*dg.Message, error)
+
+	// InteractionResponse returns the message created by RespondToInteraction
+	InteractionResponse(interaction *dg.Interaction) (*dg.Message, error)
+
+	// EditInteractionMessage replaces the content and embeds of the response or a follow-up message of the interaction
+	EditInteractionMessage(interaction *dg.Interaction, messageID string, message *dg.MessageSend) error
+
+	// AddReaction reacts to the message with the emoji - either a unicode emoji or "name:id" of a custom one
+	AddReaction(channelID, messageID, emoji string) error
+
+	// RemoveReaction removes the reaction of the user to the message. Removing reactions of other users may not be allowed,
+	// e.g. in direct messages.
+	RemoveReaction(channelID, messageID, emoji, userID string) error
+
+	// PublishCommands publishes the application (slash) commands of the bot, replacing the ones published before.
+	// It should be called after Open.
+	PublishCommands(commands []*dg.ApplicationCommand) error
+
+	// SendMessage sends the message to the channel with the given ID. Returns the message that was created.
+	SendMessage(channelID string, message *dg.MessageSend) (*dg.Message, error)
+
+	// EditMessage replaces the content, embeds and files of a message sent by the bot. Returns the edited message.
+	EditMessage(channelID, messageID string, message *dg.MessageSend) (*dg.Message, error)
+
+	// DeleteMessage deletes the message from the channel
+	DeleteMessage(channelID, messageID string) error
+
+	// UserChannel opens (or reuses an already open) direct message channel with the user and returns its ID
+	UserChannel(userID string) (string, error)
+
+	// UpdateStatus changes the status displayed by the bot
+	UpdateStatus(status string) error
+
+	// Member returns information about the user as a member of the guild - their roles and permissions in the channel
+	Member(guildID, channelID, userID string) (*MemberInfo, error)
+
+	// BotUserID returns the user ID of the bot itself, e.g. to recognize mentions of the bot.
+	// Returns an empty string if the ID is not known yet (e.g. before the transport is opened).
+	BotUserID() string
+}
+
+// MemberInfo describes a user as a member of a guild
+type MemberInfo struct {
+
+	// Roles the member has
+	Roles []*dg.Role
+
+	// True if the member is the owner of the guild
+	IsGuildOwner bool
+
+	// Discord permission bits the member has in the channel (e.g. dg.PermissionManageMessages)
+	Permissions int64
+}
@@ -10,6 +10,21 @@ import (
 // Name of the config file
 var configFileName = "config.json"
 
+// defaultCommandPrefix is the command prefix used when no config file is available
+const defaultCommandPrefix = "!"
+
+// defaultDataDirectory is the directory in which data is kept if the config doesn't specify it
+const defaultDataDirectory = "data"
+
+// DefaultConfig returns a Config that can be used when the config file is not available (e.g. when running locally).
+// It has no token so it can't be used to connect to Discord.
+func DefaultConfig() ct.Config {
+	return ct.Config{
+		CommandPrefix: defaultCommandPrefix,
+		DataDirectory: defaultDataDirectory,
+	}
+}
+
 // GetConfig attempts to load the config file from disk and return a valid Config struct
 // If config file cannot be opened, empty Config struct and the file open error will be returned
 // If config file cannot be decoded, empty Config struct and the decoder error will be returned
@@ -33,8 +48,12 @@ func GetConfig() (ct.Config, error) {
 	// Try to decode the file
 	decodeError := decoder.Decode(&configuration)
 
-	// If decoding succeeded, return the struct
+	// If decoding succeeded, fill in the defaults and return the struct
 	if decodeError == nil {
+		if configuration.DataDirectory == "" {
+			configuration.DataDirectory = defaultDataDirectory
+		}
+
 		return configuration, nil
 	}
 
@@ -0,0 +1,95 @@
+package customtypes
+
+import "time"
+
+// ArgumentType is the type of a command argument declared in an ArgumentSpec
+type ArgumentType int
+
+// Supported argument types
+const (
+	// StringArgument accepts any text
+	StringArgument ArgumentType = iota
+
+	// IntArgument accepts whole numbers, optionally limited to a range (see ArgumentSpec.Min and ArgumentSpec.Max)
+	IntArgument
+
+	// EnumArgument accepts one of the values listed in ArgumentSpec.Choices (case insensitive)
+	EnumArgument
+
+	// UserArgument accepts a user mention (<@id> or <@!id>) or a raw user ID. The parsed value is the user ID.
+	UserArgument
+
+	// DurationArgument accepts a positive duration such as 90s, 15m or 1h30m
+	DurationArgument
+)
+
+// ArgumentSpec declares one argument of a command. Arguments are validated by the command handler before the command is
+// invoked - if validation fails the user gets a usage error and the command is not run.
+type ArgumentSpec struct {
+
+	// Name of the argument, shown in usage and used to get the parsed value from CommandArgs
+	Name string
+
+	// Short description of the argument, shown in help
+	Description string
+
+	// Type of the argument
+	Type ArgumentType
+
+	// If true, the argument may be omitted. Only the last arguments of a command may be optional.
+	Optional bool
+
+	// If true, the argument collects all remaining values. Only the last argument of a command may be variadic.
+	Variadic bool
+
+	// Inclusive bounds for IntArgument. Bounds are checked only if at least one of them is non-zero, Max of 0 means no upper bound.
+	Min int
+	Max int
+
+	// Accepted values for EnumArgument
+	Choices []string
+}
+
+// Has returns true if the argument with the given name was provided by the user
+func (args *CommandArgs) Has(name string) bool {
+	_, ok := args.ParsedArgs[name]
+	return ok
+}
+
+// String returns the value of a string, enum or user argument. Returns an empty string if the argument wasn't provided.
+func (args *CommandArgs) String(name string) string {
+	value, _ := args.ParsedArgs[name].(string)
+	return value
+}
+
+// Int returns the value of an int argument. Returns 0 if the argument wasn't provided.
+func (args *CommandArgs) Int(name string) int {
+	value, _ := args.ParsedArgs[name].(int)
+	return value
+}
+
+// Duration returns the value of a duration argument. Returns 0 if the argument wasn't provided.
+func (args *CommandArgs) Duration(name string) time.Duration {
+	value, _ := args.ParsedArgs[name].(time.Duration)
+	return value
+}
+
+// Values returns all values of a variadic argument. Each value has the Go type of the argument type (string, int or
+// time.Duration). Returns nil if the argument wasn't provided.
+func (args *CommandArgs) Values(name string) []interface{} {
+	values, _ := args.ParsedArgs[name].([]interface{})
+	return values
+}
+
+// Strings returns all values of a variadic string, enum or user argument. Returns nil if the argument wasn't provided.
+func (args *CommandArgs) Strings(name string) []string {
+
+	var values []string
+	for _, value := range args.Values(name) {
+		if text, ok := value.(string); ok {
+			values = append(values, text)
+		}
+	}
+
+	return values
+}
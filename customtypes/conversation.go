@@ -0,0 +1,34 @@
+package customtypes
+
+import (
+	dg "github.com/bwmarrin/discordgo"
+	"time"
+)
+
+// ErrConversationTimeout is returned by Conversation when the user doesn't answer in time. Commands may return it as it is,
+// the user is then told that the conversation ended.
+var ErrConversationTimeout = NewUserError("You didn't answer in time, let's try again later.")
+
+// Conversation lets an interactive command (see Command.Interactive) talk with the user who invoked it - send messages while it's
+// running and wait for the answers. Answers are messages and reactions of the user, other users are not affected.
+// Messages the user sends in the channel while the command is waiting for them are answers, even if they look like commands.
+type Conversation interface {
+
+	// Send delivers the response to its targets immediately, without waiting for the command to finish
+	Send(response *Response)
+
+	// Prompt sends the message to the channel in which the command was invoked (for slash commands, as a response) and returns
+	// the sent message, e.g. to wait for reactions to it. Returns nil if the message couldn't be sent.
+	// Slash commands have to respond within a few seconds, so they should prompt before waiting for anything.
+	Prompt(message *dg.MessageSend) *dg.Message
+
+	// AwaitMessage waits for the next message of the user in the channel in which the command was invoked.
+	// Returns ErrConversationTimeout if no message comes before the timeout or before the context of the command expires.
+	AwaitMessage(timeout time.Duration) (*dg.Message, error)
+
+	// AwaitDirectMessage waits for the next direct message from the user, like AwaitMessage
+	AwaitDirectMessage(timeout time.Duration) (*dg.Message, error)
+
+	// AwaitReaction waits for the next reaction of the user to the message, like AwaitMessage
+	AwaitReaction(messageID string, timeout time.Duration) (*dg.MessageReaction, error)
+}
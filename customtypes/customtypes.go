@@ -1,16 +1,102 @@
 package customtypes
 
-import dg "github.com/bwmarrin/discordgo"
+import (
+	"context"
+	dg "github.com/bwmarrin/discordgo"
+)
 
 // CommandHandler is a type definition of a function that can be used as a command handler.
-// First return value is a message to send to the channel from which the command was invoked.
-// Second return value is an error, if it's not nil then the message from first return value won't be sent to the source channel.
-type CommandHandler func(*CommandArgs) (*dg.MessageSend, error)
+// First return value is the response - messages that the handler delivers to the user (see Response), it may be nil if there is
+// nothing to deliver. Commands shouldn't send messages themselves.
+// Second return value is an error, if it's not nil then the response from first return value won't be delivered.
+type CommandHandler func(*CommandArgs) (*Response, error)
+
+// Middleware wraps a command handler in order to add behavior to it - e.g. logging, timing or checks that can prevent the command
+// from running. It receives the command being wrapped and the next handler in the chain and returns the handler that should be
+// invoked instead. The returned handler is expected to call next, unless it decides to stop the invocation.
+type Middleware func(command *Command, next CommandHandler) CommandHandler
+
+// Command describes a command that can be registered in the command handler - the function that runs it and metadata
+// that is shown to users in help.
+type Command struct {
+
+	// Name used to invoke the command (without prefix). Command names are case insensitive.
+	Name string
+
+	// Short description of what the command does
+	Description string
+
+	// Arguments of the command as they should be typed by the user, e.g. "<name> <platform>". Command name is not included.
+	// If it's empty, usage is generated from Arguments.
+	Usage string
+
+	// Arguments accepted by the command. If it's not nil, user arguments are validated and parsed before the command is invoked
+	// and can be read with CommandArgs methods (Int, String, etc.). If it's nil, the command gets the arguments as they were typed.
+	Arguments []ArgumentSpec
+
+	// Example invocations of the command (without prefix), e.g. "roll 20"
+	Examples []string
+
+	// Category the command belongs to, commands are grouped by category in help
+	Category string
+
+	// Alternative names that can be used to invoke the command
+	Aliases []string
+
+	// Function that runs the command. Commands with subcommands (groups) don't need a handler - if there is none, help of the group
+	// is shown when it's invoked without a subcommand.
+	Handler CommandHandler
+
+	// Commands nested in this one, invoked by typing their name after the name of this command (e.g. "monitor add").
+	// Subcommands share the category, permission rule, rate limits and middlewares of the group, unless they set their own
+	// (middlewares of the group run before the ones of the subcommand). Settings configured for the group apply to its subcommands
+	// as well, unless they are configured for the subcommand - e.g. Config.Permissions for "monitor" apply to "monitor add".
+	// When a subcommand is invoked, its name (e.g. in CommandArgs.CommandName) is the full path, e.g. "monitor add".
+	Subcommands []Command
+
+	// Default permission rule of the command, used if the config doesn't set a rule for the command (see Config.Permissions).
+	// If it's nil, everyone can use the command.
+	Permissions *PermissionRule
+
+	// Default rate limits of the command, used if the config doesn't set limits for the command (see Config.RateLimits)
+	RateLimits *CommandRateLimits
+
+	// Middlewares applied only to this command. They run after (inside) the middlewares registered for all commands, in order.
+	Middlewares []Middleware
+
+	// Interactive commands talk with the user while they run (see CommandArgs.Conversation). They don't run in the workers of
+	// the handler, so that waiting for answers doesn't hold up other commands in the channel, and their context expires later
+	// than the context of other commands. A user can have only one interactive command running in a channel.
+	Interactive bool
+
+	// EphemeralResponse should be set for commands that respond only to the user who invoked them (see Response.Ephemeral).
+	// Uses of slash commands are acknowledged before the command runs and the acknowledgement is ephemeral only for these
+	// commands - otherwise everyone in the channel would briefly see that the bot is thinking about the answer.
+	EphemeralResponse bool
+
+	// GuildOnly commands can only be used on a server, e.g. because they change its settings. Users who invoke them in direct
+	// messages are told so before permissions are checked - rules that require a role or a permission can't be met there.
+	// Subcommands of a guild-only group are guild-only as well. Guild-only top level commands aren't offered as slash commands in
+	// direct messages.
+	GuildOnly bool
+}
+
+// InvocationSource tells how a command was invoked
+type InvocationSource int
+
+const (
+	// MessageInvocation is a command typed in a message, after the prefix or a mention of the bot
+	MessageInvocation InvocationSource = iota
+
+	// SlashCommandInvocation is a command invoked as a Discord application (slash) command. Output of such commands is sent as
+	// a reply to the interaction, so it can be ephemeral - visible only to the user (see dg.MessageFlagsEphemeral).
+	SlashCommandInvocation
+)
 
 // CommandArgs is a struct for arguments that are passed to command handlers
 type CommandArgs struct {
 
-	// Name of the invoked command
+	// Name of the invoked command. If the command was invoked using an alias, it's still the main name of the command.
 	CommandName string
 
 	// Name of the user that invoked the command
@@ -19,8 +105,50 @@ type CommandArgs struct {
 	// ID of the user that invoked the command
 	UserID string
 
-	// Arguments passed by the user
+	// ID of the guild in which the command was invoked, empty for direct messages
+	GuildID string
+
+	// ID of the channel in which the command was invoked
+	ChannelID string
+
+	// ID of the message with the command, empty for slash commands
+	MessageID string
+
+	// ID of the interaction, empty for commands typed in messages
+	InteractionID string
+
+	// Files attached to the message with the command (or to the options of the slash command)
+	Attachments []*dg.MessageAttachment
+
+	// Users mentioned in the message with the command (or chosen in user options of the slash command)
+	MentionedUsers []*dg.User
+
+	// IDs of roles mentioned in the message with the command (or chosen in role options of the slash command)
+	MentionedRoles []string
+
+	// IDs of the roles of the user who invoked the command, empty for direct messages
+	MemberRoles []string
+
+	// Arguments passed by the user, split on whitespace. Quoted text is a single argument (quotes are removed) and escapes are
+	// resolved. Case of the arguments is preserved.
 	UserArgs []string
+
+	// Everything the user typed after the command name, exactly as it was typed (only surrounding whitespace is removed)
+	RawArgs string
+
+	// Values of the arguments declared in Command.Arguments, parsed to their types. Key is the argument name.
+	// Arguments that weren't provided are not present.
+	ParsedArgs map[string]interface{}
+
+	// How the command was invoked
+	Source InvocationSource
+
+	// Context of the invocation. It has a deadline (see Config.CommandTimeout) and is canceled when the command returns, so
+	// long-running work done by the command (e.g. requests) should use it.
+	Context context.Context
+
+	// Conversation with the user who invoked the command, nil unless the command is interactive (see Command.Interactive)
+	Conversation Conversation
 }
 
 // Config contains data necessary to configure the bot
@@ -29,9 +157,87 @@ type Config struct {
 	// Token to use when connecting to the server
 	Token string
 
-	// Token to use when connecting to the server
+	// Command prefix used in guilds that didn't set their own
 	CommandPrefix string
 
+	// Directory in which the bot keeps its data (e.g. settings of guilds). If empty, data is kept in memory only.
+	DataDirectory string
+
 	// Time period (in seconds) between two subsequent platform checks
 	PlatformMonitoringPeriod int
+
+	// Number of workers running commands. If it's not positive, the default is used.
+	CommandWorkers int
+
+	// Number of commands that can wait for each worker, commands above this limit are dropped. If it's not positive, the default is used.
+	CommandQueueSize int
+
+	// Time (in seconds) after which the context of a running command expires (see CommandArgs.Context). If it's not positive,
+	// the default (30 seconds) is used.
+	CommandTimeout int
+
+	// Rate limits of commands. Key is the command name, limits under "*" apply to every command without its own entry
+	// (each command is limited separately).
+	RateLimits map[string]CommandRateLimits
+
+	// Permission rules of commands. The outer key is the guild ID, rules under "*" apply to guilds without their own rule for
+	// the command. The inner key is the command name.
+	Permissions map[string]map[string]PermissionRule
+
+	// Size (in kilobytes) at which the audit log of command invocations is rotated. If it's not positive, the default (1024) is used.
+	AuditLogMaxSize int
+
+	// Number of rotated audit log files that are kept. If it's not positive, the default (5) is used.
+	AuditLogFiles int
+
+	// Platforms that may be subscribed to in the platform monitor. Key is the alias, value is the url.
+	// If empty, default platforms are used.
+	Platforms map[string]string
+}
+
+// RateLimit allows Count uses in Seconds seconds. Uses are refilled evenly, so short bursts of up to Count uses are allowed
+// while the long-term rate is limited. Zero value means no limit.
+type RateLimit struct {
+
+	// Number of uses allowed in the period
+	Count int
+
+	// Length of the period in seconds
+	Seconds int
+}
+
+// CommandRateLimits configures rate limits of a command. Each limit is checked separately - the command can be used only if
+// none of them is exceeded.
+type CommandRateLimits struct {
+
+	// Limit of uses by a single user
+	PerUser RateLimit
+
+	// Limit of uses in a single channel
+	PerChannel RateLimit
+
+	// Limit of uses in a single guild
+	PerGuild RateLimit
+}
+
+// PermissionRule specifies who can use a command. A user can use the command if they meet at least one of the criteria.
+// An empty rule allows everyone.
+type PermissionRule struct {
+
+	// Roles (IDs or names) whose members can use the command
+	Roles []string
+
+	// IDs of users that can use the command
+	Users []string
+
+	// If true, the owner of the guild can use the command
+	GuildOwner bool
+
+	// Discord permission bits (e.g. 8192 for ManageMessages), members having all of them in the channel can use the command
+	Permissions int64
+}
+
+// IsEmpty returns true if the rule doesn't restrict anyone
+func (rule PermissionRule) IsEmpty() bool {
+	return len(rule.Roles) == 0 && len(rule.Users) == 0 && !rule.GuildOwner && rule.Permissions == 0
 }
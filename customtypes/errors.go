@@ -0,0 +1,59 @@
+package customtypes
+
+// UserError is an error caused by the user invoking a command, e.g. bad arguments or an unknown platform.
+// When a command returns it, its message is shown to the user. Message should explain what was wrong and how to fix it.
+type UserError struct {
+
+	// Message shown to the user
+	Message string
+}
+
+// Error returns the message of the error
+func (e *UserError) Error() string {
+	return e.Message
+}
+
+// NewUserError creates a UserError with the given message
+func NewUserError(message string) error {
+	return &UserError{Message: message}
+}
+
+// PermissionError is an error returned when the user is not allowed to do what they requested.
+// When a command returns it, the user is told that they lack permissions, along with the message if it's not empty.
+type PermissionError struct {
+
+	// Message explaining which permission is missing, may be empty
+	Message string
+}
+
+// Error returns the message of the error
+func (e *PermissionError) Error() string {
+
+	if e.Message == "" {
+		return "Permission denied"
+	}
+
+	return "Permission denied: " + e.Message
+}
+
+// NewPermissionError creates a PermissionError with the given message
+func NewPermissionError(message string) error {
+	return &PermissionError{Message: message}
+}
+
+// SilentError is an error that is not reported to the user at all, e.g. because the user was already told about the problem.
+type SilentError struct {
+
+	// Reason of the error, for logs
+	Reason string
+}
+
+// Error returns the reason of the error
+func (e *SilentError) Error() string {
+	return e.Reason
+}
+
+// NewSilentError creates a SilentError with the given reason
+func NewSilentError(reason string) error {
+	return &SilentError{Reason: reason}
+}
@@ -0,0 +1,170 @@
+package customtypes
+
+import (
+	dg "github.com/bwmarrin/discordgo"
+	"strconv"
+)
+
+// Limits of Discord messages that pages have to fit in
+const (
+	// MaxContentLength is the maximum number of characters in the content of a message
+	MaxContentLength = 2000
+
+	// MaxEmbedDescriptionLength is the maximum number of characters in the description of an embed
+	MaxEmbedDescriptionLength = 4096
+
+	// MaxEmbedFields is the maximum number of fields in an embed
+	MaxEmbedFields = 25
+
+	// MaxEmbedFieldValueLength is the maximum number of characters in the value of an embed field
+	MaxEmbedFieldValueLength = 1024
+)
+
+// pageNumberReserve is the number of characters left free on each page of content for the page number
+const pageNumberReserve = 20
+
+// ContentPages splits the lines into pages of message content, each at most maxLength characters long (MaxContentLength if
+// maxLength is not positive). The header, if not empty, is the first line of every page. Lines are kept whole, unless a single
+// line doesn't fit on a page - then it's shortened. If there is more than one page, each one ends with its number.
+func ContentPages(header string, lines []string, maxLength int) []*dg.MessageSend {
+
+	if maxLength <= 0 || maxLength > MaxContentLength {
+		maxLength = MaxContentLength
+	}
+
+	// Leave room for the page number
+	contents := SplitLines(header, lines, maxLength-pageNumberReserve)
+
+	pages := make([]*dg.MessageSend, len(contents))
+	for i, content := range contents {
+
+		if len(contents) > 1 {
+			content += "\n*" + pageNumber(i, len(contents)) + "*"
+		}
+
+		pages[i] = &dg.MessageSend{Content: content}
+	}
+
+	return pages
+}
+
+// EmbedPages splits the fields of the embed into pages of at most perPage fields (MaxEmbedFields if perPage is not positive).
+// Each page is a copy of the embed with its fields. If there is more than one page, the number of the page is added to the footer.
+func EmbedPages(embed *dg.MessageEmbed, perPage int) []*dg.MessageSend {
+
+	if perPage <= 0 || perPage > MaxEmbedFields {
+		perPage = MaxEmbedFields
+	}
+
+	// An embed without fields is still one page
+	var fieldPages [][]*dg.MessageEmbedField
+	for start := 0; start < len(embed.Fields) || start == 0; start += perPage {
+
+		end := start + perPage
+		if end > len(embed.Fields) {
+			end = len(embed.Fields)
+		}
+
+		fieldPages = append(fieldPages, embed.Fields[start:end])
+	}
+
+	pages := make([]*dg.MessageSend, len(fieldPages))
+	for i, fields := range fieldPages {
+
+		page := *embed
+		page.Fields = fields
+
+		if len(fieldPages) > 1 {
+			page.Footer = pageFooter(embed.Footer, i, len(fieldPages))
+		}
+
+		pages[i] = &dg.MessageSend{Embeds: []*dg.MessageEmbed{&page}}
+	}
+
+	return pages
+}
+
+// EmbedLinePages splits the lines into pages of embed descriptions, each at most maxLength characters long
+// (MaxEmbedDescriptionLength if maxLength is not positive). Each page is a copy of the embed with its description. Lines are kept
+// whole, unless a single line doesn't fit on a page. If there is more than one page, the number of the page is added to the footer.
+func EmbedLinePages(embed *dg.MessageEmbed, lines []string, maxLength int) []*dg.MessageSend {
+
+	if maxLength <= 0 || maxLength > MaxEmbedDescriptionLength {
+		maxLength = MaxEmbedDescriptionLength
+	}
+
+	descriptions := SplitLines("", lines, maxLength)
+
+	pages := make([]*dg.MessageSend, len(descriptions))
+	for i, description := range descriptions {
+
+		page := *embed
+		page.Description = description
+
+		if len(descriptions) > 1 {
+			page.Footer = pageFooter(embed.Footer, i, len(descriptions))
+		}
+
+		pages[i] = &dg.MessageSend{Embeds: []*dg.MessageEmbed{&page}}
+	}
+
+	return pages
+}
+
+// SplitLines joins the lines into texts of at most limit characters, each starting with the header (if it's not empty). Lines are
+// kept whole, unless a single line doesn't fit in a text - then it's shortened. Returns at least one text.
+func SplitLines(header string, lines []string, limit int) []string {
+
+	var texts []string
+	current, currentLines := header, 0
+
+	for _, line := range lines {
+
+		next := joinLine(current, line)
+
+		// Start a new text if the line doesn't fit in the current one, but keep at least one line in each text
+		if len([]rune(next)) > limit && currentLines > 0 {
+			texts = append(texts, current)
+			current, currentLines = header, 0
+			next = joinLine(current, line)
+		}
+
+		// A line that doesn't fit even in an empty text is shortened
+		if runes := []rune(next); len(runes) > limit {
+			next = string(runes[:limit-3]) + "..."
+		}
+
+		current = next
+		currentLines++
+	}
+
+	return append(texts, current)
+}
+
+// joinLine appends the line to the text, separated by a newline if the text is not empty
+func joinLine(text, line string) string {
+
+	if text == "" {
+		return line
+	}
+
+	return text + "\n" + line
+}
+
+// pageNumber returns the number of the page (counted from 0) shown to users, e.g. "Page 1/3"
+func pageNumber(page, count int) string {
+	return "Page " + strconv.Itoa(page+1) + "/" + strconv.Itoa(count)
+}
+
+// pageFooter returns the footer of the page, the number of the page is added after the text of the original footer
+func pageFooter(footer *dg.MessageEmbedFooter, page, count int) *dg.MessageEmbedFooter {
+
+	if footer == nil || footer.Text == "" {
+		return &dg.MessageEmbedFooter{Text: pageNumber(page, count)}
+	}
+
+	pageFooter := *footer
+	pageFooter.Text += " • " + pageNumber(page, count)
+
+	return &pageFooter
+}
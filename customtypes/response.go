@@ -0,0 +1,108 @@
+package customtypes
+
+import dg "github.com/bwmarrin/discordgo"
+
+// ResponseTarget tells where a message of a response is delivered
+type ResponseTarget int
+
+const (
+	// ChannelTarget is the channel in which the command was invoked. Slash commands get the message as a response.
+	ChannelTarget ResponseTarget = iota
+
+	// ReplyTarget is the channel in which the command was invoked, the message is a reply to the message with the command.
+	// Slash commands get the message as a response.
+	ReplyTarget
+
+	// DirectMessageTarget is a direct message to the user who invoked the command
+	DirectMessageTarget
+
+	// EphemeralTarget shows the message only to the user who invoked the command - as an ephemeral response to slash commands
+	// and as a direct message for typed commands
+	EphemeralTarget
+
+	// ReactionTarget is a reaction on the message with the command. Slash commands have no such message, so they get the
+	// reaction as an ephemeral response.
+	ReactionTarget
+)
+
+// ResponseMessage is a single message of a response together with its target
+type ResponseMessage struct {
+
+	// Where the message is delivered
+	Target ResponseTarget
+
+	// The message, nil for reactions. For paginated messages it's the first page.
+	Message *dg.MessageSend
+
+	// Pages of a paginated message (see Response.Paginate), nil for other messages
+	Pages []*dg.MessageSend
+
+	// Emoji added as a reaction, used only with ReactionTarget. It's either a unicode emoji or "name:id" of a custom one.
+	Reaction string
+}
+
+// Response is the output of a command - messages that the handler delivers to their targets, in order.
+// Responses are built with chained calls, e.g. NewResponse().Reply(message).React("👍").
+type Response struct {
+
+	// Messages of the response, in order of delivery
+	Messages []ResponseMessage
+}
+
+// NewResponse creates an empty response
+func NewResponse() *Response {
+	return &Response{}
+}
+
+// MessageResponse creates a response consisting of one message sent to the channel in which the command was invoked
+func MessageResponse(message *dg.MessageSend) *Response {
+	return NewResponse().Channel(message)
+}
+
+// Channel adds a message sent to the channel in which the command was invoked
+func (r *Response) Channel(message *dg.MessageSend) *Response {
+	return r.add(ResponseMessage{Target: ChannelTarget, Message: message})
+}
+
+// Reply adds a message sent as a reply to the message with the command
+func (r *Response) Reply(message *dg.MessageSend) *Response {
+	return r.add(ResponseMessage{Target: ReplyTarget, Message: message})
+}
+
+// DirectMessage adds a message sent directly to the user who invoked the command
+func (r *Response) DirectMessage(message *dg.MessageSend) *Response {
+	return r.add(ResponseMessage{Target: DirectMessageTarget, Message: message})
+}
+
+// Ephemeral adds a message shown only to the user who invoked the command
+func (r *Response) Ephemeral(message *dg.MessageSend) *Response {
+	return r.add(ResponseMessage{Target: EphemeralTarget, Message: message})
+}
+
+// React adds a reaction with the emoji to the message with the command
+func (r *Response) React(emoji string) *Response {
+	return r.add(ResponseMessage{Target: ReactionTarget, Reaction: emoji})
+}
+
+// Paginate adds a message consisting of pages (e.g. created with ContentPages or EmbedPages), delivered to the target.
+// Only the first page is sent, the user who invoked the command can switch pages with reactions for a while. Slash commands can't
+// react to ephemeral responses, so they get all pages at once. The target can't be ReactionTarget and pages can't be empty.
+func (r *Response) Paginate(target ResponseTarget, pages []*dg.MessageSend) *Response {
+
+	if target == ReactionTarget || len(pages) == 0 {
+		return r
+	}
+
+	return r.add(ResponseMessage{Target: target, Message: pages[0], Pages: pages})
+}
+
+// IsEmpty returns true if the response has nothing to deliver
+func (r *Response) IsEmpty() bool {
+	return r == nil || len(r.Messages) == 0
+}
+
+// add appends the message to the response and returns the response, so that calls can be chained
+func (r *Response) add(message ResponseMessage) *Response {
+	r.Messages = append(r.Messages, message)
+	return r
+}
@@ -1,88 +1,85 @@
 package initialization
 
 import (
-	dg "github.com/bwmarrin/discordgo"
-
-	"github.com/generalkenobi/makrochatbot/commands/handler"
-	pm "github.com/generalkenobi/makrochatbot/commands/platformmonitor"
-	"github.com/generalkenobi/makrochatbot/commands/reactions"
-	"github.com/generalkenobi/makrochatbot/commands/roll"
+	"github.com/generalkenobi/makrochatbot/bot"
 	"github.com/generalkenobi/makrochatbot/communication"
 	"github.com/generalkenobi/makrochatbot/configuration"
 	ct "github.com/generalkenobi/makrochatbot/customtypes"
 	"github.com/generalkenobi/makrochatbot/logger"
 	"math/rand"
+	"os"
 	"time"
 )
 
-// Run performs all initization for the program.
-// If everything goes well then an open discordgo session is returned - IT HAS TO BE CLOSED BEFORE CLOSING THE PROGRAM.
-// If any crucial part of initization fails then the returned session will be null and error will contain information about the error.
-func Run() (*dg.Session, error) {
+// Run performs all initization for the program and starts a bot connected to Discord.
+// If everything goes well then a running bot is returned - IT HAS TO BE STOPPED BEFORE CLOSING THE PROGRAM.
+// If any crucial part of initization fails then the returned bot will be nil and error will contain information about the error.
+func Run() (*bot.Bot, error) {
 
-	// Perform the necessary initialization
-	config, session, err := requiredInit()
+	// Get the configuration file
+	config, err := configuration.GetConfig()
 
-	// If something went wrong, return the error
+	// If the config file couldn't be obtained, return nil (can't initialize) and the error generated by config file fetcher
 	if err != nil {
 		return nil, err
 	}
 
-	logger.Log("Core initialization complete")
+	// Create discord transport
+	transport, err := communication.NewDiscordTransport(config.Token)
+
+	// If the transport couldn't be created, return nil (can't initialize) and the generated error
+	if err != nil {
+		return nil, err
+	}
 
-	// Add handler for incomming messages
-	session.AddHandler(handler.ParseCommand)
+	return start(config, transport)
+}
 
-	// Register command prefix
-	handler.RegisterCommandPrefix(config.CommandPrefix)
+// RunConsole performs all initialization for running the bot locally, in a console.
+// Messages are read line by line from stdin and everything the bot sends is printed to stdout.
+// If the config file can't be loaded then the default config is used - a Discord token is not needed in console mode.
+// Returned channel is closed when stdin is exhausted.
+func RunConsole() (*bot.Bot, <-chan struct{}, error) {
 
-	// Call the helper function to register all commands
-	registerCommands()
-	logger.Log("Command handler initialized")
+	// Get the configuration file, fall back to the default one if it couldn't be obtained
+	config, err := configuration.GetConfig()
 
-	// Seed the random number generator
-	rand.Seed(time.Now().UTC().UnixNano())
-	logger.Log("Random number generator seeded")
+	if err != nil {
+		logger.Log("Config file couldn't be loaded, using default config. Details: " + err.Error())
+		config = configuration.DefaultConfig()
+	}
 
-	// Start platform monitoring service
-	pm.Start(config.PlatformMonitoringPeriod)
-	logger.Log("Platform monitoring service started")
+	// Create a transport working on standard input and output
+	transport := communication.NewConsoleTransport(os.Stdin, os.Stdout)
 
-	// Finally return the session and no error
-	return session, nil
-}
+	b, err := start(config, transport)
 
-// registerCommands registers all commands handled by the bot
-func registerCommands() {
+	if err != nil {
+		return nil, nil, err
+	}
 
-	handler.RegisterCommand("roll", roll.Roll)
-	handler.RegisterCommand("group1", reactions.ImageReaction)
-	handler.RegisterCommand("group2", reactions.ImageReaction)
-	handler.RegisterCommand("subscribe", pm.CreateMonitorSubscription)
-	handler.RegisterCommand("unsubscribeall", pm.RemoveAllSubscriptions)
+	return b, transport.Done(), nil
 }
 
-// requiredInit performs crucial initialization tasks - loading config file and opening Discord session.
-// If any of these fails then the program can't run.
-// If everything went well the obtained Config and an opened discordgo session are returned, error in that case is nil.
-// If something went wrong both config and session are nil and error contains information on what went wrong.
-func requiredInit() (*ct.Config, *dg.Session, error) {
+// start creates a bot for the given config and transport and starts it.
+// If anything fails then the returned bot is nil and error contains information about the error.
+func start(config ct.Config, transport communication.Transport) (*bot.Bot, error) {
 
-	// Get the configuration file
-	config, err := configuration.GetConfig()
+	// Seed the random number generator
+	rand.Seed(time.Now().UTC().UnixNano())
+	logger.Log("Random number generator seeded")
+
+	// Create the bot
+	b, err := bot.New(config, transport)
 
-	// If the config file couldn't be obtained, return nil (can't initialize) and the error generated by config file fetcher
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	// Open discord session
-	session, err := communication.ConnectToDiscord(config.Token)
-
-	// If the session couldn't be opened, return nil (can't initialize) and the generated error
-	if err != nil {
-		return nil, nil, err
+	// And start it
+	if err = b.Start(); err != nil {
+		return nil, err
 	}
 
-	return &config, session, nil
+	return b, nil
 }
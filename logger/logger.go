@@ -22,11 +22,11 @@ func LogError(err error) {
 }
 
 // LogCommand logs information about command being invoked by a user
-func LogCommand(guildID, channelID string, args ct.CommandArgs) {
+func LogCommand(args ct.CommandArgs) {
 
 	// Create log message. Specify the guild, channel, command, user and arguments
-	log := "Guild: " + guildID +
-		", Channel: " + channelID +
+	log := "Guild: " + args.GuildID +
+		", Channel: " + args.ChannelID +
 		", Command: \"" + args.CommandName +
 		"\", User: " + args.Username + " (ID: " + args.UserID + ")" +
 		", args: " + strings.Join(args.UserArgs, ", ")
@@ -0,0 +1,145 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// sweepInterval is the minimum time between two removals of unused buckets
+const sweepInterval = 10 * time.Minute
+
+// Limiter limits how often something can happen, separately for each key (e.g. user ID). It uses the token bucket algorithm -
+// each key has a bucket holding up to Count tokens, each event takes one token and tokens are refilled evenly over Period.
+// This allows short bursts of up to Count events while limiting the long-term rate to Count events per Period.
+// Limiter is safe for concurrent use.
+type Limiter struct {
+
+	// capacity is the maximum number of tokens in a bucket
+	capacity float64
+
+	// refillRate is the number of tokens added to a bucket each second
+	refillRate float64
+
+	// buckets holds the bucket of each key
+	buckets map[string]*bucket
+
+	// lastSweep is the time at which unused buckets were last removed
+	lastSweep time.Time
+
+	// mutex is used to synchronize access to buckets
+	mutex sync.Mutex
+}
+
+// bucket holds tokens of a single key
+type bucket struct {
+
+	// tokens currently in the bucket
+	tokens float64
+
+	// updated is the time when tokens was last updated
+	updated time.Time
+}
+
+// New creates a limiter allowing count events per period for each key.
+// Returns nil if count or period is not positive - nil limiter allows everything.
+func New(count int, period time.Duration) *Limiter {
+
+	if count <= 0 || period <= 0 {
+		return nil
+	}
+
+	limiter := &Limiter{
+		capacity:   float64(count),
+		refillRate: float64(count) / period.Seconds(),
+		buckets:    make(map[string]*bucket),
+		lastSweep:  time.Now(),
+	}
+
+	return limiter
+}
+
+// Allow takes a token for the key if one is available. Returns true if the event is allowed. Otherwise returns false and the time
+// after which a token will be available.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+
+	if wait := l.Wait(key); wait > 0 {
+		return false, wait
+	}
+
+	l.Take(key)
+	return true, 0
+}
+
+// Wait returns the time after which a token will be available for the key, 0 if a token is available now.
+// It doesn't take the token - it allows checking several limiters before taking tokens from all of them.
+func (l *Limiter) Wait(key string) time.Duration {
+
+	// Nil limiter allows everything
+	if l == nil {
+		return 0
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	b := l.refill(key, time.Now())
+
+	if b.tokens >= 1 {
+		return 0
+	}
+
+	// Compute how long it will take to refill the missing part of the token
+	return time.Duration((1 - b.tokens) / l.refillRate * float64(time.Second))
+}
+
+// Take takes a token for the key, even if there is none available (the bucket goes into debt then)
+func (l *Limiter) Take(key string) {
+
+	if l == nil {
+		return
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.refill(key, time.Now()).tokens--
+}
+
+// refill returns the bucket of the key, with tokens refilled up to now. Creates a full bucket if the key has none.
+// It also removes unused buckets from time to time. Mutex has to be held by the caller.
+func (l *Limiter) refill(key string, now time.Time) *bucket {
+
+	// Remove unused buckets from time to time, so that the map doesn't grow forever
+	if now.Sub(l.lastSweep) > sweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+
+	if !ok {
+		b = &bucket{tokens: l.capacity, updated: now}
+		l.buckets[key] = b
+		return b
+	}
+
+	// Add tokens for the time that passed, the bucket can't hold more than its capacity
+	b.tokens += now.Sub(b.updated).Seconds() * l.refillRate
+	if b.tokens > l.capacity {
+		b.tokens = l.capacity
+	}
+
+	b.updated = now
+	return b
+}
+
+// sweep removes buckets that would be full by now - they are indistinguishable from new ones. Mutex has to be held by the caller.
+func (l *Limiter) sweep(now time.Time) {
+
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.updated).Seconds()*l.refillRate >= l.capacity {
+			delete(l.buckets, key)
+		}
+	}
+
+	l.lastSweep = now
+}
@@ -0,0 +1,152 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewRejectsNonPositiveLimits(t *testing.T) {
+
+	tests := []struct {
+		count  int
+		period time.Duration
+	}{
+		{count: 0, period: time.Minute},
+		{count: -1, period: time.Minute},
+		{count: 3, period: 0},
+		{count: 3, period: -time.Second},
+	}
+
+	for _, test := range tests {
+
+		limiter := New(test.count, test.period)
+		if limiter != nil {
+			t.Errorf("New(%d, %v) = %v, expected nil", test.count, test.period, limiter)
+		}
+
+		// Nil limiter allows everything
+		for i := 0; i < 10; i++ {
+			if allowed, wait := limiter.Allow("key"); !allowed || wait != 0 {
+				t.Fatalf("Nil limiter denied event %d, wait %v", i+1, wait)
+			}
+		}
+	}
+}
+
+func TestAllowBurst(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		count  int
+		period time.Duration
+	}{
+		{name: "one per second", count: 1, period: time.Second},
+		{name: "burst of three", count: 3, period: time.Minute},
+		{name: "burst of ten", count: 10, period: time.Hour},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			limiter := New(test.count, test.period)
+
+			for i := 0; i < test.count; i++ {
+				if allowed, _ := limiter.Allow("user"); !allowed {
+					t.Fatalf("Event %d of %d was denied", i+1, test.count)
+				}
+			}
+
+			allowed, wait := limiter.Allow("user")
+			if allowed {
+				t.Fatal("Event over the burst was allowed")
+			}
+
+			// One token is refilled every period/count
+			interval := test.period / time.Duration(test.count)
+			if wait <= 0 || wait > interval {
+				t.Errorf("Wait = %v, expected up to %v", wait, interval)
+			}
+
+			// Other keys have their own buckets
+			if allowed, _ := limiter.Allow("another user"); !allowed {
+				t.Error("Event of another key was denied")
+			}
+		})
+	}
+}
+
+func TestWaitDoesNotTakeToken(t *testing.T) {
+
+	limiter := New(1, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		if wait := limiter.Wait("user"); wait != 0 {
+			t.Fatalf("Wait = %v before any event, expected 0", wait)
+		}
+	}
+
+	// Take goes into debt, the wait grows with it
+	limiter.Take("user")
+	first := limiter.Wait("user")
+
+	limiter.Take("user")
+	second := limiter.Wait("user")
+
+	if first <= 0 || second <= first {
+		t.Errorf("Waits after taking tokens = %v and %v, expected positive and growing", first, second)
+	}
+}
+
+func TestRefill(t *testing.T) {
+
+	start := time.Now()
+
+	tests := []struct {
+		name    string
+		taken   int
+		elapsed time.Duration
+		tokens  float64
+	}{
+		{name: "nothing taken", taken: 0, elapsed: 0, tokens: 4},
+		{name: "no time passed", taken: 4, elapsed: 0, tokens: 0},
+		{name: "one token refilled", taken: 4, elapsed: 15 * time.Second, tokens: 1},
+		{name: "half a token refilled", taken: 2, elapsed: 7500 * time.Millisecond, tokens: 2.5},
+		{name: "refilled up to capacity", taken: 4, elapsed: time.Hour, tokens: 4},
+		{name: "debt is repaid first", taken: 6, elapsed: 30 * time.Second, tokens: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			// 4 tokens per minute - one every 15 seconds
+			limiter := New(4, time.Minute)
+
+			bucket := limiter.refill("user", start)
+			bucket.tokens -= float64(test.taken)
+
+			if tokens := limiter.refill("user", start.Add(test.elapsed)).tokens; tokens != test.tokens {
+				t.Errorf("Tokens = %v, expected %v", tokens, test.tokens)
+			}
+		})
+	}
+}
+
+func TestSweepRemovesFullBuckets(t *testing.T) {
+
+	start := time.Now()
+	limiter := New(2, time.Minute)
+
+	limiter.refill("idle", start)
+	limiter.refill("busy", start).tokens -= 2
+
+	// After 30 seconds the busy bucket has only one of its two tokens back
+	limiter.sweep(start.Add(30 * time.Second))
+
+	if _, ok := limiter.buckets["idle"]; ok {
+		t.Error("Full bucket was not removed")
+	}
+
+	if _, ok := limiter.buckets["busy"]; !ok {
+		t.Error("Bucket that is not full was removed")
+	}
+}
@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// guildsFileName is the name of the file in which guild settings are stored
+const guildsFileName = "guilds.json"
+
+// GuildSettings are settings of a guild that can be changed at runtime by its admins
+type GuildSettings struct {
+
+	// Command prefix used in the guild, empty if the default one should be used
+	Prefix string `json:",omitempty"`
+
+	// True if the bot shouldn't suggest commands when an unknown one is used
+	DisableSuggestions bool `json:",omitempty"`
+
+	// Full names of commands disabled in the whole guild (e.g. "group1" or "monitor add"), lowercase
+	DisabledCommands []string `json:",omitempty"`
+
+	// Commands enabled (true) or disabled (false) in particular channels, overriding DisabledCommands. Key is the channel ID,
+	// key of the inner map is the full name of the command, lowercase.
+	ChannelCommands map[string]map[string]bool `json:",omitempty"`
+}
+
+// clone returns a deep copy of the settings, so that they can be modified without affecting the original
+func (settings GuildSettings) clone() GuildSettings {
+
+	clone := settings
+	clone.DisabledCommands = append([]string(nil), settings.DisabledCommands...)
+
+	if settings.ChannelCommands != nil {
+		clone.ChannelCommands = make(map[string]map[string]bool, len(settings.ChannelCommands))
+
+		for channelID, commands := range settings.ChannelCommands {
+			clone.ChannelCommands[channelID] = make(map[string]bool, len(commands))
+
+			for name, enabled := range commands {
+				clone.ChannelCommands[channelID][name] = enabled
+			}
+		}
+	}
+
+	return clone
+}
+
+// Store holds settings of guilds and persists them in a JSON file, so that they survive restarts. It is safe for concurrent use.
+type Store struct {
+
+	// path of the file with guild settings, empty if the settings are not persisted
+	path string
+
+	// guilds holds settings of each guild, key is the guild ID
+	guilds map[string]GuildSettings
+
+	// mutex is used to synchronize access to guilds and the file
+	mutex sync.RWMutex
+}
+
+// Open creates a store persisted in the given directory. Settings saved there earlier are loaded.
+// If directory is empty then the store is not persisted - settings are kept in memory only (useful for tests and local runs).
+// Returns an error if the directory can't be created or the existing file can't be read.
+func Open(directory string) (*Store, error) {
+
+	store := &Store{guilds: make(map[string]GuildSettings)}
+
+	if directory == "" {
+		return store, nil
+	}
+
+	// Make sure the directory exists
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return nil, errors.New("Can't create data directory " + directory + ". Details: " + err.Error())
+	}
+
+	store.path = filepath.Join(directory, guildsFileName)
+
+	// Load the settings saved earlier, if there are any
+	data, err := ioutil.ReadFile(store.path)
+
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+
+	if err != nil {
+		return nil, errors.New("Can't read " + store.path + ". Details: " + err.Error())
+	}
+
+	if err = json.Unmarshal(data, &store.guilds); err != nil {
+		return nil, errors.New("Can't decode " + store.path + ". Details: " + err.Error())
+	}
+
+	// Decoding "null" results in a nil map
+	if store.guilds == nil {
+		store.guilds = make(map[string]GuildSettings)
+	}
+
+	return store, nil
+}
+
+// Guild returns the settings of the guild. Guilds that have no settings saved get zero-value settings.
+// The returned settings must not be modified, use UpdateGuild to change them.
+func (s *Store) Guild(guildID string) GuildSettings {
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.guilds[guildID]
+}
+
+// UpdateGuild modifies the settings of the guild with the update function and saves them. The function gets a copy of the settings,
+// so it can modify them freely. If saving fails then the change is reverted and an error is returned.
+func (s *Store) UpdateGuild(guildID string, update func(*GuildSettings)) error {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	previous, existed := s.guilds[guildID]
+
+	settings := previous.clone()
+	update(&settings)
+	s.guilds[guildID] = settings
+
+	// Save the change, revert it if that's not possible so that memory and file stay consistent
+	if err := s.save(); err != nil {
+		if existed {
+			s.guilds[guildID] = previous
+		} else {
+			delete(s.guilds, guildID)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// save writes all settings to the file. The file is replaced atomically, so that a crash can't leave it half-written.
+// Mutex has to be held by the caller.
+func (s *Store) save() error {
+
+	// Nothing to do if the store is not persisted
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(s.guilds, "", "\t")
+	if err != nil {
+		return errors.New("Can't encode guild settings. Details: " + err.Error())
+	}
+
+	// Write to a temporary file and then replace the old one with it
+	temporaryPath := s.path + ".tmp"
+
+	if err = ioutil.WriteFile(temporaryPath, data, 0644); err != nil {
+		return errors.New("Can't write " + temporaryPath + ". Details: " + err.Error())
+	}
+
+	if err = os.Rename(temporaryPath, s.path); err != nil {
+		return errors.New("Can't replace " + s.path + ". Details: " + err.Error())
+	}
+
+	return nil
+}